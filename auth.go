@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"path/filepath"
 	"strconv"
 
 	"github.com/chaindead/telegram-mcp/internal/tg"
@@ -18,15 +19,34 @@ func authCommand(_ context.Context, cmd *cli.Command) error {
 	appID := cmd.Root().Int("app-id")
 	apiHash := cmd.Root().String("api-hash")
 	sessionPath := cmd.Root().String("session")
+	profile := cmd.String("profile")
+
+	if profile != "" {
+		if err := validateProfile(profile); err != nil {
+			return err
+		}
+
+		dir := profileDir(cmd, profile)
+		sessionPath = filepath.Join(dir, profileSessionFile)
+		if err := saveProfile(dir, profileConfig{AppID: appID, APIHash: apiHash}); err != nil {
+			return err
+		}
+	}
 
 	log.Info().
 		Str("phone", phone).
 		Str("api-hash", apiHash).
 		Str("session", sessionPath).
+		Str("profile", profile).
 		Int64("app-id", appID).
 		Msg("Authenticate with Telegram")
 
-	err := tg.Auth(phone, appID, apiHash, sessionPath, pass, newSession)
+	secret, err := sessionSecret(cmd)
+	if err != nil {
+		return err
+	}
+
+	err = tg.Auth(phone, appID, apiHash, sessionPath, pass, newSession, tg.NewSessionStorage(sessionPath, secret))
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to authenticate with Telegram")
 	}
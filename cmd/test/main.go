@@ -2,17 +2,26 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"os"
 	"os/signal"
 	"strconv"
 
 	"github.com/chaindead/telegram-mcp/internal/tg"
-	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	cfg "github.com/spf13/pflag"
+)
+
+//nolint:gochecknoglobals // CLI flags must be global
+var (
+	messageLimit = cfg.Int("limit", tg.DefaultUnreadPerDialog, "limit of unread messages to fetch per dialog")
+	dialogLimit  = cfg.Int("dialogs", tg.DefaultUnreadDialogs, "limit of unread dialogs to fetch")
 )
 
 func main() {
+	cfg.Parse()
+
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
 	log.Logger = log.Output(zerolog.ConsoleWriter{
 		Out:        os.Stderr,
@@ -38,40 +47,31 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
 
-	client := tg.New(appID, apiHash, sessionPath).T()
-
-	if err := client.Run(ctx, func(ctx context.Context) error {
-		self, err := client.Self(ctx)
-		if err != nil {
-			return errors.Wrap(err, "get self")
-		}
-
-		log.Info().
-			Str("first_name", self.FirstName).
-			Str("last_name", self.LastName).
-			Str("username", self.Username).
-			Int64("id", self.ID).
-			Msg("Logged in as")
+	secret := []byte(os.Getenv("TG_SESSION_PASSPHRASE"))
+	client := tg.New(appID, apiHash, sessionPath, tg.WithSessionStorage(tg.NewSessionStorage(sessionPath, secret)))
 
-		messages, err := getUnreadMessages(ctx, client)
-		if err != nil {
-			return errors.Wrap(err, "get unread messages")
-		}
+	clientDone := make(chan error, 1)
+	go func() {
+		clientDone <- client.Run(ctx)
+	}()
 
-		for _, msg := range messages {
-			log.Info().
-				Int("id", msg.ID).
-				Str("text", msg.Text).
-				Time("date", msg.Date).
-				Int64("from_id", msg.FromID).
-				Str("from_name", msg.FromName).
-				Str("chat_type", msg.ChatType).
-				Str("chat_title", msg.ChatTitle).
-				Msg("Unread message")
-		}
+	unread, err := client.Unread(tg.UnreadArguments{Limit: *messageLimit, MaxDialogs: *dialogLimit})
+	if err != nil {
+		log.Fatal().Err(err).Msg("get unread messages")
+	}
 
-		return nil
-	}); err != nil {
-		log.Fatal().Err(err).Msg("client error")
+	for _, d := range unread.Dialogs {
+		data, _ := json.Marshal(d.Messages)
+		log.Info().
+			Str("name", d.Name).
+			Str("type", d.Type).
+			Str("title", d.Title).
+			Int("unread", d.UnreadCount).
+			Int("mentions", d.UnreadMentions).
+			RawJSON("messages", data).
+			Msg("Unread dialog")
 	}
+
+	cancel()
+	<-clientDone
 }
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/chaindead/telegram-mcp/internal/tg"
+
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v3"
+)
+
+var unsafeDirRe = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+func exportCommand(ctx context.Context, cmd *cli.Command) error {
+	pos, err := toolArgs(cmd, "dialog")
+	if err != nil {
+		return err
+	}
+
+	loaded, err := loadAccounts(cmd, accountOptions{})
+	if err != nil {
+		return err
+	}
+	defer closeAccounts(loaded)
+
+	accounts := tg.NewAccounts()
+	for _, acc := range loaded {
+		accounts.Add(acc.name, acc.client)
+	}
+
+	client, err := accounts.Client(cmd.String("account"))
+	if err != nil {
+		return err
+	}
+
+	dir := cmd.String("out")
+	if dir == "" {
+		dir = "export-" + strings.Trim(unsafeDirRe.ReplaceAllString(pos[0], "_"), "_.")
+	}
+
+	opts := tg.ExportOptions{
+		Dialog: pos[0],
+		Format: cmd.String("format"),
+		Dir:    dir,
+		Since:  cmd.String("since"),
+		Until:  cmd.String("until"),
+		Media:  cmd.Bool("media"),
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		_ = client.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	result, err := client.Export(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("export %s: %w", opts.Dialog, err)
+	}
+
+	log.Info().
+		Str("path", result.Path).
+		Int("messages", result.Messages).
+		Int("files", result.Files).
+		Bool("resumed", result.Resumed).
+		Msg("Export written")
+
+	if len(result.Skipped) > 0 {
+		log.Warn().Ints("messages", result.Skipped).Msg("Media of some messages was not downloaded, see file_skipped")
+	}
+
+	return nil
+}
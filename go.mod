@@ -10,6 +10,9 @@ require (
 	github.com/spf13/pflag v1.0.6
 	github.com/tidwall/gjson v1.18.0
 	github.com/urfave/cli/v3 v3.1.0
+	go.etcd.io/bbolt v1.4.0
+	golang.org/x/crypto v0.36.0
+	golang.org/x/text v0.23.0
 	golang.org/x/time v0.11.0
 )
 
@@ -45,13 +48,11 @@ require (
 	go.uber.org/atomic v1.11.0 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
 	go.uber.org/zap v1.27.0 // indirect
-	golang.org/x/crypto v0.36.0 // indirect
 	golang.org/x/exp v0.0.0-20230725093048-515e97ebf090 // indirect
 	golang.org/x/mod v0.24.0 // indirect
 	golang.org/x/net v0.37.0 // indirect
 	golang.org/x/sync v0.12.0 // indirect
 	golang.org/x/sys v0.31.0 // indirect
-	golang.org/x/text v0.23.0 // indirect
 	golang.org/x/tools v0.31.0 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
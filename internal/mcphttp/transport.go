@@ -0,0 +1,630 @@
+// Package mcphttp implements an MCP server transport over HTTP.
+//
+// It serves the streamable HTTP transport on /mcp (POST for requests, GET for
+// the server notification stream) and the legacy SSE transport on /sse with
+// messages posted to /message. Several clients can share one server; request
+// ids are remapped so concurrent clients never collide, and handlers see the
+// session of a request through SessionID.
+package mcphttp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/metoro-io/mcp-golang/transport"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	EndpointStreamable = "/mcp"
+	EndpointSSE        = "/sse"
+	EndpointMessage    = "/message"
+
+	// HeaderSessionID carries the session of the streamable transport, assigned on initialize
+	HeaderSessionID = "Mcp-Session-Id"
+
+	maxBodySize     = 4 << 20
+	streamBuffer    = 64
+	shutdownTimeout = 5 * time.Second
+)
+
+// Transport implements transport.Transport for HTTP clients.
+type Transport struct {
+	addr  string
+	token string
+
+	server *http.Server
+	nextID atomic.Int64
+
+	mu                  sync.RWMutex
+	messageHandler      func(ctx context.Context, message *transport.BaseJsonRpcMessage)
+	errorHandler        func(error)
+	closeHandler        func()
+	sessionCloseHandler func(id string)
+	pending             map[transport.RequestId]*pendingRequest
+	streams             map[string]*stream
+	// sessions assigned to streamable clients, they end with DELETE
+	sessions map[string]bool
+}
+
+type sessionKey struct{}
+
+// WithSession returns ctx addressing Send of notifications to the session only, empty id keeps the broadcast.
+func WithSession(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, sessionKey{}, id)
+}
+
+// SessionID returns the session of the request the handler got ctx with, empty for clients without one.
+func SessionID(ctx context.Context) string {
+	id, _ := ctx.Value(sessionKey{}).(string)
+
+	return id
+}
+
+type pendingRequest struct {
+	originalID transport.RequestId
+	// exactly one of reply or session is set
+	reply   chan *transport.BaseJsonRpcMessage
+	session *stream
+}
+
+type stream struct {
+	id string
+	ch chan []byte
+}
+
+// New creates a transport listening on addr. Requests must carry
+// "Authorization: Bearer <token>" unless token is empty.
+func New(addr, token string) *Transport {
+	return &Transport{
+		addr:     addr,
+		token:    token,
+		pending:  make(map[transport.RequestId]*pendingRequest),
+		streams:  make(map[string]*stream),
+		sessions: make(map[string]bool),
+	}
+}
+
+// Handler returns the HTTP handler serving all MCP endpoints.
+func (t *Transport) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(EndpointStreamable, t.handleStreamable)
+	mux.HandleFunc(EndpointSSE, t.handleSSE)
+	mux.HandleFunc(EndpointMessage, t.handleMessage)
+
+	return t.authorize(mux)
+}
+
+// Start implements transport.Transport. It binds the listener and serves in background.
+func (t *Transport) Start(_ context.Context) error {
+	ln, err := net.Listen("tcp", t.addr)
+	if err != nil {
+		return errors.Wrapf(err, "listen(%s)", t.addr)
+	}
+
+	t.server = &http.Server{
+		Handler:           t.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		if err := t.server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			t.handleError(errors.Wrap(err, "http serve"))
+		}
+	}()
+
+	log.Info().Str("addr", ln.Addr().String()).Msg("MCP HTTP transport listening")
+
+	return nil
+}
+
+// Send implements transport.Transport. Responses are routed to the client that issued the request,
+// other messages go to the stream of the WithSession session or are broadcast to open event streams.
+func (t *Transport) Send(ctx context.Context, message *transport.BaseJsonRpcMessage) error {
+	var id transport.RequestId
+	switch message.Type {
+	case transport.BaseMessageTypeJSONRPCResponseType:
+		id = message.JsonRpcResponse.Id
+	case transport.BaseMessageTypeJSONRPCErrorType:
+		id = message.JsonRpcError.Id
+	default:
+		if session := SessionID(ctx); session != "" {
+			return t.sendTo(session, message)
+		}
+
+		return t.broadcast(message)
+	}
+
+	t.mu.Lock()
+	req, ok := t.pending[id]
+	delete(t.pending, id)
+	t.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("no pending request for id %d", id)
+	}
+
+	message = withID(message, req.originalID)
+	if req.reply != nil {
+		req.reply <- message
+		return nil
+	}
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		return errors.Wrap(err, "marshal message")
+	}
+	req.session.push(data)
+
+	return nil
+}
+
+// Close implements transport.Transport.
+func (t *Transport) Close() error {
+	var err error
+	if t.server != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		err = t.server.Shutdown(ctx)
+	}
+
+	t.mu.RLock()
+	closeHandler := t.closeHandler
+	t.mu.RUnlock()
+
+	if closeHandler != nil {
+		closeHandler()
+	}
+
+	return err
+}
+
+// SetCloseHandler implements transport.Transport.
+func (t *Transport) SetCloseHandler(handler func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closeHandler = handler
+}
+
+// SetErrorHandler implements transport.Transport.
+func (t *Transport) SetErrorHandler(handler func(error)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.errorHandler = handler
+}
+
+// SetSessionCloseHandler sets a callback for sessions that ended: SSE streams that closed
+// and streamable sessions the client deleted.
+func (t *Transport) SetSessionCloseHandler(handler func(id string)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sessionCloseHandler = handler
+}
+
+// SetMessageHandler implements transport.Transport.
+func (t *Transport) SetMessageHandler(handler func(ctx context.Context, message *transport.BaseJsonRpcMessage)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.messageHandler = handler
+}
+
+// authorize checks the bearer token. Without a token only loopback clients are served: a web page the user opens
+// may post to the loopback server too, so requests from other origins or through rebound host names are rejected.
+func (t *Transport) authorize(next http.Handler) http.Handler {
+	if t.token == "" {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !isLoopbackHost(r.Host) {
+				http.Error(w, "host is not loopback", http.StatusForbidden)
+				return
+			}
+
+			if origin := r.Header.Get("Origin"); origin != "" {
+				u, err := url.Parse(origin)
+				if err != nil || !isLoopbackHost(u.Host) {
+					http.Error(w, "origin is not loopback", http.StatusForbidden)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	expected := []byte("Bearer " + t.token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, expected) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="telegram-mcp"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (t *Transport) handleStreamable(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		t.handlePost(w, r, nil)
+	case http.MethodGet:
+		if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+			http.Error(w, "expected Accept: text/event-stream", http.StatusNotAcceptable)
+			return
+		}
+
+		session, ok := t.streamableSession(r)
+		if !ok {
+			http.Error(w, "unknown session", http.StatusNotFound)
+			return
+		}
+
+		s := t.openStream(session)
+		defer t.closeStream(s, false)
+
+		t.serveStream(w, r, s, nil)
+	case http.MethodDelete:
+		session, ok := t.streamableSession(r)
+		if !ok || session == "" {
+			http.Error(w, "unknown session", http.StatusNotFound)
+			return
+		}
+
+		t.mu.Lock()
+		delete(t.sessions, session)
+		t.mu.Unlock()
+		t.sessionClosed(session)
+
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (t *Transport) handleSSE(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s := t.openStream("")
+	defer t.closeStream(s, true)
+
+	endpoint := fmt.Sprintf("%s?session_id=%s", EndpointMessage, s.id)
+	t.serveStream(w, r, s, &endpoint)
+}
+
+func (t *Transport) handleMessage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	t.mu.RLock()
+	s, ok := t.streams[r.URL.Query().Get("session_id")]
+	t.mu.RUnlock()
+
+	if !ok {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+
+	t.handlePost(w, r, s)
+}
+
+// handlePost dispatches one JSON-RPC message. Without a session the response is
+// written to the HTTP body, otherwise it is delivered over the session stream.
+func (t *Transport) handlePost(w http.ResponseWriter, r *http.Request, session *stream) {
+	// simple cross-site posts can't set application/json
+	if ct, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || ct != "application/json" {
+		http.Error(w, "expected Content-Type: application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, "read body", http.StatusBadRequest)
+		return
+	}
+
+	message, err := parseMessage(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t.mu.RLock()
+	handler := t.messageHandler
+	t.mu.RUnlock()
+
+	if handler == nil {
+		http.Error(w, "server is not ready", http.StatusServiceUnavailable)
+		return
+	}
+
+	var sessionID string
+	switch {
+	case session != nil:
+		sessionID = session.id
+	case message.Type == transport.BaseMessageTypeJSONRPCRequestType && message.JsonRpcRequest.Method == "initialize":
+		sessionID = newSessionID()
+		t.mu.Lock()
+		t.sessions[sessionID] = true
+		t.mu.Unlock()
+		w.Header().Set(HeaderSessionID, sessionID)
+	default:
+		var ok bool
+		if sessionID, ok = t.streamableSession(r); !ok {
+			http.Error(w, "unknown session", http.StatusNotFound)
+			return
+		}
+	}
+	ctx := WithSession(r.Context(), sessionID)
+
+	if message.Type != transport.BaseMessageTypeJSONRPCRequestType {
+		handler(ctx, message)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	req := &pendingRequest{
+		originalID: message.JsonRpcRequest.Id,
+		session:    session,
+	}
+	if session == nil {
+		req.reply = make(chan *transport.BaseJsonRpcMessage, 1)
+	}
+
+	id := transport.RequestId(t.nextID.Add(1))
+	message.JsonRpcRequest.Id = id
+
+	t.mu.Lock()
+	t.pending[id] = req
+	t.mu.Unlock()
+
+	// Handlers outlive the HTTP request in SSE mode, so they get a detached context.
+	handler(context.WithoutCancel(ctx), message)
+
+	if session != nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	select {
+	case rsp := <-req.reply:
+		data, err := json.Marshal(rsp)
+		if err != nil {
+			http.Error(w, "marshal response", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	case <-r.Context().Done():
+		t.mu.Lock()
+		delete(t.pending, id)
+		t.mu.Unlock()
+	}
+}
+
+func (t *Transport) serveStream(w http.ResponseWriter, r *http.Request, s *stream, endpoint *string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	if endpoint != nil {
+		_, _ = fmt.Fprintf(w, "event: endpoint\ndata: %s\n\n", *endpoint)
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case data := <-s.ch:
+			if _, err := fmt.Fprintf(w, "event: message\ndata: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// streamableSession returns the session of a streamable request, false when the client sent an unknown one.
+func (t *Transport) streamableSession(r *http.Request) (string, bool) {
+	id := r.Header.Get(HeaderSessionID)
+	if id == "" {
+		return "", true
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return id, t.sessions[id]
+}
+
+// openStream opens the event stream of the session, a new session when id is empty.
+func (t *Transport) openStream(id string) *stream {
+	if id == "" {
+		id = newSessionID()
+	}
+
+	s := &stream{
+		id: id,
+		ch: make(chan []byte, streamBuffer),
+	}
+
+	t.mu.Lock()
+	t.streams[s.id] = s
+	t.mu.Unlock()
+
+	return s
+}
+
+// closeStream drops the stream, ending its session when the stream is the session as in SSE.
+func (t *Transport) closeStream(s *stream, endSession bool) {
+	t.mu.Lock()
+	// a reconnected stream of the session may have replaced this one
+	if t.streams[s.id] == s {
+		delete(t.streams, s.id)
+	}
+	for id, req := range t.pending {
+		if req.session == s {
+			delete(t.pending, id)
+		}
+	}
+	t.mu.Unlock()
+
+	if endSession {
+		t.sessionClosed(s.id)
+	}
+}
+
+func (t *Transport) sessionClosed(id string) {
+	t.mu.RLock()
+	handler := t.sessionCloseHandler
+	t.mu.RUnlock()
+
+	if handler != nil {
+		handler(id)
+	}
+}
+
+func (t *Transport) sendTo(session string, message *transport.BaseJsonRpcMessage) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return errors.Wrap(err, "marshal message")
+	}
+
+	t.mu.RLock()
+	s, ok := t.streams[session]
+	t.mu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("session %s has no open event stream", session)
+	}
+	s.push(data)
+
+	return nil
+}
+
+func (t *Transport) broadcast(message *transport.BaseJsonRpcMessage) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return errors.Wrap(err, "marshal message")
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	for _, s := range t.streams {
+		s.push(data)
+	}
+
+	return nil
+}
+
+func (t *Transport) handleError(err error) {
+	t.mu.RLock()
+	handler := t.errorHandler
+	t.mu.RUnlock()
+
+	if handler != nil {
+		handler(err)
+		return
+	}
+
+	log.Err(err).Msg("MCP HTTP transport error")
+}
+
+func (s *stream) push(data []byte) {
+	select {
+	case s.ch <- data:
+	default:
+		log.Warn().Str("session", s.id).Msg("event stream is full, message dropped")
+	}
+}
+
+func parseMessage(body []byte) (*transport.BaseJsonRpcMessage, error) {
+	var request transport.BaseJSONRPCRequest
+	if err := json.Unmarshal(body, &request); err == nil {
+		return transport.NewBaseMessageRequest(&request), nil
+	}
+
+	var notification transport.BaseJSONRPCNotification
+	if err := json.Unmarshal(body, &notification); err == nil {
+		return transport.NewBaseMessageNotification(&notification), nil
+	}
+
+	var response transport.BaseJSONRPCResponse
+	if err := json.Unmarshal(body, &response); err == nil {
+		return transport.NewBaseMessageResponse(&response), nil
+	}
+
+	var errorResponse transport.BaseJSONRPCError
+	if err := json.Unmarshal(body, &errorResponse); err == nil {
+		return transport.NewBaseMessageError(&errorResponse), nil
+	}
+
+	return nil, errors.New("invalid JSON-RPC message")
+}
+
+// withID returns a copy of a response message carrying the client's original id.
+func withID(message *transport.BaseJsonRpcMessage, id transport.RequestId) *transport.BaseJsonRpcMessage {
+	switch message.Type {
+	case transport.BaseMessageTypeJSONRPCResponseType:
+		rsp := *message.JsonRpcResponse
+		rsp.Id = id
+		return transport.NewBaseMessageResponse(&rsp)
+	case transport.BaseMessageTypeJSONRPCErrorType:
+		rsp := *message.JsonRpcError
+		rsp.Id = id
+		return transport.NewBaseMessageError(&rsp)
+	default:
+		return message
+	}
+}
+
+// isLoopbackHost reports whether host with optional port is localhost or a loopback address.
+func isLoopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
+
+func newSessionID() string {
+	var buf [16]byte
+	_, _ = rand.Read(buf[:])
+
+	return hex.EncodeToString(buf[:])
+}
@@ -0,0 +1,299 @@
+package mcphttp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/metoro-io/mcp-golang/transport"
+)
+
+// newEchoServer serves the transport with a handler answering every request with its method.
+func newEchoServer(t *testing.T, token string) *httptest.Server {
+	t.Helper()
+
+	tr := New("", token)
+	tr.SetMessageHandler(func(ctx context.Context, m *transport.BaseJsonRpcMessage) {
+		if m.Type != transport.BaseMessageTypeJSONRPCRequestType {
+			return
+		}
+
+		result, _ := json.Marshal(map[string]string{"method": m.JsonRpcRequest.Method})
+		_ = tr.Send(ctx, transport.NewBaseMessageResponse(&transport.BaseJSONRPCResponse{
+			Id:      m.JsonRpcRequest.Id,
+			Jsonrpc: "2.0",
+			Result:  result,
+		}))
+	})
+
+	srv := httptest.NewServer(tr.Handler())
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func post(t *testing.T, url, auth, body string) (int, string) {
+	t.Helper()
+
+	code, data, err := send(url, auth, body, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return code, data
+}
+
+// send posts body as a json client does, header overrides or removes (empty value) request headers.
+func send(url, auth, body string, header map[string]string) (int, string, error) {
+	req, err := http.NewRequest(http.MethodPost, url+EndpointStreamable, strings.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	for k, v := range header {
+		if k == "Host" {
+			req.Host = v
+		} else if v == "" {
+			req.Header.Del(k)
+		} else {
+			req.Header.Set(k, v)
+		}
+	}
+
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer rsp.Body.Close()
+
+	data, err := io.ReadAll(rsp.Body)
+
+	return rsp.StatusCode, string(data), err
+}
+
+func TestTransportAuthorization(t *testing.T) {
+	const request = `{"jsonrpc":"2.0","id":7,"method":"ping"}`
+
+	tests := []struct {
+		name  string
+		token string
+		auth  string
+		code  int
+	}{
+		{"no token configured", "", "", http.StatusOK},
+		{"missing header", "secret", "", http.StatusUnauthorized},
+		{"wrong token", "secret", "Bearer other", http.StatusUnauthorized},
+		{"not bearer", "secret", "secret", http.StatusUnauthorized},
+		{"valid token", "secret", "Bearer secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newEchoServer(t, tt.token)
+
+			code, body := post(t, srv.URL, tt.auth, request)
+			if code != tt.code {
+				t.Fatalf("status = %d, want %d: %s", code, tt.code, body)
+			}
+			if code == http.StatusOK && body != `{"id":7,"jsonrpc":"2.0","result":{"method":"ping"}}` {
+				t.Fatalf("unexpected response %s", body)
+			}
+		})
+	}
+}
+
+func TestTransportRequests(t *testing.T) {
+	srv := newEchoServer(t, "")
+
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{"invalid json", `{`, http.StatusBadRequest},
+		{"notification", `{"jsonrpc":"2.0","method":"notifications/initialized"}`, http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, body := post(t, srv.URL, "", tt.body); code != tt.code {
+				t.Fatalf("status = %d, want %d: %s", code, tt.code, body)
+			}
+		})
+	}
+
+	// clients reusing request ids get their own answers
+	var wg sync.WaitGroup
+	for _, method := range []string{"tools/list", "prompts/list", "resources/list"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			code, body, err := send(srv.URL, "", `{"jsonrpc":"2.0","id":1,"method":"`+method+`"}`, nil)
+			if want := `{"id":1,"jsonrpc":"2.0","result":{"method":"` + method + `"}}`; err != nil || code != http.StatusOK || body != want {
+				t.Errorf("%s: %d %s %v, want %s", method, code, body, err, want)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestTransportLoopbackGuard(t *testing.T) {
+	const request = `{"jsonrpc":"2.0","id":7,"method":"ping"}`
+
+	tests := []struct {
+		name   string
+		token  string
+		header map[string]string
+		code   int
+	}{
+		{"loopback client", "", nil, http.StatusOK},
+		{"localhost origin", "", map[string]string{"Origin": "http://localhost:3000"}, http.StatusOK},
+		{"foreign origin", "", map[string]string{"Origin": "https://evil.example"}, http.StatusForbidden},
+		{"rebound host", "", map[string]string{"Host": "evil.example:8080"}, http.StatusForbidden},
+		{"form post", "", map[string]string{"Content-Type": "text/plain"}, http.StatusUnsupportedMediaType},
+		{"no content type", "", map[string]string{"Content-Type": ""}, http.StatusUnsupportedMediaType},
+		{"charset", "", map[string]string{"Content-Type": "application/json; charset=utf-8"}, http.StatusOK},
+		{"token allows any host", "secret", map[string]string{"Host": "mcp.example:8080"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newEchoServer(t, tt.token)
+
+			auth := ""
+			if tt.token != "" {
+				auth = "Bearer " + tt.token
+			}
+			code, body, err := send(srv.URL, auth, request, tt.header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if code != tt.code {
+				t.Fatalf("status = %d, want %d: %s", code, tt.code, body)
+			}
+		})
+	}
+}
+
+// openEvents opens the streamable event stream, with the session when it is set.
+func openEvents(t *testing.T, url, session string) *bufio.Reader {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url+EndpointStreamable, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if session != "" {
+		req.Header.Set(HeaderSessionID, session)
+	}
+
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = rsp.Body.Close() })
+	if rsp.StatusCode != http.StatusOK {
+		t.Fatalf("event stream status = %d", rsp.StatusCode)
+	}
+
+	return bufio.NewReader(rsp.Body)
+}
+
+// nextEvent returns data of the next event of the stream.
+func nextEvent(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			return strings.TrimSpace(data)
+		}
+	}
+}
+
+func TestTransportSessions(t *testing.T) {
+	tr := New("", "")
+	sessions := make(chan string, 1)
+	tr.SetMessageHandler(func(ctx context.Context, m *transport.BaseJsonRpcMessage) {
+		sessions <- SessionID(ctx)
+		_ = tr.Send(ctx, transport.NewBaseMessageResponse(&transport.BaseJSONRPCResponse{
+			Id:      m.JsonRpcRequest.Id,
+			Jsonrpc: "2.0",
+			Result:  json.RawMessage("{}"),
+		}))
+	})
+	closed := make(chan string, 1)
+	tr.SetSessionCloseHandler(func(id string) { closed <- id })
+	srv := httptest.NewServer(tr.Handler())
+	t.Cleanup(srv.Close)
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL+EndpointStreamable, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"initialize"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = rsp.Body.Close()
+	session := rsp.Header.Get(HeaderSessionID)
+	if session == "" || <-sessions != session {
+		t.Fatalf("initialize assigned no session: %q", session)
+	}
+
+	if code, body, err := send(srv.URL, "", `{"jsonrpc":"2.0","id":2,"method":"ping"}`, map[string]string{HeaderSessionID: session}); err != nil || code != http.StatusOK {
+		t.Fatalf("request of the session: %d %s %v", code, body, err)
+	}
+	if got := <-sessions; got != session {
+		t.Fatalf("handler saw session %q, want %q", got, session)
+	}
+	if code, _, _ := send(srv.URL, "", `{"jsonrpc":"2.0","id":3,"method":"ping"}`, map[string]string{HeaderSessionID: "unknown"}); code != http.StatusNotFound {
+		t.Fatalf("unknown session status = %d", code)
+	}
+
+	// a notification for the session skips other streams, a broadcast reaches all of them
+	own, other := openEvents(t, srv.URL, session), openEvents(t, srv.URL, "")
+	notification := func(method string) *transport.BaseJsonRpcMessage {
+		return transport.NewBaseMessageNotification(&transport.BaseJSONRPCNotification{Jsonrpc: "2.0", Method: method})
+	}
+	if err := tr.Send(WithSession(context.Background(), session), notification("targeted")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.Send(context.Background(), notification("broadcast")); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"targeted", "broadcast"} {
+		if got := nextEvent(t, own); !strings.Contains(got, want) {
+			t.Fatalf("session stream got %s, want %s", got, want)
+		}
+	}
+	if got := nextEvent(t, other); !strings.Contains(got, "broadcast") {
+		t.Fatalf("other stream got %s", got)
+	}
+
+	req, err = http.NewRequest(http.MethodDelete, srv.URL+EndpointStreamable, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(HeaderSessionID, session)
+	rsp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = rsp.Body.Close()
+	if rsp.StatusCode != http.StatusNoContent || <-closed != session {
+		t.Fatalf("delete status = %d", rsp.StatusCode)
+	}
+}
@@ -0,0 +1,233 @@
+// Package prompts loads MCP prompts that expand into instructions for the telegram tools.
+//
+// Built-in prompts are embedded from default.json; a user file in the same format
+// adds prompts and overrides built-in ones with the same name. Templates check
+// registered tools with the tool function, see ForTools.
+package prompts
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+
+	mcp "github.com/metoro-io/mcp-golang"
+	"github.com/pkg/errors"
+)
+
+//go:embed default.json
+var defaultPrompts []byte
+
+var argumentNameRe = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// File is the prompts file format.
+type File struct {
+	// SkipBuiltin drops built-in prompts so only prompts of the file are served.
+	SkipBuiltin bool     `json:"skip_builtin,omitempty"`
+	Prompts     []Prompt `json:"prompts"`
+}
+
+// Prompt is a text template expanded with argument values.
+type Prompt struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Arguments   []Argument `json:"arguments,omitempty"`
+	// Tools the prompt needs, it is not served when one of them is not registered.
+	Tools    []string `json:"tools,omitempty"`
+	Template string   `json:"template"`
+
+	tmpl *template.Template
+}
+
+type Argument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+	// Default is used when the argument is empty.
+	Default string `json:"default,omitempty"`
+}
+
+// Load returns built-in prompts merged with prompts of the file. Missing file yields built-in prompts.
+func Load(path string) ([]Prompt, error) {
+	var builtin File
+	if err := json.Unmarshal(defaultPrompts, &builtin); err != nil {
+		return nil, errors.Wrap(err, "parse built-in prompts")
+	}
+
+	var user File
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, errors.Wrapf(err, "read prompts(%s)", path)
+		}
+		if err == nil {
+			if err := json.Unmarshal(data, &user); err != nil {
+				return nil, errors.Wrapf(err, "parse prompts(%s)", path)
+			}
+		}
+	}
+
+	prompts := builtin.Prompts
+	if user.SkipBuiltin {
+		prompts = nil
+	}
+
+	for _, p := range user.Prompts {
+		i := indexOf(prompts, p.Name)
+		if i < 0 {
+			prompts = append(prompts, p)
+			continue
+		}
+
+		prompts[i] = p
+	}
+
+	for i := range prompts {
+		if err := prompts[i].compile(); err != nil {
+			return nil, errors.Wrapf(err, "prompt %q", prompts[i].Name)
+		}
+	}
+
+	return prompts, nil
+}
+
+func indexOf(prompts []Prompt, name string) int {
+	for i, p := range prompts {
+		if p.Name == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (p *Prompt) compile() error {
+	if p.Name == "" {
+		return errors.New("empty name")
+	}
+
+	seen := make(map[string]bool)
+	for _, a := range p.Arguments {
+		if !argumentNameRe.MatchString(a.Name) {
+			return errors.Errorf("invalid argument name %q: use lowercase letters, digits and '_'", a.Name)
+		}
+		if seen[a.Name] {
+			return errors.Errorf("duplicate argument %q", a.Name)
+		}
+		seen[a.Name] = true
+	}
+
+	tmpl, err := template.New(p.Name).Option("missingkey=zero").Funcs(toolFuncs(nil)).Parse(p.Template)
+	if err != nil {
+		return errors.Wrap(err, "parse template")
+	}
+	p.tmpl = tmpl
+
+	return nil
+}
+
+// ForTools returns prompts whose tools are all registered, with templates seeing registered tools.
+func ForTools(prompts []Prompt, registered func(name string) bool) ([]Prompt, error) {
+	available := make([]Prompt, 0, len(prompts))
+	for _, p := range prompts {
+		if !slices.ContainsFunc(p.Tools, func(name string) bool { return !registered(name) }) {
+			tmpl, err := p.tmpl.Clone()
+			if err != nil {
+				return nil, errors.Wrapf(err, "prompt %q", p.Name)
+			}
+
+			p.tmpl = tmpl.Funcs(toolFuncs(registered))
+			available = append(available, p)
+		}
+	}
+
+	return available, nil
+}
+
+// toolFuncs returns template functions, tool is false for every tool until ForTools binds registered.
+func toolFuncs(registered func(name string) bool) template.FuncMap {
+	return template.FuncMap{
+		"tool": func(name string) bool {
+			return registered != nil && registered(name)
+		},
+	}
+}
+
+// Render expands the template, values are keyed by argument name.
+func (p Prompt) Render(values map[string]string) (string, error) {
+	data := make(map[string]string, len(p.Arguments))
+	for _, a := range p.Arguments {
+		v := strings.TrimSpace(values[a.Name])
+		if v == "" {
+			v = a.Default
+		}
+		if v == "" && a.Required {
+			return "", errors.Errorf("argument %q is required", a.Name)
+		}
+
+		data[a.Name] = v
+	}
+
+	var b strings.Builder
+	if err := p.tmpl.Execute(&b, data); err != nil {
+		return "", errors.Wrap(err, "execute template")
+	}
+
+	return b.String(), nil
+}
+
+// Handler returns a prompt handler for mcp.Server.RegisterPrompt.
+// The library reads prompt arguments from fields of the handler argument struct, so the struct is built at runtime.
+func (p Prompt) Handler() any {
+	fields := make([]reflect.StructField, 0, len(p.Arguments))
+	for _, a := range p.Arguments {
+		// the library splits jsonschema tag on commas without unescaping
+		tag := "description=" + strings.ReplaceAll(a.Description, ",", ";")
+		if a.Required {
+			tag = "required," + tag
+		}
+
+		fields = append(fields, reflect.StructField{
+			Name: strings.ToUpper(a.Name[:1]) + a.Name[1:],
+			Type: reflect.TypeOf(""),
+			Tag:  reflect.StructTag(fmt.Sprintf("json:%s jsonschema:%s", strconv.Quote(a.Name), strconv.Quote(tag))),
+		})
+	}
+
+	argsType := reflect.StructOf(fields)
+	handlerType := reflect.FuncOf(
+		[]reflect.Type{argsType},
+		[]reflect.Type{reflect.TypeOf(&mcp.PromptResponse{}), reflect.TypeOf((*error)(nil)).Elem()},
+		false,
+	)
+
+	return reflect.MakeFunc(handlerType, func(in []reflect.Value) []reflect.Value {
+		values := make(map[string]string, len(p.Arguments))
+		for i, a := range p.Arguments {
+			values[a.Name] = in[0].Field(i).String()
+		}
+
+		rsp, err := p.response(values)
+		errValue := reflect.Zero(handlerType.Out(1))
+		if err != nil {
+			errValue = reflect.ValueOf(&err).Elem()
+		}
+
+		return []reflect.Value{reflect.ValueOf(rsp), errValue}
+	}).Interface()
+}
+
+func (p Prompt) response(values map[string]string) (*mcp.PromptResponse, error) {
+	text, err := p.Render(values)
+	if err != nil {
+		return nil, err
+	}
+
+	return mcp.NewPromptResponse(p.Description, mcp.NewPromptMessage(mcp.NewTextContent(text), mcp.RoleUser)), nil
+}
@@ -0,0 +1,92 @@
+package prompts
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var toolRe = regexp.MustCompile(`tg_[a-z_]+`)
+
+// registered returns a registry of the tools as the server would report them.
+func registered(tools ...string) func(string) bool {
+	return func(name string) bool { return slices.Contains(tools, name) }
+}
+
+func TestRenderBuiltin(t *testing.T) {
+	loaded, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		tools []string
+	}{
+		{"all tools", []string{"tg_me", "tg_dialogs", "tg_dialog", "tg_unread", "tg_search", "tg_send", "tg_send_message", "tg_read"}},
+		{"read only", []string{"tg_me", "tg_dialogs", "tg_dialog", "tg_unread", "tg_search"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			available, err := ForTools(loaded, registered(tt.tools...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(available) != len(loaded) {
+				t.Fatalf("%d of %d prompts available", len(available), len(loaded))
+			}
+
+			for _, p := range available {
+				values := make(map[string]string, len(p.Arguments))
+				for _, a := range p.Arguments {
+					values[a.Name] = "x"
+				}
+
+				text, err := p.Render(values)
+				if err != nil {
+					t.Fatalf("render %s: %v", p.Name, err)
+				}
+				for _, tool := range toolRe.FindAllString(text, -1) {
+					if !slices.Contains(tt.tools, tool) {
+						t.Fatalf("%s mentions unregistered %s: %s", p.Name, tool, text)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestForToolsSkipsMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prompts.json")
+	data := `{"skip_builtin": true, "prompts": [
+		{"name": "digest", "tools": ["tg_updates_since"], "template": "Call tg_updates_since."},
+		{"name": "reply", "arguments": [{"name": "dialog", "required": true}],
+		 "template": "Answer {{.dialog}}{{if tool \"tg_send\"}} with a draft{{end}}."}
+	]}`
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	available, err := ForTools(loaded, registered("tg_send"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(available) != 1 || available[0].Name != "reply" {
+		t.Fatalf("available prompts = %+v", available)
+	}
+
+	if text, err := available[0].Render(map[string]string{"dialog": "alice"}); err != nil || text != "Answer alice with a draft." {
+		t.Fatalf("render = %q, %v", text, err)
+	}
+	if _, err := available[0].Render(nil); err == nil || !strings.Contains(err.Error(), "required") {
+		t.Fatalf("render without required argument = %v", err)
+	}
+}
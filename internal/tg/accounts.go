@@ -0,0 +1,161 @@
+package tg
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+
+	mcp "github.com/metoro-io/mcp-golang"
+	"github.com/pkg/errors"
+)
+
+const DefaultAccount = "default"
+
+// AccountArgument selects the account profile of a tool call, embedded into tool arguments.
+// nolint:lll
+type AccountArgument struct {
+	Account string `json:"account,omitempty" jsonschema:"description=Account profile to use (see tg_me)\\, default account if empty"`
+}
+
+func (a AccountArgument) account() string {
+	return a.Account
+}
+
+type accountArguments interface {
+	account() string
+}
+
+// Accounts routes tool calls to clients of named account profiles.
+type Accounts struct {
+	clients map[string]*Client
+}
+
+func NewAccounts() *Accounts {
+	return &Accounts{clients: make(map[string]*Client)}
+}
+
+// Add registers client under the profile name.
+func (a *Accounts) Add(name string, c *Client) {
+	a.clients[name] = c
+}
+
+// Names returns sorted profile names.
+func (a *Accounts) Names() []string {
+	names := make([]string, 0, len(a.clients))
+	for name := range a.clients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Client returns client of the profile, empty name selects default account.
+func (a *Accounts) Client(name string) (*Client, error) {
+	if name == "" {
+		if c, ok := a.clients[DefaultAccount]; ok {
+			return c, nil
+		}
+
+		if len(a.clients) == 1 {
+			for _, c := range a.clients {
+				return c, nil
+			}
+		}
+
+		return nil, errors.Wrapf(ErrInvalidArgument, "account is required, available: %s", strings.Join(a.Names(), ", "))
+	}
+
+	c, ok := a.clients[name]
+	if !ok {
+		return nil, errors.Wrapf(ErrInvalidArgument, "unknown account %q, available: %s", name, strings.Join(a.Names(), ", "))
+	}
+
+	return c, nil
+}
+
+// OnUpdate sets a callback for updates of every account, it must be set before Run.
+func (a *Accounts) OnUpdate(f func(account string, u UpdateInfo)) {
+	for name, c := range a.clients {
+		c.OnUpdate(func(u UpdateInfo) { f(name, u) })
+	}
+}
+
+// Run keeps connections of all accounts open until ctx is cancelled.
+func (a *Accounts) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, c := range a.clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = c.Run(ctx)
+		}()
+	}
+
+	wg.Wait()
+}
+
+// Route adapts a Client tool method to dispatch by the account argument, errors are reported as ToolError.
+func Route[A accountArguments](a *Accounts, method func(*Client, A) (*mcp.ToolResponse, error)) func(A) (*mcp.ToolResponse, error) {
+	return func(args A) (*mcp.ToolResponse, error) {
+		c, err := a.Client(args.account())
+		if err != nil {
+			return nil, toolError(err)
+		}
+
+		rsp, err := method(c, args)
+		if err != nil {
+			return nil, toolError(err)
+		}
+
+		return rsp, nil
+	}
+}
+
+type MeArguments struct {
+	AccountArgument
+}
+
+type AccountInfo struct {
+	Account string `json:"account"`
+	*MeResponse
+	Error string `json:"error,omitempty"`
+}
+
+type AccountsResponse struct {
+	Accounts []AccountInfo `json:"accounts"`
+}
+
+// GetMe lists loaded accounts with their users, or a single one when account is set.
+func (a *Accounts) GetMe(args MeArguments) (*mcp.ToolResponse, error) {
+	names := a.Names()
+	if args.Account != "" {
+		if _, err := a.Client(args.Account); err != nil {
+			return nil, toolError(err)
+		}
+
+		names = []string{args.Account}
+	}
+
+	rsp := AccountsResponse{Accounts: make([]AccountInfo, 0, len(names))}
+	for _, name := range names {
+		info := AccountInfo{Account: name}
+
+		me, err := a.clients[name].Me()
+		if err != nil {
+			info.Error = err.Error()
+		}
+		info.MeResponse = me
+
+		rsp.Accounts = append(rsp.Accounts, info)
+	}
+
+	jsonData, err := json.Marshal(rsp)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal response")
+	}
+
+	return mcp.NewToolResponse(mcp.NewTextContent(string(jsonData))), nil
+}
@@ -0,0 +1,815 @@
+package tg
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	bolt "go.etcd.io/bbolt"
+	bolterrors "go.etcd.io/bbolt/errors"
+)
+
+const (
+	SourceTelegram = "telegram"
+	SourceLocal    = "local"
+
+	archiveOpenTimeout = time.Second
+)
+
+var (
+	bucketPeers    = []byte("peers")
+	bucketDialogs  = []byte("dialogs")
+	bucketMessages = []byte("messages")
+	// bucketSync holds syncState per dialog, tool calls leave gaps outside of it
+	bucketSync = []byte("sync")
+	// bucketMeta holds the salt shared by sealed values, so the key is derived once per open
+	bucketMeta = []byte("meta")
+
+	metaSalt = []byte("salt")
+)
+
+// SourceArgument selects whether a tool reads Telegram or the local archive, embedded into tool arguments.
+// nolint:lll
+type SourceArgument struct {
+	Source string `json:"source,omitempty" jsonschema:"enum=telegram,enum=local,description=Read from telegram (default) or from local archive filled by sync and earlier calls"`
+}
+
+func (a SourceArgument) local() (bool, error) {
+	switch a.Source {
+	case "", SourceTelegram:
+		return false, nil
+	case SourceLocal:
+		return true, nil
+	default:
+		return false, errors.Wrapf(ErrInvalidArgument, "unknown source %q", a.Source)
+	}
+}
+
+// archivedDialog is a dialog snapshot as of the last response listing it.
+type archivedDialog struct {
+	peerRecord
+	Folder         int  `json:"folder,omitempty"`
+	Pinned         bool `json:"pinned,omitempty"`
+	UnreadCount    int  `json:"unread_count,omitempty"`
+	UnreadMark     bool `json:"unread_mark,omitempty"`
+	MuteUntil      int  `json:"mute_until,omitempty"`
+	ReadInboxMaxID int  `json:"read_inbox_max_id,omitempty"`
+	TopID          int  `json:"top_id,omitempty"`
+	TopDate        int  `json:"top_date,omitempty"`
+}
+
+// archivedMessage is a message as tools return it, with fields needed to filter it locally.
+// Text is kept raw with entities and rendered on read, records without Raw hold text rendered when archived.
+type archivedMessage struct {
+	MessageInfo
+	Date     int              `json:"date"`
+	FromID   int64            `json:"from_id,omitempty"`
+	Raw      *string          `json:"raw,omitempty"`
+	Entities archivedEntities `json:"entities,omitempty"`
+}
+
+func (m archivedMessage) info(format string) MessageInfo {
+	info := m.MessageInfo
+	info.ts = m.Date
+	if m.Raw != nil {
+		info.Text = renderText(*m.Raw, m.Entities, format)
+	}
+
+	return info
+}
+
+// plainText returns the text as typed, escapes of markdown text are not typed by whoever searches.
+func (m archivedMessage) plainText() string {
+	if m.Raw != nil {
+		return *m.Raw
+	}
+
+	return markdownUnescaper.Replace(m.Text)
+}
+
+// archivedEntities keeps message entities in TL encoding, json can't restore their interface types.
+type archivedEntities []tg.MessageEntityClass
+
+func (e archivedEntities) MarshalJSON() ([]byte, error) {
+	var b bin.Buffer
+	b.PutVectorHeader(len(e))
+	for _, entity := range e {
+		if err := entity.Encode(&b); err != nil {
+			return nil, fmt.Errorf("encode entity: %w", err)
+		}
+	}
+
+	return json.Marshal(b.Raw())
+}
+
+func (e *archivedEntities) UnmarshalJSON(data []byte) error {
+	var raw []byte
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	b := bin.Buffer{Buf: raw}
+	n, err := b.VectorHeader()
+	if err != nil {
+		return fmt.Errorf("decode entities: %w", err)
+	}
+
+	*e = make(archivedEntities, 0, n)
+	for range n {
+		entity, err := tg.DecodeMessageEntity(&b)
+		if err != nil {
+			return fmt.Errorf("decode entity: %w", err)
+		}
+		*e = append(*e, entity)
+	}
+
+	return nil
+}
+
+// Archive is a local bbolt store of peers, dialogs and messages seen in API responses.
+type Archive struct {
+	db *bolt.DB
+	// sealer encrypts values with the session secret, nil keeps them plaintext
+	sealer *sealer
+
+	// textFormat renders archived message text on read, set by the client
+	textFormat string
+}
+
+// ArchivePath returns archive location for the session file.
+func ArchivePath(sessionPath string) string {
+	return strings.TrimSuffix(sessionPath, filepath.Ext(sessionPath)) + ".archive.db"
+}
+
+// OpenArchive opens or creates the archive, it fails when another process holds it.
+// Values are encrypted with the session secret when it is set.
+func OpenArchive(path string, secret []byte) (*Archive, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: archiveOpenTimeout})
+	if errors.Is(err, bolterrors.ErrTimeout) {
+		return nil, errors.Errorf("archive %s is used by another telegram-mcp process", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open archive: %w", err)
+	}
+
+	a := &Archive{db: db, sealer: newSealer(secret)}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketPeers, bucketDialogs, bucketMessages, bucketSync, bucketMeta} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+
+		if a.sealer == nil {
+			return nil
+		}
+
+		meta := tx.Bucket(bucketMeta)
+		salt := meta.Get(metaSalt)
+		if salt == nil {
+			salt = make([]byte, saltSize)
+			if _, err := rand.Read(salt); err != nil {
+				return fmt.Errorf("generate salt: %w", err)
+			}
+			if err := meta.Put(metaSalt, salt); err != nil {
+				return err
+			}
+		}
+		// seal reuses the cached salt
+		a.sealer.keyFor(salt)
+
+		return nil
+	}); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("init archive: %w", err)
+	}
+
+	return a, nil
+}
+
+func (a *Archive) Close() error {
+	return a.db.Close()
+}
+
+// middleware records responses into the archive after peers saw them, so peer records are up to date.
+func (a *Archive) middleware(peers *peerStore) telegram.Middleware {
+	return telegram.MiddlewareFunc(func(next tg.Invoker) telegram.InvokeFunc {
+		return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+			if err := next.Invoke(ctx, input, output); err != nil {
+				return err
+			}
+
+			if err := a.record(output, peers); err != nil {
+				log.Warn().Err(err).Str("method", methodName(input)).Msg("failed to archive response")
+			}
+
+			return nil
+		}
+	})
+}
+
+// record stores entities, dialogs and messages of a decoded response.
+func (a *Archive) record(output bin.Decoder, peers *peerStore) error {
+	var (
+		dialogs  []tg.DialogClass
+		messages tg.MessagesMessagesClass
+	)
+	switch v := output.(type) {
+	case *tg.MessagesMessagesBox:
+		if _, ok := v.Messages.(*tg.MessagesMessagesNotModified); ok {
+			return nil
+		}
+
+		messages = v.Messages
+	case *tg.MessagesDialogsBox:
+		d, ok := v.Dialogs.AsModified()
+		if !ok {
+			return nil
+		}
+
+		dialogs = d.GetDialogs()
+		messages = &tg.MessagesMessages{Messages: d.GetMessages(), Users: d.GetUsers(), Chats: d.GetChats()}
+	case *tg.MessagesPeerDialogs:
+		dialogs = v.Dialogs
+		messages = &tg.MessagesMessages{Messages: v.Messages, Users: v.Users, Chats: v.Chats}
+	default:
+		return nil
+	}
+
+	h, err := newHistory(messages)
+	if err != nil {
+		return err
+	}
+
+	return a.db.Update(func(tx *bolt.Tx) error {
+		if err := a.putPeers(tx, peers, h); err != nil {
+			return err
+		}
+
+		for _, raw := range h.Messages {
+			if m, ok := raw.(*tg.Message); ok {
+				if err := a.putMessage(tx, h, m); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, raw := range dialogs {
+			if d, ok := raw.(*tg.Dialog); ok {
+				if err := a.putDialog(tx, peers, h, d); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+func (a *Archive) putPeers(tx *bolt.Tx, peers *peerStore, h *history) error {
+	keys := make([]peerKey, 0, len(h.users)+len(h.chats)+len(h.channels))
+	for id := range h.users {
+		keys = append(keys, peerKey{peerKindUser, id})
+	}
+	for id := range h.chats {
+		keys = append(keys, peerKey{peerKindChat, id})
+	}
+	for id := range h.channels {
+		keys = append(keys, peerKey{peerKindChannel, id})
+	}
+
+	b := tx.Bucket(bucketPeers)
+	for _, key := range keys {
+		r, ok := peers.record(key)
+		if !ok {
+			continue
+		}
+
+		if err := a.putJSON(b, key.bytes(), r); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a *Archive) putMessage(tx *bolt.Tx, h *history, m *tg.Message) error {
+	key, ok := peerKeyOf(m.PeerID)
+	if !ok {
+		return nil
+	}
+
+	b, err := tx.Bucket(bucketMessages).CreateBucketIfNotExists(key.bytes())
+	if err != nil {
+		return fmt.Errorf("create messages bucket: %w", err)
+	}
+
+	info := h.messageInfo(m)
+	info.Text = ""
+
+	return a.putJSON(b, messageKey(m.ID), archivedMessage{
+		MessageInfo: info,
+		Date:        m.Date,
+		FromID:      senderID(m),
+		Raw:         &m.Message,
+		Entities:    m.Entities,
+	})
+}
+
+func (a *Archive) putDialog(tx *bolt.Tx, peers *peerStore, h *history, d *tg.Dialog) error {
+	key, ok := peerKeyOf(d.Peer)
+	if !ok {
+		return nil
+	}
+
+	r, ok := peers.record(key)
+	if !ok {
+		return nil
+	}
+
+	dialog := archivedDialog{
+		peerRecord:     r,
+		Folder:         d.FolderID,
+		Pinned:         d.Pinned,
+		UnreadCount:    d.UnreadCount,
+		UnreadMark:     d.UnreadMark,
+		MuteUntil:      d.NotifySettings.MuteUntil,
+		ReadInboxMaxID: d.ReadInboxMaxID,
+		TopID:          d.TopMessage,
+	}
+	for _, raw := range h.Messages {
+		m, ok := raw.(interface {
+			GetID() int
+			GetDate() int
+			GetPeerID() tg.PeerClass
+		})
+		if ok && m.GetID() == d.TopMessage && getPeerID(m.GetPeerID()) == key.id {
+			dialog.TopDate = m.GetDate()
+		}
+	}
+
+	return a.putJSON(tx.Bucket(bucketDialogs), key.bytes(), dialog)
+}
+
+func (a *Archive) putJSON(b *bolt.Bucket, key []byte, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+
+	if a.sealer != nil {
+		if data, err = a.sealer.seal(data); err != nil {
+			return err
+		}
+	}
+
+	return b.Put(key, data)
+}
+
+// getJSON decodes a value, plaintext values left from before encryption are accepted.
+func (a *Archive) getJSON(data []byte, v any) error {
+	if isEncryptedSession(data) {
+		if a.sealer == nil {
+			return errors.Wrap(ErrSessionInvalid, "archive is encrypted, session passphrase or key file is required")
+		}
+
+		plain, err := a.sealer.open(data)
+		if err != nil {
+			return err
+		}
+		data = plain
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// migrateArchive encrypts plaintext values of the archive, or decrypts sealed ones back when decrypt is set.
+func migrateArchive(path string, secret []byte, decrypt bool) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+
+	a, err := OpenArchive(path, secret)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = a.Close() }()
+
+	return a.db.Update(func(tx *bolt.Tx) error {
+		buckets := []*bolt.Bucket{tx.Bucket(bucketPeers), tx.Bucket(bucketDialogs), tx.Bucket(bucketSync)}
+		messages := tx.Bucket(bucketMessages)
+		if err := messages.ForEachBucket(func(name []byte) error {
+			buckets = append(buckets, messages.Bucket(name))
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		for _, b := range buckets {
+			// values are collected first, bolt does not allow puts while iterating
+			values := make(map[string][]byte)
+			if err := b.ForEach(func(k, v []byte) error {
+				if v != nil && isEncryptedSession(v) == decrypt {
+					values[string(k)] = bytes.Clone(v)
+				}
+
+				return nil
+			}); err != nil {
+				return err
+			}
+
+			for k, v := range values {
+				if decrypt {
+					v, err = a.sealer.open(v)
+				} else {
+					v, err = a.sealer.seal(v)
+				}
+				if err != nil {
+					return errors.Wrap(err, path)
+				}
+
+				if err := b.Put([]byte(k), v); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// dialogs returns archived dialogs, most recent first.
+func (a *Archive) dialogs() ([]archivedDialog, error) {
+	var dialogs []archivedDialog
+	err := a.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketDialogs).ForEach(func(_, v []byte) error {
+			var d archivedDialog
+			if err := a.getJSON(v, &d); err != nil {
+				return fmt.Errorf("parse dialog: %w", err)
+			}
+
+			dialogs = append(dialogs, d)
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(dialogs, func(i, j int) bool {
+		if dialogs[i].TopDate != dialogs[j].TopDate {
+			return dialogs[i].TopDate > dialogs[j].TopDate
+		}
+
+		return dialogs[i].ID < dialogs[j].ID
+	})
+
+	return dialogs, nil
+}
+
+// dialog returns archived dialog of the peer.
+func (a *Archive) dialog(key peerKey) (archivedDialog, bool, error) {
+	var (
+		d     archivedDialog
+		found bool
+	)
+	err := a.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucketDialogs).Get(key.bytes())
+		if v == nil {
+			return nil
+		}
+
+		found = true
+
+		return a.getJSON(v, &d)
+	})
+
+	return d, found, err
+}
+
+// lastMessage returns the newest archived message of the peer.
+func (a *Archive) lastMessage(key peerKey) (*archivedMessage, error) {
+	var m *archivedMessage
+	err := a.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketMessages).Bucket(key.bytes())
+		if b == nil {
+			return nil
+		}
+
+		_, v := b.Cursor().Last()
+		if v == nil {
+			return nil
+		}
+
+		m = &archivedMessage{}
+
+		return a.getJSON(v, m)
+	})
+
+	return m, err
+}
+
+// syncState is the range of message ids sync archived without gaps.
+type syncState struct {
+	Newest int `json:"newest"`
+	Oldest int `json:"oldest"`
+	// Complete is set when the range reaches the beginning of the history
+	Complete bool `json:"complete,omitempty"`
+}
+
+// syncState returns the synced range of the peer, zero before the first sync.
+func (a *Archive) syncState(key peerKey) (syncState, error) {
+	var s syncState
+	err := a.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucketSync).Get(key.bytes())
+		switch {
+		case v == nil:
+			return nil
+		case len(v) == 4:
+			// older archives kept only the newest id, the range below it is fetched again
+			s.Newest = int(binary.BigEndian.Uint32(v))
+			s.Oldest = s.Newest + 1
+
+			return nil
+		default:
+			return a.getJSON(v, &s)
+		}
+	})
+
+	return s, err
+}
+
+func (a *Archive) setSyncState(key peerKey, s syncState) error {
+	return a.db.Update(func(tx *bolt.Tx) error {
+		return a.putJSON(tx.Bucket(bucketSync), key.bytes(), s)
+	})
+}
+
+// history answers the query from archived messages of the peer, returning continuation offset like GetHistory.
+func (a *Archive) history(key peerKey, q historyQuery, readMaxID int) ([]MessageInfo, int, error) {
+	minID := max(q.MinID, readMaxID)
+
+	var (
+		messages []MessageInfo
+		offset   int
+	)
+	err := a.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketMessages).Bucket(key.bytes())
+		if b == nil {
+			return nil
+		}
+
+		c := b.Cursor()
+		next, k, v := c.Prev, []byte(nil), []byte(nil)
+		if q.Forward {
+			next = c.Next
+			k, v = c.Seek(messageKey(max(q.Offset, minID) + 1))
+		} else {
+			k, v = seekBefore(c, q.Offset, q.MaxID)
+		}
+
+		for ; k != nil; k, v = next() {
+			id := int(binary.BigEndian.Uint32(k))
+			if id <= minID || q.MaxID > 0 && id >= q.MaxID {
+				break
+			}
+
+			var m archivedMessage
+			if err := a.getJSON(v, &m); err != nil {
+				return fmt.Errorf("parse message %d: %w", id, err)
+			}
+
+			// dates grow with ids, so the first message out of range ends the scan in its direction
+			if q.minDate > 0 && m.Date < q.minDate {
+				if q.Forward {
+					continue
+				}
+				break
+			}
+			if q.maxDate > 0 && m.Date > q.maxDate {
+				if q.Forward {
+					break
+				}
+				continue
+			}
+
+			if q.OnlyUnread && m.Out {
+				continue
+			}
+
+			info := m.info(a.textFormat)
+			info.IsUnread = q.OnlyUnread
+			messages = append(messages, info)
+
+			if len(messages) == q.Limit {
+				offset = id
+				break
+			}
+		}
+
+		return nil
+	})
+
+	return messages, offset, err
+}
+
+// seekBefore positions the cursor at the newest message older than both non-zero bounds.
+func seekBefore(c *bolt.Cursor, offset, maxID int) ([]byte, []byte) {
+	bound := maxID
+	if offset > 0 && (bound == 0 || offset < bound) {
+		bound = offset
+	}
+
+	if bound == 0 {
+		return c.Last()
+	}
+
+	if k, _ := c.Seek(messageKey(bound)); k == nil {
+		return c.Last()
+	}
+
+	return c.Prev()
+}
+
+// localMatch filters archived messages during search.
+type localMatch struct {
+	query            string
+	fromID           int64
+	minDate, maxDate int
+	allowed          func(peerKey) bool
+}
+
+type archivedHit struct {
+	key peerKey
+	archivedMessage
+}
+
+// search scans archived messages of keys, or of all peers when keys is empty, newest first.
+func (a *Archive) search(keys []peerKey, match localMatch) ([]archivedHit, error) {
+	query := strings.ToLower(match.query)
+
+	var hits []archivedHit
+	err := a.db.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket(bucketMessages)
+		scan := func(key peerKey) error {
+			b := root.Bucket(key.bytes())
+			if b == nil || match.allowed != nil && !match.allowed(key) {
+				return nil
+			}
+
+			return b.ForEach(func(k, v []byte) error {
+				var m archivedMessage
+				if err := a.getJSON(v, &m); err != nil {
+					return fmt.Errorf("parse message %d: %w", binary.BigEndian.Uint32(k), err)
+				}
+
+				if match.minDate > 0 && m.Date < match.minDate || match.maxDate > 0 && m.Date > match.maxDate {
+					return nil
+				}
+				if match.fromID != 0 && m.FromID != match.fromID {
+					return nil
+				}
+				if query != "" && !strings.Contains(strings.ToLower(m.plainText()), query) {
+					return nil
+				}
+
+				hits = append(hits, archivedHit{key: key, archivedMessage: m})
+
+				return nil
+			})
+		}
+
+		if len(keys) > 0 {
+			for _, key := range keys {
+				if err := scan(key); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}
+
+		return root.ForEach(func(k, _ []byte) error {
+			key, ok := parsePeerKey(k)
+			if !ok {
+				return nil
+			}
+
+			return scan(key)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].Date != hits[j].Date {
+			return hits[i].Date > hits[j].Date
+		}
+
+		return hits[i].ID > hits[j].ID
+	})
+
+	return hits, nil
+}
+
+// messagePeers finds users and basic groups holding archived messages with the ids, which are unique per account.
+func (a *Archive) messagePeers(ids []int) (map[peerKey][]int, error) {
+	found := make(map[peerKey][]int)
+	err := a.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketMessages).ForEachBucket(func(name []byte) error {
+			key, ok := parsePeerKey(name)
+			if !ok || key.kind == peerKindChannel {
+				return nil
+			}
+
+			b := tx.Bucket(bucketMessages).Bucket(name)
+			for _, id := range ids {
+				if b.Get(messageKey(id)) != nil {
+					found[key] = append(found[key], id)
+				}
+			}
+
+			return nil
+		})
+	})
+
+	return found, err
+}
+
+// peer returns archived record of the peer.
+func (a *Archive) peer(key peerKey) (peerRecord, bool, error) {
+	var (
+		r     peerRecord
+		found bool
+	)
+	err := a.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bucketPeers).Get(key.bytes())
+		if v == nil {
+			return nil
+		}
+
+		found = true
+
+		return a.getJSON(v, &r)
+	})
+
+	return r, found, err
+}
+
+func messageKey(id int) []byte {
+	return binary.BigEndian.AppendUint32(nil, uint32(id))
+}
+
+func (k peerKey) bytes() []byte {
+	return []byte(fmt.Sprintf("%d:%d", k.kind, k.id))
+}
+
+func parsePeerKey(b []byte) (peerKey, bool) {
+	var k peerKey
+	if _, err := fmt.Sscanf(string(b), "%d:%d", &k.kind, &k.id); err != nil {
+		return peerKey{}, false
+	}
+
+	return k, true
+}
+
+func peerKeyOf(p tg.PeerClass) (peerKey, bool) {
+	switch v := p.(type) {
+	case *tg.PeerUser:
+		return peerKey{peerKindUser, v.UserID}, true
+	case *tg.PeerChat:
+		return peerKey{peerKindChat, v.ChatID}, true
+	case *tg.PeerChannel:
+		return peerKey{peerKindChannel, v.ChannelID}, true
+	default:
+		return peerKey{}, false
+	}
+}
+
+func inputPeerKey(p tg.InputPeerClass) (peerKey, bool) {
+	switch v := p.(type) {
+	case *tg.InputPeerUser:
+		return peerKey{peerKindUser, v.UserID}, true
+	case *tg.InputPeerChat:
+		return peerKey{peerKindChat, v.ChatID}, true
+	case *tg.InputPeerChannel:
+		return peerKey{peerKindChannel, v.ChannelID}, true
+	default:
+		return peerKey{}, false
+	}
+}
@@ -14,15 +14,28 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-func Auth(phone string, appID int64, appHash string, sessionPath string, password string, newSession bool) error {
+// Auth logs in interactively and stores the session in storage, plaintext file at sessionPath when nil.
+func Auth(
+	phone string,
+	appID int64,
+	appHash string,
+	sessionPath string,
+	password string,
+	newSession bool,
+	storage telegram.SessionStorage,
+) error {
 	if newSession {
-		_ = os.Remove(sessionPath)
+		if err := removeSession(sessionPath); err != nil {
+			return err
+		}
+	}
+
+	if storage == nil {
+		storage = &telegram.FileSessionStorage{Path: sessionPath}
 	}
 
 	client := telegram.NewClient(int(appID), appHash, telegram.Options{
-		SessionStorage: &telegram.FileSessionStorage{
-			Path: sessionPath,
-		},
+		SessionStorage: storage,
 	})
 
 	sessionDir := filepath.Dir(sessionPath)
@@ -66,3 +79,15 @@ func Auth(phone string, appID int64, appHash string, sessionPath string, passwor
 
 	return nil
 }
+
+// removeSession deletes the session with its peer cache, update state and archive,
+// the next login may be another account and must not see data of the previous one.
+func removeSession(sessionPath string) error {
+	for _, path := range []string{sessionPath, peersPath(sessionPath), updatesPath(sessionPath), ArchivePath(sessionPath)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove %s: %w", path, err)
+		}
+	}
+
+	return nil
+}
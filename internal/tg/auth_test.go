@@ -0,0 +1,37 @@
+package tg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRemoveSession(t *testing.T) {
+	dir := t.TempDir()
+	sessionPath := filepath.Join(dir, "session.json")
+	other := filepath.Join(dir, "work.json")
+
+	paths := []string{sessionPath, peersPath(sessionPath), updatesPath(sessionPath), ArchivePath(sessionPath), other}
+	for _, path := range paths {
+		if err := os.WriteFile(path, []byte("{}"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := removeSession(sessionPath); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths[:4] {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("%s is left after removing the session", path)
+		}
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Fatalf("session of another profile removed: %v", err)
+	}
+
+	// nothing to remove is fine
+	if err := removeSession(sessionPath); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,28 +1,338 @@
 package tg
 
-import "github.com/gotd/td/telegram"
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/updates"
+	"github.com/gotd/td/tg"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// callTimeout bounds a single tool call, including waiting for the connection.
+	callTimeout = time.Minute
+
+	minReconnectDelay = time.Second
+	maxReconnectDelay = time.Minute
+)
 
 type Client struct {
 	appID       int
 	appHash     string
 	sessionPath string
+	storage     telegram.SessionStorage
+	policy      *Policy
+	peers       *peerStore
+	limits      RateLimit
+	limiter     *rateLimiter
+	archive     *Archive
+
+	// updates is nil unless WithUpdates enabled the update stream
+	updates      *updateBuffer
+	updatesState *updatesState
+	onUpdate     func(UpdateInfo)
+
+	downloadDir     string
+	maxDownloadSize int64
+
+	// textFormat is one of TextFormats for message text in responses
+	textFormat string
+
+	// invoker replaces the MTProto connection when set, see WithInvoker.
+	invoker tg.Invoker
+
+	// mu guards api and ready, which are replaced on every (re)connect.
+	mu    sync.RWMutex
+	api   *tg.Client
+	ready chan struct{}
+	// connErr is the reason of the last connection failure.
+	connErr error
+}
+
+// Option configures optional Client behaviour.
+type Option func(*Client)
+
+// WithPolicy restricts dialogs and actions available to tools.
+func WithPolicy(p *Policy) Option {
+	return func(c *Client) {
+		c.policy = p
+	}
 }
 
-func New(appID int, appHash, sessionPath string) *Client {
-	return &Client{
+// WithSessionStorage replaces plaintext session file, see NewSessionStorage.
+func WithSessionStorage(s telegram.SessionStorage) Option {
+	return func(c *Client) {
+		c.storage = s
+	}
+}
+
+// WithRateLimit replaces default API rate limits and flood wait handling.
+func WithRateLimit(l RateLimit) Option {
+	return func(c *Client) {
+		c.limits = l
+	}
+}
+
+// WithArchive records responses into the archive and enables source=local reads from it.
+func WithArchive(a *Archive) Option {
+	return func(c *Client) {
+		c.archive = a
+	}
+}
+
+// WithUpdates receives updates from Telegram, keeping the last size of them for GetUpdates.
+func WithUpdates(size int) Option {
+	return func(c *Client) {
+		c.updates = newUpdateBuffer(size)
+	}
+}
+
+// WithDownloads enables media downloads into dir, limited to maxSize bytes per file.
+func WithDownloads(dir string, maxSize int64) Option {
+	return func(c *Client) {
+		c.downloadDir = dir
+		c.maxDownloadSize = maxSize
+	}
+}
+
+// WithTextFormat renders message entities in format, one of TextFormats.
+func WithTextFormat(format string) Option {
+	return func(c *Client) {
+		c.textFormat = format
+	}
+}
+
+// WithInvoker serves API calls with inv instead of connecting to Telegram, e.g. with a fake in tests.
+// Calls pass the same middlewares as over a connection; updates are not received.
+func WithInvoker(inv tg.Invoker) Option {
+	return func(c *Client) {
+		c.invoker = inv
+	}
+}
+
+func New(appID int, appHash, sessionPath string, opts ...Option) *Client {
+	c := &Client{
 		appID:       appID,
 		appHash:     appHash,
 		sessionPath: sessionPath,
+		limits:      RateLimit{Rate: DefaultRate, MaxFloodWait: DefaultMaxFloodWait},
+		textFormat:  DefaultTextFormat,
+		ready:       make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.storage == nil {
+		c.storage = &telegram.FileSessionStorage{Path: sessionPath}
+	}
+	// side files hold access hashes, so they are encrypted like the session
+	sealer := sealerOf(c.storage)
+	c.peers = newPeerStore(peersPath(sessionPath), sealer)
+	c.limiter = newRateLimiter(c.limits)
+	if c.archive != nil {
+		c.archive.textFormat = c.textFormat
+	}
+
+	if c.updates != nil {
+		state, err := newUpdatesState(updatesPath(sessionPath), sealer)
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to load updates state, fetching it from telegram")
+			state = &updatesState{path: updatesPath(sessionPath), sealer: sealer, users: make(map[int64]*userUpdatesState)}
+		}
+		c.updatesState = state
 	}
+
+	return c
 }
 
 func (c *Client) T() *telegram.Client {
+	client, _ := c.newTelegram()
+
+	return client
+}
+
+// newTelegram returns a client with the updates manager handling its updates, the manager is nil when updates are disabled.
+func (c *Client) newTelegram() (*telegram.Client, *updates.Manager) {
 	opts := telegram.Options{
-		SessionStorage: &telegram.FileSessionStorage{
-			Path: c.sessionPath,
-		},
-		NoUpdates: true,
+		SessionStorage: c.storage,
+		NoUpdates:      true,
+		Middlewares:    c.middlewares(),
+	}
+
+	manager := c.updatesManager()
+	if manager != nil {
+		opts.NoUpdates = false
+		opts.UpdateHandler = manager
 	}
+
 	opts, _ = telegram.OptionsFromEnvironment(opts)
-	return telegram.NewClient(c.appID, c.appHash, opts)
+
+	return telegram.NewClient(c.appID, c.appHash, opts), manager
+}
+
+// middlewares returns middlewares of API calls, the first one is the outermost.
+func (c *Client) middlewares() []telegram.Middleware {
+	if c.archive != nil {
+		// inner middlewares see the response first, so the archive goes before peers
+		return []telegram.Middleware{c.limiter, c.archive.middleware(c.peers), c.peers}
+	}
+
+	return []telegram.Middleware{c.limiter, c.peers}
+}
+
+// Run keeps a single MTProto connection open until ctx is cancelled.
+// Tool handlers share this connection; if it drops, a new one is started with backoff.
+func (c *Client) Run(ctx context.Context) error {
+	delay := minReconnectDelay
+	for {
+		started := time.Now()
+		err := c.runOnce(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if time.Since(started) > maxReconnectDelay {
+			delay = minReconnectDelay
+		}
+
+		c.setConnErr(err)
+		log.Warn().Err(err).Dur("retry_in", delay).Msg("telegram connection lost")
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
+
+func (c *Client) runOnce(ctx context.Context) error {
+	if c.invoker != nil {
+		return c.runInvoker(ctx)
+	}
+
+	client, manager := c.newTelegram()
+	defer c.setAPI(nil)
+
+	return client.Run(ctx, func(ctx context.Context) error {
+		status, err := client.Auth().Status(ctx)
+		if err != nil {
+			return errors.Wrap(err, "auth status")
+		}
+		if !status.Authorized {
+			return errors.Wrap(ErrSessionInvalid, "not authorized, run auth command")
+		}
+
+		c.setAPI(client.API())
+		log.Info().Msg("telegram connection ready")
+
+		if manager != nil {
+			// the state is saved with a delay, the last changes are written on stop
+			defer func() {
+				if err := c.updatesState.flush(); err != nil {
+					log.Warn().Err(err).Msg("failed to save updates state")
+				}
+			}()
+
+			return manager.Run(ctx, client.API(), status.User.ID, updates.AuthOptions{})
+		}
+
+		<-ctx.Done()
+
+		return nil
+	})
+}
+
+// runInvoker serves calls with the injected invoker until ctx is cancelled.
+func (c *Client) runInvoker(ctx context.Context) error {
+	defer c.setAPI(nil)
+
+	var invoker tg.Invoker = c.invoker
+	middlewares := c.middlewares()
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		invoker = middlewares[i].Handle(invoker)
+	}
+
+	api := tg.NewClient(invoker)
+	if _, err := getSelf(ctx, api); err != nil {
+		return errors.Wrap(err, "auth status")
+	}
+
+	c.setAPI(api)
+	<-ctx.Done()
+
+	return nil
+}
+
+func (c *Client) setAPI(api *tg.Client) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.api = api
+	if api != nil {
+		c.connErr = nil
+		close(c.ready)
+		return
+	}
+
+	select {
+	case <-c.ready:
+		c.ready = make(chan struct{})
+	default:
+	}
+}
+
+func (c *Client) setConnErr(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.connErr = err
+}
+
+// waitAPI blocks until the shared connection is ready or ctx is done.
+func (c *Client) waitAPI(ctx context.Context) (*tg.Client, error) {
+	for {
+		c.mu.RLock()
+		api, ready, connErr := c.api, c.ready, c.connErr
+		c.mu.RUnlock()
+
+		if api != nil {
+			return api, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if connErr != nil {
+				return nil, fmt.Errorf("%w: %w", ErrUnavailable, connErr)
+			}
+
+			return nil, fmt.Errorf("%w: connection is not ready: %w", ErrUnavailable, ctx.Err())
+		case <-ready:
+		}
+	}
+}
+
+// run executes f against the shared connection.
+// The API client is safe for concurrent use, so handlers do not serialize.
+func (c *Client) run(f func(ctx context.Context, api *tg.Client) error) error {
+	return c.runTimeout(callTimeout, f)
+}
+
+func (c *Client) runTimeout(timeout time.Duration, f func(ctx context.Context, api *tg.Client) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	api, err := c.waitAPI(ctx)
+	if err != nil {
+		return err
+	}
+
+	return f(ctx, api)
 }
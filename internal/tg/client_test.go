@@ -0,0 +1,120 @@
+package tg
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/gotd/td/tg"
+	mcp "github.com/metoro-io/mcp-golang"
+	"github.com/pkg/errors"
+
+	"github.com/chaindead/telegram-mcp/internal/tgtest"
+)
+
+// fixture is the fake account shared by tool tests.
+type fixture struct {
+	*tgtest.Fake
+
+	alice, bob, team, news *tgtest.Dialog
+}
+
+// Peers of the fixture, see newFixture.
+const (
+	aliceID    = 10
+	bobID      = 11
+	teamID     = 20
+	newsID     = 30
+	newsAccess = 3030
+)
+
+// newFixture returns an account with two private dialogs, a group and a channel:
+// bob wrote last, alice has two unread messages.
+func newFixture() *fixture {
+	f := &fixture{Fake: tgtest.New()}
+
+	f.alice = f.AddUser(&tg.User{ID: aliceID, AccessHash: 1010, FirstName: "Alice", LastName: "Smith", Username: "alice", Phone: "15550001010"})
+	f.bob = f.AddUser(&tg.User{ID: bobID, AccessHash: 1111, FirstName: "Bob"})
+	f.team = f.AddChat(&tg.Chat{ID: teamID, Title: "Team Chat", ParticipantsCount: 3})
+	f.news = f.AddChannel(&tg.Channel{ID: newsID, AccessHash: newsAccess, Title: "Daily News", Username: "daily_news", Broadcast: true})
+
+	f.news.Message(0, 0, "morning edition")
+	f.alice.Message(tgtest.SelfID, 0, "are we meeting today?")
+	f.team.Message(aliceID, 0, "standup moved to 11")
+	f.team.Message(bobID, 0, "ok")
+	f.alice.Message(aliceID, 0, "yes, at noon")
+	f.alice.Message(aliceID, 0, "bring the report")
+	f.news.Message(0, 0, "evening edition")
+	f.bob.Message(bobID, 0, "hi there")
+	f.bob.ReadInboxMaxID = f.bob.Messages[0].ID
+
+	return f
+}
+
+// newTestClient runs a client against the fake until the test ends.
+func newTestClient(t *testing.T, f *tgtest.Fake, opts ...Option) *Client {
+	t.Helper()
+
+	opts = append([]Option{WithInvoker(f), WithRateLimit(RateLimit{})}, opts...)
+	c := New(0, "", filepath.Join(t.TempDir(), "session.json"), opts...)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = c.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	return c
+}
+
+// decode returns a function unmarshaling the text content of a tool response,
+// so a tool call can be passed as is: decode[T](t)(c.Tool(args)).
+func decode[T any](t *testing.T) func(*mcp.ToolResponse, error) T {
+	return func(rsp *mcp.ToolResponse, err error) T {
+		t.Helper()
+
+		var v T
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := json.Unmarshal([]byte(rsp.Content[0].TextContent.Text), &v); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+
+		return v
+	}
+}
+
+// requireCode checks that err classifies as code the way Route reports it.
+func requireCode(t *testing.T, err error, code ErrorCode) {
+	t.Helper()
+
+	if err == nil {
+		t.Fatalf("expected %s error, got nil", code)
+	}
+
+	var te *ToolError
+	if !errors.As(toolError(err), &te) || te.Code != code {
+		t.Fatalf("expected %s error, got %v", code, toolError(err))
+	}
+}
+
+func TestClientRunWithInvoker(t *testing.T) {
+	f := newFixture()
+	c := newTestClient(t, f.Fake)
+
+	me, err := c.Me()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if me.ID != tgtest.SelfID || me.Username != "test_user" {
+		t.Fatalf("unexpected self: %+v", me)
+	}
+}
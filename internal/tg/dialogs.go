@@ -25,19 +25,75 @@ const (
 	DialogTypeChannel DialogType = "channel"
 
 	DefaultDialogsLimit = 100
+
+	// ArchiveFolderID is the folder Telegram uses for archived dialogs
+	ArchiveFolderID = 1
+)
+
+const (
+	MutedOnly   = "muted"
+	UnmutedOnly = "unmuted"
 )
 
 // nolint:lll
 type DialogsArguments struct {
 	Offset     string `json:"offset,omitempty" jsonschema:"description=Offset for continuation"`
 	OnlyUnread bool   `json:"only_unread,omitempty" jsonschema:"description=Include only dialogs with unread mark"`
+	Type       string `json:"type,omitempty" jsonschema:"enum=user,enum=bot,enum=chat,enum=channel,description=Include only dialogs of this type"`
+	Query      string `json:"query,omitempty" jsonschema:"description=Include only dialogs whose title or name contains this text"`
+	OnlyPinned bool   `json:"only_pinned,omitempty" jsonschema:"description=Include only pinned dialogs"`
+	Muted      string `json:"muted,omitempty" jsonschema:"enum=muted,enum=unmuted,description=Include only muted or only unmuted dialogs"`
+	Archived   bool   `json:"archived,omitempty" jsonschema:"description=List archived dialogs (folder 1) instead of the main list"`
+	Limit      int    `json:"limit,omitempty" jsonschema:"description=Number of dialogs to scan per page (default and max 100)"`
+
+	SourceArgument
+	AccountArgument
+}
+
+// dialogsFilter holds client-side filters, applied after Telegram returned a page.
+type dialogsFilter struct {
+	onlyUnread bool
+	onlyPinned bool
+	dialogType DialogType
+	query      string
+	muted      string
+}
+
+func (a DialogsArguments) filter() (dialogsFilter, error) {
+	f := dialogsFilter{
+		onlyUnread: a.OnlyUnread,
+		onlyPinned: a.OnlyPinned,
+		dialogType: DialogType(a.Type),
+		query:      strings.ToLower(strings.TrimSpace(a.Query)),
+		muted:      a.Muted,
+	}
+
+	switch f.dialogType {
+	case DialogTypeAll, DialogTypeUser, DialogTypeBot, DialogTypeChat, DialogTypeChannel:
+	default:
+		return dialogsFilter{}, errors.Wrapf(ErrInvalidArgument, "unknown dialog type %q", a.Type)
+	}
+
+	switch f.muted {
+	case "", MutedOnly, UnmutedOnly:
+	default:
+		return dialogsFilter{}, errors.Wrapf(ErrInvalidArgument, "unknown muted filter %q", a.Muted)
+	}
+
+	return f, nil
 }
 
 type MessageInfo struct {
-	Who      string `json:"who,omitempty"`
-	When     string `json:"when"`
-	Text     string `json:"text,omitempty"`
-	IsUnread bool   `json:"is_unread,omitempty"`
+	ID       int          `json:"id"`
+	Who      string       `json:"who,omitempty"`
+	When     string       `json:"when"`
+	Text     string       `json:"text,omitempty"`
+	IsUnread bool         `json:"is_unread,omitempty"`
+	Out      bool         `json:"out,omitempty"`
+	Edited   string       `json:"edited,omitempty"`
+	ReplyTo  *ReplyInfo   `json:"reply_to,omitempty"`
+	Forward  *ForwardInfo `json:"forward,omitempty"`
+	Media    *MediaInfo   `json:"media,omitempty"`
 	ts       int
 }
 
@@ -56,25 +112,68 @@ type DialogsResponse struct {
 
 // GetDialogs returns a list of dialogs (chats, channels, groups)
 func (c *Client) GetDialogs(args DialogsArguments) (*mcp.ToolResponse, error) {
+	rsp, err := c.Dialogs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonData, err := json.Marshal(rsp)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal response")
+	}
+
+	return mcp.NewToolResponse(mcp.NewTextContent(string(jsonData))), nil
+}
+
+// Dialogs returns a page of dialogs, see GetDialogs.
+func (c *Client) Dialogs(args DialogsArguments) (*DialogsResponse, error) {
 	var offset DialogsOffset
 	if args.Offset != "" {
 		if err := offset.UnmarshalJSON([]byte(args.Offset)); err != nil {
-			return nil, errors.Wrap(err, "failed to unmarshal offset")
+			return nil, errors.Wrapf(ErrInvalidArgument, "invalid offset %q: %v", args.Offset, err)
 		}
 	}
 	if offset.Peer == nil {
 		offset.Peer = &tg.InputPeerEmpty{}
 	}
+	offset.Peer = c.peers.withAccessHash(offset.Peer)
+
+	filter, err := args.filter()
+	if err != nil {
+		return nil, err
+	}
+
+	limit := args.Limit
+	if limit <= 0 || limit > DefaultDialogsLimit {
+		limit = DefaultDialogsLimit
+	}
+
+	local, err := args.local()
+	if err != nil {
+		return nil, err
+	}
+	if local {
+		rsp, err := c.localDialogs(args, filter, offset, limit)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsp, nil
+	}
+
+	req := &tg.MessagesGetDialogsRequest{
+		OffsetPeer: offset.Peer,
+		OffsetID:   offset.MsgID,
+		OffsetDate: offset.Date,
+		Limit:      limit,
+	}
+	if args.Archived {
+		req.SetFolderID(ArchiveFolderID)
+	}
 
 	var dc tg.MessagesDialogsClass
-	client := c.T()
-	if err := client.Run(context.Background(), func(ctx context.Context) (err error) {
-		api := client.API()
-		dc, err = api.MessagesGetDialogs(ctx, &tg.MessagesGetDialogsRequest{
-			OffsetPeer: offset.Peer,
-			OffsetID:   offset.MsgID,
-			OffsetDate: offset.Date,
-		})
+	if err := c.run(func(ctx context.Context, api *tg.Client) (err error) {
+		dc, err = api.MessagesGetDialogs(ctx, req)
 		if err != nil {
 			return fmt.Errorf("failed to get dialogs: %w", err)
 		}
@@ -88,22 +187,16 @@ func (c *Client) GetDialogs(args DialogsArguments) (*mcp.ToolResponse, error) {
 		return nil, errors.Wrap(err, "failed to get dialogs")
 	}
 
-	d, err := newDialogs(dc, args.OnlyUnread)
+	d, err := newDialogs(dc, filter, c.policy)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to get dialogs")
 	}
+	d.textFormat = c.textFormat
 
-	rsp := DialogsResponse{
+	return &DialogsResponse{
 		Dialogs: d.Info(),
 		Offset:  d.Offset(),
-	}
-
-	jsonData, err := json.Marshal(rsp)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to marshal response")
-	}
-
-	return mcp.NewToolResponse(mcp.NewTextContent(string(jsonData))), nil
+	}, nil
 }
 
 type dialogs struct {
@@ -116,15 +209,20 @@ type dialogs struct {
 	chats    map[int64]*tg.Chat
 	channels map[int64]*tg.Channel
 
+	// complete is set when Telegram returned all dialogs at once
+	complete bool
+
 	//opts
-	onlyUnread bool
+	filter     dialogsFilter
+	policy     *Policy
+	textFormat string
 }
 
-func newDialogs(rawD tg.MessagesDialogsClass, onlyUnread bool) (*dialogs, error) {
+func newDialogs(rawD tg.MessagesDialogsClass, filter dialogsFilter, policy *Policy) (*dialogs, error) {
 	var d dialogs
 	switch dT := rawD.(type) {
 	case *tg.MessagesDialogs:
-		d = dialogs{MessagesDialogs: *dT}
+		d = dialogs{MessagesDialogs: *dT, complete: true}
 	case *tg.MessagesDialogsSlice:
 		d = dialogs{MessagesDialogs: tg.MessagesDialogs{
 			Dialogs:  dT.Dialogs,
@@ -171,7 +269,8 @@ func newDialogs(rawD tg.MessagesDialogsClass, onlyUnread bool) (*dialogs, error)
 		}
 	}
 
-	d.onlyUnread = onlyUnread
+	d.filter = filter
+	d.policy = policy
 
 	return &d, nil
 }
@@ -185,7 +284,12 @@ func (d *dialogs) Info() []DialogInfo {
 			continue
 		}
 
-		if d.onlyUnread && dialogItem.UnreadCount == 0 {
+		if !d.matches(dialogItem) {
+			continue
+		}
+
+		// Denied dialogs are hidden so the model never learns about them
+		if !d.policy.allows(d.subject(dialogItem)) {
 			continue
 		}
 
@@ -199,13 +303,48 @@ func (d *dialogs) Info() []DialogInfo {
 			continue
 		}
 
+		if q := d.filter.query; q != "" &&
+			!strings.Contains(strings.ToLower(info.Title), q) && !strings.Contains(strings.ToLower(info.Name), q) {
+			continue
+		}
+
 		ds = append(ds, info)
 	}
 
 	return ds
 }
 
+// matches applies filters that do not need dialog title.
+func (d *dialogs) matches(dialogItem *tg.Dialog) bool {
+	f := d.filter
+	if f.onlyUnread && dialogItem.UnreadCount == 0 && !dialogItem.UnreadMark {
+		return false
+	}
+
+	if f.onlyPinned && !dialogItem.Pinned {
+		return false
+	}
+
+	if f.dialogType != DialogTypeAll && d.getType(dialogItem) != f.dialogType {
+		return false
+	}
+
+	if f.muted != "" {
+		muted := dialogItem.NotifySettings.MuteUntil > int(time.Now().Unix())
+		if muted != (f.muted == MutedOnly) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Offset returns continuation after the last dialog of the raw page, so client-side filters never skip dialogs.
 func (d *dialogs) Offset() DialogsOffset {
+	if d.complete {
+		return DialogsOffset{}
+	}
+
 	for i := len(d.Dialogs) - 1; i >= 0; i-- {
 		dialogItem, ok := d.Dialogs[i].(*tg.Dialog)
 		if !ok {
@@ -243,20 +382,14 @@ func (d *dialogs) processDialog(dialogItem *tg.Dialog) (DialogInfo, error) {
 			who = name
 		}
 
-		// Limit message to 20 words
-		text := msg.Message
-		words := strings.Fields(text)
-		if len(words) > 20 {
-			text = strings.Join(words[:20], " ") + "..."
-		}
-
 		info.LastMessage = &MessageInfo{
 			Who:      who,
 			When:     time.Unix(int64(msg.Date), 0).Format(time.DateTime),
 			ts:       msg.Date,
-			Text:     text,
+			Text:     previewText(msg.Message, msg.Entities, d.textFormat),
 			IsUnread: dialogItem.UnreadCount > 0,
 		}
+		fillMessageMeta(info.LastMessage, msg, d.peerName)
 	}
 
 	if dialogItem.Peer == nil {
@@ -278,6 +411,63 @@ func (d *dialogs) processDialog(dialogItem *tg.Dialog) (DialogInfo, error) {
 	return info, nil
 }
 
+// shortText limits last message preview to 20 words.
+func shortText(text string) string {
+	words := strings.Fields(text)
+	if len(words) > 20 {
+		return strings.Join(words[:20], " ") + "..."
+	}
+
+	return text
+}
+
+// inputPeer builds input peer with access hash from entities of the response.
+func (d *dialogs) inputPeer(p tg.PeerClass) tg.InputPeerClass {
+	switch v := p.(type) {
+	case *tg.PeerUser:
+		if u, ok := d.users[v.UserID]; ok {
+			return u.AsInputPeer()
+		}
+	case *tg.PeerChannel:
+		if c, ok := d.channels[v.ChannelID]; ok {
+			return c.AsInputPeer()
+		}
+	}
+
+	return getInputPeerID(p)
+}
+
+func (d *dialogs) subject(dialogItem *tg.Dialog) peerSubject {
+	key, _ := peerKeyOf(dialogItem.Peer)
+	s := peerSubject{
+		Key:    key,
+		Type:   d.getType(dialogItem),
+		Folder: dialogItem.FolderID,
+	}
+
+	switch p := dialogItem.Peer.(type) {
+	case *tg.PeerUser:
+		if u, ok := d.users[p.UserID]; ok {
+			s.Username = u.Username
+		}
+	case *tg.PeerChannel:
+		if ch, ok := d.channels[p.ChannelID]; ok {
+			s.Username = ch.Username
+		}
+	}
+
+	return s
+}
+
+func (d *dialogs) peerName(p tg.PeerClass) string {
+	_, name, err := d.getNameID(p)
+	if err != nil {
+		return ""
+	}
+
+	return name
+}
+
 func (d *dialogs) getNameID(pC tg.PeerClass) (string, string, error) {
 	var name, username string
 	switch p := pC.(type) {
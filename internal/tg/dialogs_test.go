@@ -0,0 +1,160 @@
+package tg
+
+import (
+	"cmp"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// dialogsPage is DialogsResponse as agents see it, with the offset as an opaque string.
+type dialogsPage struct {
+	Dialogs []DialogInfo `json:"dialogs"`
+	Offset  string       `json:"offset"`
+}
+
+const endOffset = "end"
+
+func dialogNames(rsp dialogsPage) []string {
+	names := make([]string, 0, len(rsp.Dialogs))
+	for _, d := range rsp.Dialogs {
+		names = append(names, d.Name)
+	}
+
+	return names
+}
+
+func TestGetDialogs(t *testing.T) {
+	f := newFixture()
+	c := newTestClient(t, f.Fake)
+
+	rsp := decode[dialogsPage](t)(c.GetDialogs(DialogsArguments{}))
+
+	want := []string{"usr[11]", "daily_news", "alice", "cht[20]"}
+	if got := dialogNames(rsp); !slices.Equal(got, want) {
+		t.Fatalf("dialogs = %v, want %v", got, want)
+	}
+
+	alice := rsp.Dialogs[2]
+	if alice.Title != "Alice Smith" || alice.Type != string(DialogTypeUser) {
+		t.Fatalf("unexpected dialog: %+v", alice)
+	}
+	if alice.LastMessage == nil || alice.LastMessage.Text != "bring the report" || !alice.LastMessage.IsUnread {
+		t.Fatalf("unexpected last message: %+v", alice.LastMessage)
+	}
+	if rsp.Offset != endOffset {
+		t.Fatalf("complete list has offset %+v", rsp.Offset)
+	}
+}
+
+func TestGetDialogsPaging(t *testing.T) {
+	f := newFixture()
+	c := newTestClient(t, f.Fake)
+
+	var names []string
+	args := DialogsArguments{Limit: 3}
+	for range 3 {
+		rsp := decode[dialogsPage](t)(c.GetDialogs(args))
+		names = append(names, dialogNames(rsp)...)
+		if rsp.Offset == endOffset {
+			break
+		}
+
+		args.Offset = rsp.Offset
+	}
+
+	want := []string{"usr[11]", "daily_news", "alice", "cht[20]"}
+	if !slices.Equal(names, want) {
+		t.Fatalf("dialogs = %v, want %v", names, want)
+	}
+}
+
+func TestGetDialogsFilters(t *testing.T) {
+	f := newFixture()
+	f.team.Pinned = true
+	f.bob.Folder = ArchiveFolderID
+	c := newTestClient(t, f.Fake)
+
+	tests := []struct {
+		name string
+		args DialogsArguments
+		want []string
+	}{
+		{"unread", DialogsArguments{OnlyUnread: true}, []string{"cht[20]", "daily_news", "alice"}},
+		{"type", DialogsArguments{Type: string(DialogTypeChannel)}, []string{"daily_news"}},
+		{"query", DialogsArguments{Query: "news"}, []string{"daily_news"}},
+		{"pinned", DialogsArguments{OnlyPinned: true}, []string{"cht[20]"}},
+		{"archived", DialogsArguments{Archived: true}, []string{"usr[11]"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rsp := decode[dialogsPage](t)(c.GetDialogs(tt.args))
+			if got := dialogNames(rsp); !slices.Equal(got, tt.want) {
+				t.Fatalf("dialogs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetDialogsPolicy(t *testing.T) {
+	f := newFixture()
+	policy, err := LoadPolicy("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := policy.Merge(false, nil, []string{"type:channel", "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	c := newTestClient(t, f.Fake, WithPolicy(policy))
+
+	rsp := decode[dialogsPage](t)(c.GetDialogs(DialogsArguments{}))
+	if got, want := dialogNames(rsp), []string{"usr[11]", "cht[20]"}; !slices.Equal(got, want) {
+		t.Fatalf("dialogs = %v, want %v", got, want)
+	}
+
+	_, err = c.GetHistory(HistoryArguments{Name: "alice"})
+	requireCode(t, err, CodePolicyDenied)
+}
+
+func TestGetDialogsLocalPaging(t *testing.T) {
+	f := newFixture()
+	a, err := OpenArchive(filepath.Join(t.TempDir(), "session.archive.db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = a.Close() })
+	c := newTestClient(t, f.Fake, WithArchive(a))
+
+	want := []string{"usr[11]", "daily_news", "alice", "cht[20]"}
+	if got := dialogNames(decode[dialogsPage](t)(c.GetDialogs(DialogsArguments{}))); !slices.Equal(got, want) {
+		t.Fatalf("dialogs = %v, want %v", got, want)
+	}
+
+	var (
+		names []string
+		first string
+	)
+	args := DialogsArguments{Limit: 1, SourceArgument: SourceArgument{Source: SourceLocal}}
+	for range len(want) + 1 {
+		rsp := decode[dialogsPage](t)(c.GetDialogs(args))
+		names = append(names, dialogNames(rsp)...)
+		if rsp.Offset == endOffset {
+			break
+		}
+
+		first = cmp.Or(first, rsp.Offset)
+		args.Offset = rsp.Offset
+	}
+	if !slices.Equal(names, want) {
+		t.Fatalf("local dialogs = %v, want %v", names, want)
+	}
+
+	// the offset dialog is not needed to continue after it
+	parts := strings.Split(first, "-")
+	parts[1] = "999"
+	args.Offset, args.Limit = strings.Join(parts, "-"), 0
+	if got := dialogNames(decode[dialogsPage](t)(c.GetDialogs(args))); !slices.Equal(got, want[1:]) {
+		t.Fatalf("dialogs after unknown offset = %v, want %v", got, want[1:])
+	}
+}
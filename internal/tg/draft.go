@@ -13,6 +13,8 @@ import (
 type DraftArguments struct {
 	Name string `json:"name" jsonschema:"required,description=Name of the dialog"`
 	Text string `json:"text" jsonschema:"required,description=Plain text of the message"`
+
+	AccountArgument
 }
 
 type DraftResponse struct {
@@ -21,13 +23,10 @@ type DraftResponse struct {
 
 func (c *Client) SendDraft(args DraftArguments) (*mcp.ToolResponse, error) {
 	var ok bool
-	client := c.T()
-	if err := client.Run(context.Background(), func(ctx context.Context) (err error) {
-		api := client.API()
-
-		inputPeer, err := getInputPeerFromName(ctx, api, args.Name)
+	if err := c.run(func(ctx context.Context, api *tg.Client) (err error) {
+		inputPeer, err := c.resolvePeer(ctx, api, args.Name, accessWrite)
 		if err != nil {
-			return fmt.Errorf("get inputPeer from name: %w", err)
+			return err
 		}
 
 		ok, err = api.MessagesSaveDraft(ctx, &tg.MessagesSaveDraftRequest{
@@ -35,12 +34,12 @@ func (c *Client) SendDraft(args DraftArguments) (*mcp.ToolResponse, error) {
 			Message: args.Text,
 		})
 		if err != nil {
-			return fmt.Errorf("failed to get history: %w", err)
+			return fmt.Errorf("failed to save draft: %w", err)
 		}
 
 		return nil
 	}); err != nil {
-		return nil, errors.Wrap(err, "failed to get history")
+		return nil, errors.Wrap(err, "failed to save draft")
 	}
 
 	jsonData, err := json.Marshal(DraftResponse{Success: ok})
@@ -0,0 +1,35 @@
+package tg
+
+import "testing"
+
+func TestSendDraft(t *testing.T) {
+	f := newFixture()
+	c := newTestClient(t, f.Fake)
+
+	rsp := decode[DraftResponse](t)(c.SendDraft(DraftArguments{Name: "alice", Text: "see you at noon"}))
+	if !rsp.Success {
+		t.Fatal("draft not saved")
+	}
+	if f.alice.Draft != "see you at noon" {
+		t.Fatalf("draft = %q", f.alice.Draft)
+	}
+}
+
+func TestSendDraftReadOnly(t *testing.T) {
+	f := newFixture()
+	policy, err := LoadPolicy("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := policy.Merge(true, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	c := newTestClient(t, f.Fake, WithPolicy(policy))
+
+	_, err = c.SendDraft(DraftArguments{Name: "alice", Text: "hello"})
+	requireCode(t, err, CodePolicyDenied)
+
+	if f.alice.Draft != "" {
+		t.Fatalf("draft saved in read-only mode: %q", f.alice.Draft)
+	}
+}
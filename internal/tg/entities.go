@@ -0,0 +1,257 @@
+package tg
+
+import (
+	"html"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/gotd/td/tg"
+)
+
+// Text formats of message text in tool responses.
+const (
+	TextMarkdown = "markdown"
+	TextHTML     = "html"
+	TextPlain    = "plain"
+
+	DefaultTextFormat = TextMarkdown
+)
+
+// TextFormats lists formats accepted by WithTextFormat.
+var TextFormats = []string{TextMarkdown, TextHTML, TextPlain}
+
+// entitySpan is an entity with its position in UTF-16 code units and entities nested into it.
+type entitySpan struct {
+	start, end int
+	entity     tg.MessageEntityClass
+	children   []*entitySpan
+}
+
+// markdownEscaper escapes characters of inline markdown, so literal "*" or "_" in messages are not taken as markup.
+// Line starts like "# " or "- " are left as is.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`, "~", `\~`, "|", `\|`,
+)
+
+// markdownUnescaper reverts markdownEscaper.
+var markdownUnescaper = strings.NewReplacer(
+	`\\`, `\`, `\*`, "*", `\_`, "_", "\\`", "`", `\[`, "[", `\]`, "]", `\~`, "~", `\|`, "|",
+)
+
+// linkEscaper keeps urls inside markdown link parentheses.
+var linkEscaper = strings.NewReplacer("(", "%28", ")", "%29", " ", "%20")
+
+// renderText applies message entities to the text, e.g. hidden links become [text](url) in markdown.
+// Entities crossing each other can't be expressed by markup, the inner one is dropped.
+func renderText(text string, entities []tg.MessageEntityClass, format string) string {
+	switch {
+	case format == TextPlain:
+		return text
+	case len(entities) == 0 && format == TextHTML:
+		return html.EscapeString(text)
+	case len(entities) == 0:
+		return markdownEscaper.Replace(text)
+	}
+
+	units := utf16.Encode([]rune(text))
+	spans := make([]*entitySpan, 0, len(entities))
+	for _, e := range entities {
+		start := min(max(e.GetOffset(), 0), len(units))
+		end := min(start+max(e.GetLength(), 0), len(units))
+		if start < end {
+			spans = append(spans, &entitySpan{start: start, end: end, entity: e})
+		}
+	}
+	slices.SortStableFunc(spans, func(a, b *entitySpan) int {
+		if a.start != b.start {
+			return a.start - b.start
+		}
+
+		return b.end - a.end
+	})
+
+	root := &entitySpan{end: len(units)}
+	stack := []*entitySpan{root}
+	for _, s := range spans {
+		for len(stack) > 1 && stack[len(stack)-1].end <= s.start {
+			stack = stack[:len(stack)-1]
+		}
+
+		parent := stack[len(stack)-1]
+		if s.end > parent.end {
+			continue
+		}
+
+		parent.children = append(parent.children, s)
+		stack = append(stack, s)
+	}
+
+	r := textRenderer{units: units, html: format == TextHTML}
+
+	return r.render(root)
+}
+
+type textRenderer struct {
+	units []uint16
+	html  bool
+}
+
+func (r textRenderer) text(from, to int) string {
+	s := string(utf16.Decode(r.units[from:to]))
+	if r.html {
+		return html.EscapeString(s)
+	}
+
+	return markdownEscaper.Replace(s)
+}
+
+// code is text of code entities, markdown shows it verbatim.
+func (r textRenderer) code(from, to int) string {
+	s := string(utf16.Decode(r.units[from:to]))
+	if r.html {
+		return html.EscapeString(s)
+	}
+
+	return s
+}
+
+func (r textRenderer) render(s *entitySpan) string {
+	var b strings.Builder
+	pos := s.start
+	for _, child := range s.children {
+		b.WriteString(r.text(pos, child.start))
+		b.WriteString(r.render(child))
+		pos = child.end
+	}
+	b.WriteString(r.text(pos, s.end))
+
+	if s.entity == nil {
+		return b.String()
+	}
+
+	// code is shown verbatim, markup of nested entities would be taken literally
+	switch s.entity.(type) {
+	case *tg.MessageEntityCode, *tg.MessageEntityPre:
+		return r.wrap(s.entity, r.code(s.start, s.end))
+	}
+
+	return r.wrap(s.entity, b.String())
+}
+
+func (r textRenderer) wrap(e tg.MessageEntityClass, inner string) string {
+	if r.html {
+		return wrapHTML(e, inner)
+	}
+
+	return wrapMarkdown(e, inner)
+}
+
+func wrapMarkdown(e tg.MessageEntityClass, inner string) string {
+	switch v := e.(type) {
+	case *tg.MessageEntityBold:
+		return enclose(inner, "**", "**")
+	case *tg.MessageEntityItalic:
+		return enclose(inner, "_", "_")
+	case *tg.MessageEntityStrike:
+		return enclose(inner, "~~", "~~")
+	case *tg.MessageEntitySpoiler:
+		return enclose(inner, "||", "||")
+	case *tg.MessageEntityCode:
+		if strings.Contains(inner, "`") {
+			return enclose(inner, "`` ", " ``")
+		}
+
+		return enclose(inner, "`", "`")
+	case *tg.MessageEntityPre:
+		return "```" + v.Language + "\n" + strings.TrimSuffix(inner, "\n") + "\n```"
+	case *tg.MessageEntityTextURL:
+		return enclose(inner, "[", "]("+linkEscaper.Replace(v.URL)+")")
+	case *tg.MessageEntityMentionName:
+		return enclose(inner, "[", "]("+mentionURL(v.UserID)+")")
+	case *tg.MessageEntityBlockquote:
+		return "> " + strings.ReplaceAll(inner, "\n", "\n> ")
+	default:
+		return inner
+	}
+}
+
+func wrapHTML(e tg.MessageEntityClass, inner string) string {
+	switch v := e.(type) {
+	case *tg.MessageEntityBold:
+		return "<b>" + inner + "</b>"
+	case *tg.MessageEntityItalic:
+		return "<i>" + inner + "</i>"
+	case *tg.MessageEntityUnderline:
+		return "<u>" + inner + "</u>"
+	case *tg.MessageEntityStrike:
+		return "<s>" + inner + "</s>"
+	case *tg.MessageEntitySpoiler:
+		return `<span class="tg-spoiler">` + inner + "</span>"
+	case *tg.MessageEntityCode:
+		return "<code>" + inner + "</code>"
+	case *tg.MessageEntityPre:
+		if v.Language == "" {
+			return "<pre>" + inner + "</pre>"
+		}
+
+		return `<pre><code class="language-` + html.EscapeString(v.Language) + `">` + inner + "</code></pre>"
+	case *tg.MessageEntityTextURL:
+		return `<a href="` + html.EscapeString(v.URL) + `">` + inner + "</a>"
+	case *tg.MessageEntityMentionName:
+		return `<a href="` + mentionURL(v.UserID) + `">` + inner + "</a>"
+	case *tg.MessageEntityBlockquote:
+		return "<blockquote>" + inner + "</blockquote>"
+	default:
+		return inner
+	}
+}
+
+// enclose puts markers around inner text leaving surrounding spaces outside, "** bold**" is not bold in markdown.
+func enclose(inner, open, close string) string {
+	text := strings.TrimFunc(inner, unicode.IsSpace)
+	if text == "" {
+		return inner
+	}
+
+	i := strings.Index(inner, text)
+
+	return inner[:i] + open + text + close + inner[i+len(text):]
+}
+
+func mentionURL(userID int64) string {
+	return "tg://user?id=" + strconv.FormatInt(userID, 10)
+}
+
+// previewText is shortText keeping entities of the words left.
+func previewText(text string, entities []tg.MessageEntityClass, format string) string {
+	if format == TextPlain {
+		return shortText(text)
+	}
+	if len(entities) == 0 {
+		return renderText(shortText(text), nil, format)
+	}
+
+	// end of the 20th word, like shortText cuts
+	words, cut, inWord := 0, len(text), false
+	for i, r := range text {
+		if unicode.IsSpace(r) {
+			if inWord {
+				if words++; words == 20 {
+					cut = i
+					break
+				}
+			}
+			inWord = false
+		} else {
+			inWord = true
+		}
+	}
+	if cut == len(text) || strings.TrimFunc(text[cut:], unicode.IsSpace) == "" {
+		return renderText(text, entities, format)
+	}
+
+	return renderText(text[:cut], entities, format) + "..."
+}
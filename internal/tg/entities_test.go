@@ -0,0 +1,231 @@
+package tg
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gotd/td/tg"
+)
+
+func TestRenderText(t *testing.T) {
+	// offsets are in UTF-16 code units, the emoji takes two of them
+	const text = "😀 see docs and run make test, ask Bob"
+	entities := []tg.MessageEntityClass{
+		&tg.MessageEntityBold{Offset: 3, Length: 9},
+		&tg.MessageEntityTextURL{Offset: 7, Length: 4, URL: "https://example.com/?a=1&b=2"},
+		&tg.MessageEntityCode{Offset: 20, Length: 9},
+		&tg.MessageEntityMentionName{Offset: 35, Length: 3, UserID: 10},
+	}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{TextMarkdown, "😀 **see [docs](https://example.com/?a=1&b=2)** and run `make test`, ask [Bob](tg://user?id=10)"},
+		{TextHTML, `😀 <b>see <a href="https://example.com/?a=1&amp;b=2">docs</a> </b>and run <code>make test</code>, ask <a href="tg://user?id=10">Bob</a>`},
+		{TextPlain, text},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			if got := renderText(text, entities, tt.format); got != tt.want {
+				t.Fatalf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderTextBlocks(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		entities []tg.MessageEntityClass
+		format   string
+		want     string
+	}{
+		{
+			name:     "pre",
+			text:     "fix:\nx := 1 < 2\n",
+			entities: []tg.MessageEntityClass{&tg.MessageEntityPre{Offset: 5, Length: 11, Language: "go"}},
+			format:   TextMarkdown,
+			want:     "fix:\n```go\nx := 1 < 2\n```",
+		},
+		{
+			name:     "pre html",
+			text:     "x := 1 < 2",
+			entities: []tg.MessageEntityClass{&tg.MessageEntityPre{Offset: 0, Length: 10, Language: "go"}},
+			format:   TextHTML,
+			want:     `<pre><code class="language-go">x := 1 &lt; 2</code></pre>`,
+		},
+		{
+			name:     "blockquote",
+			text:     "first\nsecond",
+			entities: []tg.MessageEntityClass{&tg.MessageEntityBlockquote{Offset: 0, Length: 12}},
+			format:   TextMarkdown,
+			want:     "> first\n> second",
+		},
+		{
+			name: "spoiler and strike",
+			text: "the butler did it",
+			entities: []tg.MessageEntityClass{
+				&tg.MessageEntityStrike{Offset: 0, Length: 3},
+				&tg.MessageEntitySpoiler{Offset: 4, Length: 13},
+			},
+			format: TextMarkdown,
+			want:   "~~the~~ ||butler did it||",
+		},
+		{
+			name: "crossing entities",
+			text: "bold italic",
+			entities: []tg.MessageEntityClass{
+				&tg.MessageEntityBold{Offset: 0, Length: 4},
+				&tg.MessageEntityItalic{Offset: 2, Length: 9},
+			},
+			format: TextMarkdown,
+			want:   "**bold** italic",
+		},
+		{
+			name:     "out of range",
+			text:     "short",
+			entities: []tg.MessageEntityClass{&tg.MessageEntityBold{Offset: 2, Length: 50}},
+			format:   TextMarkdown,
+			want:     "sh**ort**",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderText(tt.text, tt.entities, tt.format); got != tt.want {
+				t.Fatalf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderTextEscaping(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		entities []tg.MessageEntityClass
+		format   string
+		want     string
+	}{
+		{
+			name:   "html without entities",
+			text:   "a < b & c",
+			format: TextHTML,
+			want:   "a &lt; b &amp; c",
+		},
+		{
+			name:   "markdown without entities",
+			text:   `2*3 = snake_case [x] \ ok`,
+			format: TextMarkdown,
+			want:   `2\*3 = snake\_case \[x\] \\ ok`,
+		},
+		{
+			name:     "markdown around entities",
+			text:     "a*b bold c_d",
+			entities: []tg.MessageEntityClass{&tg.MessageEntityBold{Offset: 4, Length: 4}},
+			format:   TextMarkdown,
+			want:     `a\*b **bold** c\_d`,
+		},
+		{
+			name:     "code verbatim",
+			text:     "run a_b*c",
+			entities: []tg.MessageEntityClass{&tg.MessageEntityCode{Offset: 4, Length: 5}},
+			format:   TextMarkdown,
+			want:     "run `a_b*c`",
+		},
+		{
+			name:     "url with parentheses",
+			text:     "wiki",
+			entities: []tg.MessageEntityClass{&tg.MessageEntityTextURL{Offset: 0, Length: 4, URL: "https://en.wikipedia.org/wiki/Go_(game)"}},
+			format:   TextMarkdown,
+			want:     "[wiki](https://en.wikipedia.org/wiki/Go_%28game%29)",
+		},
+		{
+			name:   "plain",
+			text:   "a < b_c",
+			format: TextPlain,
+			want:   "a < b_c",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderText(tt.text, tt.entities, tt.format); got != tt.want {
+				t.Fatalf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+
+	if got := markdownUnescaper.Replace(renderText(`a_b*c [d] \`, nil, TextMarkdown)); got != `a_b*c [d] \` {
+		t.Fatalf("unescaped %q", got)
+	}
+}
+
+func TestPreviewText(t *testing.T) {
+	words := strings.Repeat("word ", 25)
+	entities := []tg.MessageEntityClass{&tg.MessageEntityTextURL{Offset: 0, Length: 4, URL: "https://example.com"}}
+
+	got := previewText(words, entities, TextMarkdown)
+	if want := "[word](https://example.com)" + strings.Repeat(" word", 19) + "..."; got != want {
+		t.Fatalf("got  %q\nwant %q", got, want)
+	}
+
+	if got := previewText(words, entities, TextPlain); got != shortText(words) {
+		t.Fatalf("plain preview = %q", got)
+	}
+
+	if got := previewText("x < y", nil, TextHTML); got != "x &lt; y" {
+		t.Fatalf("html preview = %q", got)
+	}
+}
+
+func TestGetHistoryEntities(t *testing.T) {
+	f := newFixture()
+	m := f.alice.Message(aliceID, 0, "see docs")
+	m.SetEntities([]tg.MessageEntityClass{&tg.MessageEntityTextURL{Offset: 4, Length: 4, URL: "https://example.com"}})
+
+	tests := []struct {
+		opts []Option
+		want string
+	}{
+		{nil, "see [docs](https://example.com)"},
+		{[]Option{WithTextFormat(TextHTML)}, `see <a href="https://example.com">docs</a>`},
+		{[]Option{WithTextFormat(TextPlain)}, "see docs"},
+	}
+	// the archive keeps raw text, so it is rendered in the format of the reading client
+	a, err := OpenArchive(filepath.Join(t.TempDir(), "session.archive.db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = a.Close() })
+
+	local := SourceArgument{Source: SourceLocal}
+	for _, tt := range tests {
+		c := newTestClient(t, f.Fake, append(tt.opts, WithArchive(a))...)
+
+		rsp := decode[HistoryResponse](t)(c.GetHistory(HistoryArguments{Name: "alice", Limit: 1}))
+		if got := rsp.Messages[0].Text; got != tt.want {
+			t.Fatalf("history text = %q, want %q", got, tt.want)
+		}
+
+		for _, args := range []DialogsArguments{{}, {SourceArgument: local}} {
+			page := decode[dialogsPage](t)(c.GetDialogs(args))
+			for _, d := range page.Dialogs {
+				if d.Name == "alice" && (d.LastMessage == nil || d.LastMessage.Text != tt.want) {
+					t.Fatalf("dialog preview from %q = %+v, want %q", args.Source, d.LastMessage, tt.want)
+				}
+			}
+		}
+
+		rsp = decode[HistoryResponse](t)(c.GetHistory(HistoryArguments{Name: "alice", Limit: 1, SourceArgument: local}))
+		if got := rsp.Messages[0].Text; got != tt.want {
+			t.Fatalf("local history text = %q, want %q", got, tt.want)
+		}
+
+		found := decode[SearchResponse](t)(c.Search(SearchArguments{Query: "see docs", SourceArgument: local}))
+		if len(found.Messages) != 1 || found.Messages[0].Text != tt.want {
+			t.Fatalf("local search = %+v, want %q", found.Messages, tt.want)
+		}
+	}
+}
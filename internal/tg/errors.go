@@ -0,0 +1,176 @@
+package tg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gotd/td/tgerr"
+	"github.com/pkg/errors"
+)
+
+// Sentinel errors wrapped by tools to classify failures, see errorCode.
+var (
+	ErrPeerNotFound    = errors.New("peer not found")
+	ErrInvalidArgument = errors.New("invalid argument")
+	ErrSessionInvalid  = errors.New("session is invalid")
+	ErrUnavailable     = errors.New("telegram is unavailable")
+	ErrDisabled        = errors.New("disabled by server configuration")
+	ErrFileTooLarge    = errors.New("file is too large")
+)
+
+// ErrorCode is a stable failure class agents can branch on.
+type ErrorCode string
+
+const (
+	CodePeerNotFound     ErrorCode = "PEER_NOT_FOUND"
+	CodeAmbiguousPeer    ErrorCode = "AMBIGUOUS_PEER"
+	CodePermissionDenied ErrorCode = "PERMISSION_DENIED"
+	CodeFloodWait        ErrorCode = "FLOOD_WAIT"
+	CodeSessionInvalid   ErrorCode = "SESSION_INVALID"
+	CodePolicyDenied     ErrorCode = "POLICY_DENIED"
+	CodeInvalidArgument  ErrorCode = "INVALID_ARGUMENT"
+	CodeUnavailable      ErrorCode = "UNAVAILABLE"
+	CodeDisabled         ErrorCode = "DISABLED"
+	CodeFileTooLarge     ErrorCode = "FILE_TOO_LARGE"
+	CodeInternal         ErrorCode = "INTERNAL"
+)
+
+var errorHints = map[ErrorCode]string{
+	CodePeerNotFound:     "check the name with tg_dialogs: use username, title, phone, t.me link, me, cht[ID], chn[ID:HASH] or usr[ID]",
+	CodeAmbiguousPeer:    "repeat the call with the name of one of the candidates",
+	CodePermissionDenied: "the account has no rights for this action in the dialog, do not retry",
+	CodeFloodWait:        "telegram limited the account, wait retry_after seconds before calling again",
+	CodeSessionInvalid:   "the session is not authorized or can not be decrypted, the user has to run auth or fix the passphrase",
+	CodePolicyDenied:     "the dialog or action is blocked by the server policy, do not retry",
+	CodeInvalidArgument:  "fix the arguments and retry",
+	CodeUnavailable:      "telegram connection is not ready, retry later",
+	CodeDisabled:         "the feature is turned off in the server configuration, do not retry",
+	CodeFileTooLarge:     "the file exceeds the server download limit, do not retry",
+}
+
+// telegramCodes maps RPC error types to codes, other 400 errors are invalid arguments.
+var telegramCodes = map[string]ErrorCode{
+	"USERNAME_NOT_OCCUPIED": CodePeerNotFound,
+	"USERNAME_INVALID":      CodePeerNotFound,
+	"PHONE_NOT_OCCUPIED":    CodePeerNotFound,
+	"PEER_ID_INVALID":       CodePeerNotFound,
+	"CHANNEL_INVALID":       CodePeerNotFound,
+	"CHAT_ID_INVALID":       CodePeerNotFound,
+	"INVITE_HASH_EXPIRED":   CodePeerNotFound,
+	"INVITE_HASH_INVALID":   CodePeerNotFound,
+
+	"CHANNEL_PRIVATE":           CodePermissionDenied,
+	"CHAT_ADMIN_REQUIRED":       CodePermissionDenied,
+	"CHAT_WRITE_FORBIDDEN":      CodePermissionDenied,
+	"CHAT_RESTRICTED":           CodePermissionDenied,
+	"USER_BANNED_IN_CHANNEL":    CodePermissionDenied,
+	"USER_IS_BLOCKED":           CodePermissionDenied,
+	"YOU_BLOCKED_USER":          CodePermissionDenied,
+	"CHAT_SEND_PLAIN_FORBIDDEN": CodePermissionDenied,
+
+	"AUTH_KEY_UNREGISTERED": CodeSessionInvalid,
+	"AUTH_KEY_INVALID":      CodeSessionInvalid,
+	"SESSION_REVOKED":       CodeSessionInvalid,
+	"SESSION_EXPIRED":       CodeSessionInvalid,
+	"USER_DEACTIVATED":      CodeSessionInvalid,
+}
+
+// ToolError is a tool failure agents can act on; mcp-golang sends its text as isError result.
+type ToolError struct {
+	Code       ErrorCode       `json:"code"`
+	Message    string          `json:"message"`
+	Hint       string          `json:"hint,omitempty"`
+	RetryAfter int             `json:"retry_after,omitempty"`
+	Candidates []NameCandidate `json:"candidates,omitempty"`
+
+	err error
+}
+
+func (e *ToolError) Error() string {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Sprintf("%s: %s", e.Code, e.Message)
+	}
+
+	return string(data)
+}
+
+func (e *ToolError) Unwrap() error {
+	return e.err
+}
+
+// toolError classifies err for the MCP client, nil stays nil.
+func toolError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var te *ToolError
+	if errors.As(err, &te) {
+		return te
+	}
+
+	te = &ToolError{Code: errorCode(err), Message: err.Error(), err: err}
+	te.Hint = errorHints[te.Code]
+
+	var retry *RetryAfterError
+	if errors.As(err, &retry) {
+		te.RetryAfter = int(retry.After.Seconds())
+	}
+
+	var ambiguous *AmbiguousNameError
+	if errors.As(err, &ambiguous) {
+		te.Candidates = ambiguous.Candidates
+	}
+
+	return te
+}
+
+// errorCode prefers our own sentinels, then Telegram RPC types and status codes.
+func errorCode(err error) ErrorCode {
+	var (
+		retry     *RetryAfterError
+		ambiguous *AmbiguousNameError
+	)
+
+	switch {
+	case errors.As(err, &retry):
+		return CodeFloodWait
+	case errors.As(err, &ambiguous):
+		return CodeAmbiguousPeer
+	case errors.Is(err, ErrPolicyDenied):
+		return CodePolicyDenied
+	case errors.Is(err, ErrSessionInvalid):
+		return CodeSessionInvalid
+	case errors.Is(err, ErrPeerNotFound):
+		return CodePeerNotFound
+	case errors.Is(err, ErrInvalidArgument):
+		return CodeInvalidArgument
+	case errors.Is(err, ErrDisabled):
+		return CodeDisabled
+	case errors.Is(err, ErrFileTooLarge):
+		return CodeFileTooLarge
+	}
+
+	if rpcErr, ok := tgerr.As(err); ok {
+		if code, ok := telegramCodes[rpcErr.Type]; ok {
+			return code
+		}
+
+		switch rpcErr.Code {
+		case 400:
+			return CodeInvalidArgument
+		case 401:
+			return CodeSessionInvalid
+		case 403:
+			return CodePermissionDenied
+		}
+	}
+
+	if errors.Is(err, ErrUnavailable) || errors.Is(err, context.DeadlineExceeded) {
+		return CodeUnavailable
+	}
+
+	return CodeInternal
+}
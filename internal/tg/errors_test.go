@@ -0,0 +1,36 @@
+package tg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+func TestToolErrorFloodWait(t *testing.T) {
+	f := newFixture()
+	f.Handle(tg.MessagesGetDialogsRequestTypeID, func(context.Context, bin.Encoder) (bin.Encoder, error) {
+		return nil, tgerr.New(420, "FLOOD_WAIT_30")
+	})
+	c := newTestClient(t, f.Fake)
+
+	_, err := c.GetDialogs(DialogsArguments{})
+	requireCode(t, err, CodeFloodWait)
+
+	if te := toolError(err).(*ToolError); te.RetryAfter != 30 {
+		t.Fatalf("retry after = %d, want 30", te.RetryAfter)
+	}
+}
+
+func TestToolErrorTelegram(t *testing.T) {
+	f := newFixture()
+	f.Handle(tg.MessagesGetHistoryRequestTypeID, func(context.Context, bin.Encoder) (bin.Encoder, error) {
+		return nil, tgerr.New(403, "CHAT_ADMIN_REQUIRED")
+	})
+	c := newTestClient(t, f.Fake)
+
+	_, err := c.GetHistory(HistoryArguments{Name: "Team Chat"})
+	requireCode(t, err, CodePermissionDenied)
+}
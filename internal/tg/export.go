@@ -0,0 +1,459 @@
+package tg
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"github.com/gotd/td/tg"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	ExportJSON     = "json"
+	ExportJSONL    = "jsonl"
+	ExportMarkdown = "markdown"
+	// ExportDesktop is result.json in the layout of Telegram Desktop export
+	ExportDesktop = "desktop"
+
+	// ExportMediaDir is the directory of downloaded media inside the export directory
+	ExportMediaDir = "media"
+
+	exportCheckpointFile = ".export.json"
+	exportSpoolFile      = ".export.jsonl"
+)
+
+// ExportFormats lists formats accepted by Export.
+var ExportFormats = []string{ExportJSON, ExportJSONL, ExportMarkdown, ExportDesktop}
+
+// ExportOptions selects what Export writes and where.
+type ExportOptions struct {
+	// Dialog name as accepted by tools.
+	Dialog string
+	// Format is one of ExportFormats.
+	Format string
+	// Dir receives the export file, downloaded media and the checkpoint while exporting.
+	Dir string
+	// Since and Until bound message dates, see parseTime.
+	Since, Until string
+	// Media downloads photos and documents into Dir/media.
+	Media bool
+}
+
+// ExportResult describes finished export.
+type ExportResult struct {
+	Path     string
+	Messages int
+	Files    int
+	// Skipped lists messages whose media was not downloaded, see ExportMessage.FileSkipped.
+	Skipped []int
+	Resumed bool
+}
+
+// ExportDialog is the exported dialog.
+type ExportDialog struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	Title     string `json:"title"`
+	Type      string `json:"type"`
+	Megagroup bool   `json:"megagroup,omitempty"`
+	Public    bool   `json:"public,omitempty"`
+}
+
+// ExportMessage is MessageInfo with the sender resolved to a display name.
+type ExportMessage struct {
+	MessageInfo
+	Date     int    `json:"date"`
+	EditDate int    `json:"edit_date,omitempty"`
+	From     string `json:"from,omitempty"`
+	FromID   string `json:"from_id,omitempty"`
+	File     string `json:"file,omitempty"`
+	// FileSkipped tells why media of the message was not downloaded.
+	FileSkipped string `json:"file_skipped,omitempty"`
+}
+
+// Reasons of media skipped by export.
+const (
+	skipTooLarge    = "exceeds download limit"
+	skipUnavailable = "not available"
+)
+
+// exportCheckpoint is saved after every page, so an interrupted export continues where it stopped.
+type exportCheckpoint struct {
+	Options  ExportOptions `json:"options"`
+	Dialog   ExportDialog  `json:"dialog"`
+	LastID   int           `json:"last_id"`
+	Spool    int64         `json:"spool"`
+	Messages int           `json:"messages"`
+	Files    int           `json:"files"`
+	Skipped  []int         `json:"skipped,omitempty"`
+}
+
+// exportSender is the author of messages without from_id.
+type exportSender struct {
+	name string
+	id   string
+}
+
+// Export pages through the whole history of the dialog from the oldest message and writes it in the format.
+// It waits for the connection started by Run and stops when ctx is done, the next call with the same options resumes.
+func (c *Client) Export(ctx context.Context, opts ExportOptions) (ExportResult, error) {
+	var result ExportResult
+	if !slices.Contains(ExportFormats, opts.Format) {
+		return result, errors.Wrapf(ErrInvalidArgument, "unknown export format %q", opts.Format)
+	}
+
+	q, err := newHistoryQuery(HistoryArguments{
+		Name:    opts.Dialog,
+		Since:   opts.Since,
+		Until:   opts.Until,
+		Forward: true,
+		Limit:   MaxHistoryLimit,
+	})
+	if err != nil {
+		return result, err
+	}
+
+	if err := os.MkdirAll(opts.Dir, 0700); err != nil {
+		return result, fmt.Errorf("mkdir(%s): %w", opts.Dir, err)
+	}
+
+	cp, err := loadExportCheckpoint(opts.Dir)
+	if err != nil {
+		return result, err
+	}
+	if cp != nil && cp.Options != opts {
+		return result, errors.Errorf("%s has unfinished export of %q with other options, remove it or choose another directory",
+			opts.Dir, cp.Options.Dialog)
+	}
+	result.Resumed = cp != nil
+
+	waitCtx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+
+	api, err := c.waitAPI(waitCtx)
+	if err != nil {
+		return result, err
+	}
+
+	inputPeer, err := c.resolvePeer(ctx, api, opts.Dialog, accessRead)
+	if err != nil {
+		return result, err
+	}
+
+	if cp == nil {
+		dialog, err := exportDialog(ctx, api, inputPeer, c.policy)
+		if err != nil {
+			return result, err
+		}
+
+		cp = &exportCheckpoint{Options: opts, Dialog: dialog}
+	}
+
+	self, err := getSelf(ctx, api)
+	if err != nil {
+		return result, errors.Wrap(err, "failed to get self info")
+	}
+
+	spool, err := openSpool(filepath.Join(opts.Dir, exportSpoolFile), cp.Spool)
+	if err != nil {
+		return result, err
+	}
+	defer spool.Close()
+
+	e := exporter{
+		Client: c,
+		api:    api,
+		cp:     cp,
+		self:   exportSender{name: getTitle(self), id: peerID(&tg.PeerUser{UserID: self.ID})},
+	}
+	for {
+		q.Offset = cp.LastID
+		raw, err := api.MessagesGetHistory(ctx, q.request(inputPeer, 0))
+		if err != nil {
+			return result, fmt.Errorf("failed to get history: %w", err)
+		}
+
+		h, err := newHistory(raw)
+		if err != nil {
+			return result, errors.Wrap(err, "failed to process history")
+		}
+		h.textFormat = e.textFormat
+		if opts.Format == ExportDesktop {
+			// result.json keeps text plain, formatting belongs to text_entities
+			h.textFormat = TextPlain
+		}
+
+		infos, next := q.messages(h)
+		if err := e.page(ctx, spool, h, infos); err != nil {
+			return result, err
+		}
+
+		if next == 0 {
+			break
+		}
+		cp.LastID = next
+
+		if err := saveExportCheckpoint(opts.Dir, cp); err != nil {
+			return result, err
+		}
+		log.Info().Str("dialog", opts.Dialog).Int("messages", cp.Messages).Msg("export progress")
+	}
+
+	if err := spool.Close(); err != nil {
+		return result, fmt.Errorf("close spool: %w", err)
+	}
+
+	result.Path, err = renderExport(opts, cp.Dialog)
+	if err != nil {
+		return result, err
+	}
+	result.Messages, result.Files, result.Skipped = cp.Messages, cp.Files, cp.Skipped
+
+	if err := os.Remove(filepath.Join(opts.Dir, exportCheckpointFile)); err != nil && !os.IsNotExist(err) {
+		return result, fmt.Errorf("remove checkpoint: %w", err)
+	}
+
+	return result, nil
+}
+
+// exportDialog describes the dialog of inputPeer for the export header.
+func exportDialog(ctx context.Context, api *tg.Client, inputPeer tg.InputPeerClass, policy *Policy) (ExportDialog, error) {
+	pd, err := api.MessagesGetPeerDialogs(ctx, []tg.InputDialogPeerClass{&tg.InputDialogPeer{Peer: inputPeer}})
+	if err != nil {
+		return ExportDialog{}, fmt.Errorf("failed to get peer dialogs: %w", err)
+	}
+
+	d, err := newDialogs(&tg.MessagesDialogs{
+		Dialogs:  pd.Dialogs,
+		Messages: pd.Messages,
+		Chats:    pd.Chats,
+		Users:    pd.Users,
+	}, dialogsFilter{}, policy)
+	if err != nil {
+		return ExportDialog{}, errors.Wrap(err, "failed to get dialog")
+	}
+
+	infos := d.Info()
+	if len(infos) == 0 {
+		return ExportDialog{}, errors.Wrap(ErrPeerNotFound, "dialog not found")
+	}
+
+	dialog := ExportDialog{
+		ID:    getInputPeerIDValue(inputPeer),
+		Name:  infos[0].Name,
+		Title: infos[0].Title,
+		Type:  infos[0].Type,
+	}
+	if ch, ok := d.channels[dialog.ID]; ok {
+		dialog.Megagroup = ch.Megagroup
+		dialog.Public = ch.Username != ""
+	}
+
+	return dialog, nil
+}
+
+// exporter writes pages of history into the spool and counts them in the checkpoint.
+type exporter struct {
+	*Client
+	api  *tg.Client
+	cp   *exportCheckpoint
+	self exportSender
+}
+
+// page appends messages oldest first, infos are filtered messages of h in the order telegram returned them.
+func (e *exporter) page(ctx context.Context, spool *os.File, h *history, infos []MessageInfo) error {
+	raw := make(map[int]*tg.Message, len(h.Messages))
+	for _, msg := range h.Messages {
+		if m, ok := msg.(*tg.Message); ok {
+			raw[m.ID] = m
+		}
+	}
+
+	slices.SortFunc(infos, func(a, b MessageInfo) int { return a.ID - b.ID })
+
+	w := bufio.NewWriter(spool)
+	for _, info := range infos {
+		m := raw[info.ID]
+		msg := ExportMessage{MessageInfo: info, Date: m.Date, EditDate: m.EditDate}
+		msg.From, msg.FromID = e.sender(h, m)
+
+		if e.cp.Options.Media && info.Media != nil {
+			file, skipped, err := e.download(ctx, m)
+			if err != nil {
+				return err
+			}
+			if file != "" {
+				msg.File = file
+				e.cp.Files++
+			}
+			if skipped != "" {
+				msg.FileSkipped = skipped
+				e.cp.Skipped = append(e.cp.Skipped, m.ID)
+			}
+		}
+
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal message")
+		}
+		if _, err := w.Write(append(data, '\n')); err != nil {
+			return fmt.Errorf("write spool: %w", err)
+		}
+
+		e.cp.Messages++
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("write spool: %w", err)
+	}
+	if err := spool.Sync(); err != nil {
+		return fmt.Errorf("sync spool: %w", err)
+	}
+
+	stat, err := spool.Stat()
+	if err != nil {
+		return fmt.Errorf("stat spool: %w", err)
+	}
+	e.cp.Spool = stat.Size()
+
+	return nil
+}
+
+// sender resolves the author of m by the user and chat maps of the page:
+// outgoing messages are ours, incoming ones without from_id are written by the dialog itself.
+func (e *exporter) sender(h *history, m *tg.Message) (string, string) {
+	from, ok := m.GetFromID()
+	switch {
+	case ok:
+	case m.Out:
+		return e.self.name, e.self.id
+	default:
+		from = m.PeerID
+	}
+
+	var name string
+	switch p := from.(type) {
+	case *tg.PeerUser:
+		if u, ok := h.users[p.UserID]; ok {
+			name = getTitle(u)
+		}
+	case *tg.PeerChat:
+		if c, ok := h.chats[p.ChatID]; ok {
+			name = getTitle(c)
+		}
+	case *tg.PeerChannel:
+		if c, ok := h.channels[p.ChannelID]; ok {
+			name = getTitle(c)
+		}
+	}
+
+	return name, peerID(from)
+}
+
+// download saves photo or document of m into the media directory, returning its path relative to the export.
+// Media that is not available or exceeds the size limit is skipped with the reason, failed downloads stop the export
+// before the checkpoint, so they are retried on resume.
+func (e *exporter) download(ctx context.Context, m *tg.Message) (file, skipped string, err error) {
+	location, info, err := mediaFile(m.Media, m.ID)
+	if errors.Is(err, ErrInvalidArgument) {
+		// webpages, locations and the like have no file
+		return "", "", nil
+	}
+	if err != nil {
+		log.Warn().Err(err).Int("message", m.ID).Msg("media skipped")
+		return "", skipUnavailable, nil
+	}
+
+	if e.maxDownloadSize > 0 && info.Size > e.maxDownloadSize {
+		log.Warn().Int("message", m.ID).Int64("size", info.Size).Msg("media exceeds download limit, skipped")
+		return "", skipTooLarge, nil
+	}
+
+	rel := filepath.Join(ExportMediaDir, fmt.Sprintf("%d_%s", m.ID, safeFileName(info.FileName)))
+	path := filepath.Join(e.cp.Options.Dir, rel)
+	if _, err := os.Stat(path); err == nil {
+		return filepath.ToSlash(rel), "", nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", "", fmt.Errorf("mkdir(%s): %w", filepath.Dir(path), err)
+	}
+
+	if _, err := downloadFile(ctx, e.api, location, path, e.maxDownloadSize); err != nil {
+		if errors.Is(err, ErrFileTooLarge) {
+			log.Warn().Int("message", m.ID).Msg("media exceeds download limit, skipped")
+			return "", skipTooLarge, nil
+		}
+
+		return "", "", fmt.Errorf("download media of message %d: %w", m.ID, err)
+	}
+
+	return filepath.ToSlash(rel), "", nil
+}
+
+// peerID formats peer like Telegram Desktop export does, e.g. user123 or channel123.
+func peerID(p tg.PeerClass) string {
+	switch v := p.(type) {
+	case *tg.PeerUser:
+		return "user" + strconv.FormatInt(v.UserID, 10)
+	case *tg.PeerChat:
+		return "chat" + strconv.FormatInt(v.ChatID, 10)
+	case *tg.PeerChannel:
+		return "channel" + strconv.FormatInt(v.ChannelID, 10)
+	default:
+		return ""
+	}
+}
+
+// openSpool opens the spool for appending, dropping a page written after the last checkpoint.
+func openSpool(path string, size int64) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("open spool: %w", err)
+	}
+
+	if err := f.Truncate(size); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("truncate spool: %w", err)
+	}
+
+	if _, err := f.Seek(size, 0); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("seek spool: %w", err)
+	}
+
+	return f, nil
+}
+
+func loadExportCheckpoint(dir string) (*exportCheckpoint, error) {
+	data, err := os.ReadFile(filepath.Join(dir, exportCheckpointFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read checkpoint: %w", err)
+	}
+
+	var cp exportCheckpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("parse checkpoint: %w", err)
+	}
+
+	return &cp, nil
+}
+
+func saveExportCheckpoint(dir string, cp *exportCheckpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal checkpoint")
+	}
+
+	return writeFileAtomic(filepath.Join(dir, exportCheckpointFile), data)
+}
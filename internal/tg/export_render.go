@@ -0,0 +1,315 @@
+package tg
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// exportFiles are names of the export file by format.
+var exportFiles = map[string]string{
+	ExportJSON:     "messages.json",
+	ExportJSONL:    "messages.jsonl",
+	ExportMarkdown: "messages.md",
+	ExportDesktop:  "result.json",
+}
+
+// renderExport converts the spool into the export file of the format and removes it.
+func renderExport(opts ExportOptions, dialog ExportDialog) (string, error) {
+	spoolPath := filepath.Join(opts.Dir, exportSpoolFile)
+	path := filepath.Join(opts.Dir, exportFiles[opts.Format])
+
+	// the spool is already a JSONL export
+	if opts.Format == ExportJSONL {
+		if err := os.Rename(spoolPath, path); err != nil {
+			return "", fmt.Errorf("rename spool: %w", err)
+		}
+
+		return path, nil
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", fmt.Errorf("create %s: %w", tmp, err)
+	}
+	defer func() { _ = os.Remove(tmp) }()
+
+	w := bufio.NewWriter(f)
+	switch opts.Format {
+	case ExportJSON:
+		err = renderJSON(w, spoolPath, dialog)
+	case ExportMarkdown:
+		err = renderMarkdown(w, spoolPath, dialog)
+	case ExportDesktop:
+		err = renderDesktop(w, spoolPath, dialog)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "render %s", opts.Format)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return "", fmt.Errorf("rename %s: %w", tmp, err)
+	}
+
+	if err := os.Remove(spoolPath); err != nil {
+		return "", fmt.Errorf("remove spool: %w", err)
+	}
+
+	return path, nil
+}
+
+// readSpool calls f for every message of the spool, oldest first.
+func readSpool(path string, f func(ExportMessage) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open spool: %w", err)
+	}
+	defer file.Close()
+
+	dec := json.NewDecoder(file)
+	for {
+		var m ExportMessage
+		err := dec.Decode(&m)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read spool: %w", err)
+		}
+
+		if err := f(m); err != nil {
+			return err
+		}
+	}
+}
+
+// renderJSON writes {"dialog": ..., "messages": [...]} streaming messages from the spool.
+func renderJSON(w io.Writer, spoolPath string, dialog ExportDialog) error {
+	header, err := json.Marshal(dialog)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal dialog")
+	}
+
+	if _, err := fmt.Fprintf(w, "{\"dialog\":%s,\"messages\":[", header); err != nil {
+		return err
+	}
+
+	sep := "\n"
+	if err := readSpool(spoolPath, func(m ExportMessage) error {
+		data, err := json.Marshal(m)
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal message")
+		}
+
+		_, err = fmt.Fprintf(w, "%s%s", sep, data)
+		sep = ",\n"
+
+		return err
+	}); err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "\n]}\n")
+
+	return err
+}
+
+// renderMarkdown writes a transcript grouped by day.
+func renderMarkdown(w io.Writer, spoolPath string, dialog ExportDialog) error {
+	if _, err := fmt.Fprintf(w, "# %s\n", dialog.Title); err != nil {
+		return err
+	}
+
+	var day string
+	return readSpool(spoolPath, func(m ExportMessage) error {
+		when := time.Unix(int64(m.Date), 0)
+		if d := when.Format(time.DateOnly); d != day {
+			day = d
+			if _, err := fmt.Fprintf(w, "\n## %s\n", day); err != nil {
+				return err
+			}
+		}
+
+		from := m.From
+		if from == "" {
+			from = "Unknown"
+		}
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "\n**%s** · %s", from, when.Format(time.TimeOnly))
+		if m.Edited != "" {
+			b.WriteString(" · edited")
+		}
+		fmt.Fprintf(&b, " · #%d\n", m.ID)
+
+		if m.Forward != nil {
+			fmt.Fprintf(&b, "\n_Forwarded from %s_\n", m.Forward.From)
+		}
+		if m.ReplyTo != nil && m.ReplyTo.MsgID != 0 {
+			fmt.Fprintf(&b, "\n_In reply to #%d_\n", m.ReplyTo.MsgID)
+		}
+		if m.Text != "" {
+			fmt.Fprintf(&b, "\n%s\n", m.Text)
+		}
+		if m.Media != nil {
+			switch {
+			case m.File != "":
+				fmt.Fprintf(&b, "\n[%s](%s)\n", m.Media.Kind, m.File)
+			case m.FileSkipped != "":
+				fmt.Fprintf(&b, "\n_[%s not downloaded: %s]_\n", m.Media.Kind, m.FileSkipped)
+			case m.Media.FileName != "":
+				fmt.Fprintf(&b, "\n_[%s: %s]_\n", m.Media.Kind, m.Media.FileName)
+			default:
+				fmt.Fprintf(&b, "\n_[%s]_\n", m.Media.Kind)
+			}
+		}
+
+		_, err := io.WriteString(w, b.String())
+
+		return err
+	})
+}
+
+// desktopMessage is a message of Telegram Desktop result.json.
+type desktopMessage struct {
+	ID               int                 `json:"id"`
+	Type             string              `json:"type"`
+	Date             string              `json:"date"`
+	DateUnixtime     string              `json:"date_unixtime"`
+	Edited           string              `json:"edited,omitempty"`
+	EditedUnixtime   string              `json:"edited_unixtime,omitempty"`
+	From             string              `json:"from"`
+	FromID           string              `json:"from_id"`
+	ForwardedFrom    string              `json:"forwarded_from,omitempty"`
+	ReplyToMessageID int                 `json:"reply_to_message_id,omitempty"`
+	Photo            string              `json:"photo,omitempty"`
+	File             string              `json:"file,omitempty"`
+	FileName         string              `json:"file_name,omitempty"`
+	MimeType         string              `json:"mime_type,omitempty"`
+	Text             string              `json:"text"`
+	TextEntities     []desktopTextEntity `json:"text_entities"`
+}
+
+type desktopTextEntity struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// desktopSkipped are placeholders Telegram Desktop writes instead of files it did not download.
+var desktopSkipped = map[string]string{
+	skipTooLarge:    "(File exceeds maximum size. Change data exporting settings to download.)",
+	skipUnavailable: "(File unavailable, please try again later)",
+}
+
+// desktopDate is the local time format of Telegram Desktop export.
+const desktopDate = "2006-01-02T15:04:05"
+
+// renderDesktop writes result.json readable by tools built for Telegram Desktop exports.
+func renderDesktop(w io.Writer, spoolPath string, dialog ExportDialog) error {
+	header, err := json.Marshal(struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+		ID   int64  `json:"id"`
+	}{dialog.Title, desktopType(dialog), dialog.ID})
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal dialog")
+	}
+
+	// header without closing brace, messages follow
+	if _, err := fmt.Fprintf(w, "%s,\"messages\":[", header[:len(header)-1]); err != nil {
+		return err
+	}
+
+	sep := "\n"
+	if err := readSpool(spoolPath, func(m ExportMessage) error {
+		dm := desktopMessage{
+			ID:           m.ID,
+			Type:         "message",
+			Date:         time.Unix(int64(m.Date), 0).Format(desktopDate),
+			DateUnixtime: strconv.Itoa(m.Date),
+			From:         m.From,
+			FromID:       m.FromID,
+			Text:         m.Text,
+			TextEntities: []desktopTextEntity{},
+		}
+		if m.Text != "" {
+			dm.TextEntities = append(dm.TextEntities, desktopTextEntity{Type: "plain", Text: m.Text})
+		}
+		if m.EditDate != 0 && m.Edited != "" {
+			dm.Edited = time.Unix(int64(m.EditDate), 0).Format(desktopDate)
+			dm.EditedUnixtime = strconv.Itoa(m.EditDate)
+		}
+		if m.Forward != nil {
+			dm.ForwardedFrom = m.Forward.From
+		}
+		if m.ReplyTo != nil {
+			dm.ReplyToMessageID = m.ReplyTo.MsgID
+		}
+		if m.Media != nil {
+			dm.MimeType = m.Media.Mime
+			file := m.File
+			if m.FileSkipped != "" {
+				file = desktopSkipped[m.FileSkipped]
+			}
+			if m.Media.Kind == MediaPhoto {
+				dm.Photo = file
+			} else {
+				dm.File, dm.FileName = file, m.Media.FileName
+			}
+		}
+
+		data, err := json.Marshal(dm)
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal message")
+		}
+
+		_, err = fmt.Fprintf(w, "%s%s", sep, data)
+		sep = ",\n"
+
+		return err
+	}); err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "\n]}\n")
+
+	return err
+}
+
+// desktopType maps the dialog onto chat types of Telegram Desktop export.
+func desktopType(d ExportDialog) string {
+	visibility := "private"
+	if d.Public {
+		visibility = "public"
+	}
+
+	switch DialogType(d.Type) {
+	case DialogTypeBot:
+		return "bot_chat"
+	case DialogTypeChat:
+		return "private_group"
+	case DialogTypeChannel:
+		if d.Megagroup {
+			return visibility + "_supergroup"
+		}
+
+		return visibility + "_channel"
+	default:
+		return "personal_chat"
+	}
+}
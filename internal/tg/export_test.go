@@ -0,0 +1,328 @@
+package tg
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// readJSONL decodes an export or spool file line by line.
+func readJSONL(t *testing.T, path string) []ExportMessage {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var messages []ExportMessage
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		var m ExportMessage
+		if err := json.Unmarshal(s.Bytes(), &m); err != nil {
+			t.Fatalf("decode %q: %v", s.Text(), err)
+		}
+		messages = append(messages, m)
+	}
+
+	return messages
+}
+
+func exportIDs(messages []ExportMessage) []int {
+	ids := make([]int, 0, len(messages))
+	for _, m := range messages {
+		ids = append(ids, m.ID)
+	}
+
+	return ids
+}
+
+func TestExport(t *testing.T) {
+	utcTime(t)
+	f := newFixture()
+	c := newTestClient(t, f.Fake)
+
+	opts := ExportOptions{Dialog: "alice", Format: ExportJSONL, Dir: t.TempDir()}
+	result, err := c.Export(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Messages != 3 || result.Resumed {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	messages := readJSONL(t, result.Path)
+	if got, want := exportIDs(messages), []int{1, 4, 5}; !slices.Equal(got, want) {
+		t.Fatalf("messages = %v, want %v", got, want)
+	}
+	if m := messages[0]; m.From != "Test User" || m.FromID != "user1" || !m.Out {
+		t.Fatalf("unexpected outgoing message: %+v", m)
+	}
+	if m := messages[2]; m.From != "Alice Smith" || m.FromID != "user10" || m.Text != "bring the report" {
+		t.Fatalf("unexpected incoming message: %+v", m)
+	}
+
+	if _, err := os.Stat(filepath.Join(opts.Dir, exportCheckpointFile)); !os.IsNotExist(err) {
+		t.Fatalf("checkpoint left after export: %v", err)
+	}
+}
+
+func TestExportFormats(t *testing.T) {
+	utcTime(t)
+	f := newFixture()
+	c := newTestClient(t, f.Fake)
+
+	tests := []struct {
+		format string
+		check  func(t *testing.T, data []byte)
+	}{
+		{ExportJSON, func(t *testing.T, data []byte) {
+			var v struct {
+				Dialog   ExportDialog    `json:"dialog"`
+				Messages []ExportMessage `json:"messages"`
+			}
+			if err := json.Unmarshal(data, &v); err != nil {
+				t.Fatal(err)
+			}
+			if v.Dialog.Title != "Team Chat" || !slices.Equal(exportIDs(v.Messages), []int{2, 3}) {
+				t.Fatalf("unexpected export: %+v", v)
+			}
+			if v.Messages[1].From != "Bob" {
+				t.Fatalf("sender = %q", v.Messages[1].From)
+			}
+		}},
+		{ExportMarkdown, func(t *testing.T, data []byte) {
+			for _, want := range []string{"# Team Chat\n", "## 2023-11-14\n", "**Alice Smith** · ", "standup moved to 11"} {
+				if !strings.Contains(string(data), want) {
+					t.Fatalf("markdown lacks %q:\n%s", want, data)
+				}
+			}
+		}},
+		{ExportDesktop, func(t *testing.T, data []byte) {
+			var v struct {
+				Name     string           `json:"name"`
+				Type     string           `json:"type"`
+				ID       int64            `json:"id"`
+				Messages []desktopMessage `json:"messages"`
+			}
+			if err := json.Unmarshal(data, &v); err != nil {
+				t.Fatal(err)
+			}
+			if v.Name != "Team Chat" || v.Type != "private_group" || v.ID != teamID || len(v.Messages) != 2 {
+				t.Fatalf("unexpected export: %+v", v)
+			}
+			if m := v.Messages[0]; m.FromID != "user10" || m.Type != "message" || m.DateUnixtime == "" || m.Text != "standup moved to 11" {
+				t.Fatalf("unexpected message: %+v", m)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			result, err := c.Export(context.Background(), ExportOptions{Dialog: "Team Chat", Format: tt.format, Dir: t.TempDir()})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(result.Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, data)
+		})
+	}
+}
+
+func TestExportDates(t *testing.T) {
+	f := newFixture()
+	c := newTestClient(t, f.Fake)
+
+	since := f.alice.Messages[1].Date
+	opts := ExportOptions{Dialog: "alice", Format: ExportJSONL, Dir: t.TempDir(), Since: strconv.Itoa(since), Until: strconv.Itoa(since)}
+	result, err := c.Export(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := exportIDs(readJSONL(t, result.Path)); !slices.Equal(got, []int{4}) {
+		t.Fatalf("messages = %v, want [4]", got)
+	}
+}
+
+func TestExportResume(t *testing.T) {
+	f := newFixture()
+	for i := range 2*MaxHistoryLimit + 10 {
+		f.bob.Message(bobID, 0, "message "+strconv.Itoa(i))
+	}
+
+	// the second page fails once as if the connection was lost
+	var pages int
+	f.Handle(tg.MessagesGetHistoryRequestTypeID, func(ctx context.Context, input bin.Encoder) (bin.Encoder, error) {
+		if pages++; pages == 2 {
+			return nil, tgerr.New(500, "INTERNAL_SERVER_ERROR")
+		}
+
+		return f.Serve(ctx, input)
+	})
+	c := newTestClient(t, f.Fake)
+
+	opts := ExportOptions{Dialog: "Bob", Format: ExportJSONL, Dir: t.TempDir()}
+	if _, err := c.Export(context.Background(), opts); err == nil {
+		t.Fatal("expected interrupted export")
+	}
+
+	spool := readJSONL(t, filepath.Join(opts.Dir, exportSpoolFile))
+	if len(spool) != MaxHistoryLimit {
+		t.Fatalf("spool has %d messages after the first page", len(spool))
+	}
+
+	other := opts
+	other.Format = ExportMarkdown
+	if _, err := c.Export(context.Background(), other); err == nil {
+		t.Fatal("expected error for unfinished export with other options")
+	}
+
+	result, err := c.Export(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Resumed || result.Messages != len(f.bob.Messages) {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	ids := exportIDs(readJSONL(t, result.Path))
+	if len(ids) != len(f.bob.Messages) || !slices.IsSorted(ids) || ids[0] != f.bob.Messages[0].ID {
+		t.Fatalf("exported %d messages, sorted %t", len(ids), slices.IsSorted(ids))
+	}
+	if ids := slices.Compact(slices.Clone(ids)); len(ids) != len(f.bob.Messages) {
+		t.Fatal("duplicate messages after resume")
+	}
+}
+
+func TestExportServicePage(t *testing.T) {
+	f := newFixture()
+	for i := range MaxHistoryLimit + 5 {
+		f.bob.Message(bobID, 0, "message "+strconv.Itoa(i))
+	}
+
+	// the oldest page holds only service messages
+	var pages int
+	f.Handle(tg.MessagesGetHistoryRequestTypeID, func(ctx context.Context, input bin.Encoder) (bin.Encoder, error) {
+		rsp, err := f.Serve(ctx, input)
+		if pages++; err != nil || pages > 1 {
+			return rsp, err
+		}
+
+		messages := rsp.(interface{ GetMessages() []tg.MessageClass }).GetMessages()
+		for i, raw := range messages {
+			m := raw.(*tg.Message)
+			messages[i] = &tg.MessageService{ID: m.ID, PeerID: m.PeerID, Date: m.Date, Action: &tg.MessageActionHistoryClear{}}
+		}
+
+		return rsp, nil
+	})
+	c := newTestClient(t, f.Fake)
+
+	result, err := c.Export(context.Background(), ExportOptions{Dialog: "Bob", Format: ExportJSONL, Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := len(f.bob.Messages) - MaxHistoryLimit; result.Messages != want {
+		t.Fatalf("exported %d messages, want %d after the service page", result.Messages, want)
+	}
+}
+
+func TestExportMedia(t *testing.T) {
+	f := newFixture()
+	f.Handle(tg.UploadGetFileRequestTypeID, func(context.Context, bin.Encoder) (bin.Encoder, error) {
+		return &tg.UploadFile{Type: &tg.StorageFileJpeg{}, Bytes: []byte("jpeg")}, nil
+	})
+	m := f.alice.Message(aliceID, 0, "photo")
+	m.SetMedia(&tg.MessageMediaPhoto{Photo: &tg.Photo{
+		ID:    77,
+		Sizes: []tg.PhotoSizeClass{&tg.PhotoSize{Type: "x", W: 800, H: 600, Size: 4}},
+	}})
+	c := newTestClient(t, f.Fake)
+
+	opts := ExportOptions{Dialog: "alice", Format: ExportJSONL, Dir: t.TempDir(), Media: true}
+	result, err := c.Export(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := readJSONL(t, result.Path)
+	last := messages[len(messages)-1]
+	if result.Files != 1 || last.File != ExportMediaDir+"/"+strconv.Itoa(m.ID)+"_photo_77.jpg" {
+		t.Fatalf("unexpected media export: %+v, %+v", result, last)
+	}
+
+	data, err := os.ReadFile(filepath.Join(opts.Dir, last.File))
+	if err != nil || string(data) != "jpeg" {
+		t.Fatalf("downloaded %q, %v", data, err)
+	}
+}
+
+func TestExportMediaSkipped(t *testing.T) {
+	f := newFixture()
+	failing := true
+	f.Handle(tg.UploadGetFileRequestTypeID, func(context.Context, bin.Encoder) (bin.Encoder, error) {
+		if failing {
+			return nil, tgerr.New(500, "INTERNAL")
+		}
+
+		return &tg.UploadFile{Type: &tg.StorageFileJpeg{}, Bytes: []byte("jpeg")}, nil
+	})
+	// the size of the largest photo is unknown, so the limit is checked while downloading
+	big := f.alice.Message(aliceID, 0, "big photo")
+	big.SetMedia(&tg.MessageMediaPhoto{Photo: &tg.Photo{ID: 77, Sizes: []tg.PhotoSizeClass{&tg.PhotoSize{Type: "x", W: 800, H: 600}}}})
+	gone := f.alice.Message(aliceID, 0, "deleted photo")
+	gone.SetMedia(&tg.MessageMediaPhoto{Photo: &tg.PhotoEmpty{ID: 78}})
+	c := newTestClient(t, f.Fake, WithDownloads("", 2))
+
+	opts := ExportOptions{Dialog: "alice", Format: ExportDesktop, Dir: t.TempDir(), Media: true}
+
+	// a failed download stops the export before the checkpoint
+	if _, err := c.Export(context.Background(), opts); err == nil {
+		t.Fatal("export succeeded with failing download")
+	}
+	if cp, err := loadExportCheckpoint(opts.Dir); err != nil || cp != nil {
+		t.Fatalf("checkpoint advanced past failed download: %+v, %v", cp, err)
+	}
+
+	failing = false
+	result, err := c.Export(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Files != 0 || !slices.Equal(result.Skipped, []int{big.ID, gone.ID}) {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	data, err := os.ReadFile(result.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v struct {
+		Messages []desktopMessage `json:"messages"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	photos := make(map[int]string)
+	for _, m := range v.Messages {
+		photos[m.ID] = m.Photo
+	}
+	if photos[big.ID] != desktopSkipped[skipTooLarge] || photos[gone.ID] != desktopSkipped[skipUnavailable] {
+		t.Fatalf("unexpected placeholders: %v", photos)
+	}
+}
@@ -0,0 +1,140 @@
+package tg
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// goldenCase is a raw TL response in testdata with its expected transformations:
+// <name>.tl is the response, <name>.json is what the tool returns and <name>.clean.json is cleanJSON of the raw response.
+type goldenCase struct {
+	name string
+	raw  []byte
+}
+
+func goldenCases(t *testing.T, dir string) []goldenCase {
+	t.Helper()
+
+	paths, err := filepath.Glob(filepath.Join("testdata", dir, "*.tl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatalf("no fixtures in testdata/%s", dir)
+	}
+
+	cases := make([]goldenCase, 0, len(paths))
+	for _, p := range paths {
+		raw, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cases = append(cases, goldenCase{name: strings.TrimSuffix(p, ".tl"), raw: raw})
+	}
+
+	return cases
+}
+
+// utcTime formats message dates in UTC, so golden files do not depend on the machine time zone.
+func utcTime(t *testing.T) {
+	local := time.Local
+	time.Local = time.UTC
+	t.Cleanup(func() { time.Local = local })
+}
+
+// compareGolden checks v marshaled as indented JSON against the golden file, or rewrites it with -update.
+func compareGolden(t *testing.T, path string, v any) {
+	t.Helper()
+
+	got, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = append(got, '\n')
+
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v, run go test with -update to create it", err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Fatalf("%s mismatch, run go test with -update if the change is intended\ngot:\n%s", path, got)
+	}
+}
+
+// compareCleanGolden checks cleanJSON of the raw response the way debug logging prints it.
+func compareCleanGolden(t *testing.T, path string, raw any) {
+	t.Helper()
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compareGolden(t, path, json.RawMessage(cleanJSON(data)))
+}
+
+func TestDialogsGolden(t *testing.T) {
+	utcTime(t)
+
+	for _, gc := range goldenCases(t, "dialogs") {
+		t.Run(filepath.Base(gc.name), func(t *testing.T) {
+			dc, err := tg.DecodeMessagesDialogs(&bin.Buffer{Buf: gc.raw})
+			if err != nil {
+				t.Fatalf("decode fixture: %v", err)
+			}
+
+			d, err := newDialogs(dc, dialogsFilter{}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// goldens are rendered in markdown whatever the default is
+			d.textFormat = TextMarkdown
+
+			compareGolden(t, gc.name+".json", DialogsResponse{Dialogs: d.Info(), Offset: d.Offset()})
+			compareCleanGolden(t, gc.name+".clean.json", dc)
+		})
+	}
+}
+
+func TestHistoryGolden(t *testing.T) {
+	utcTime(t)
+
+	for _, gc := range goldenCases(t, "history") {
+		t.Run(filepath.Base(gc.name), func(t *testing.T) {
+			mc, err := tg.DecodeMessagesMessages(&bin.Buffer{Buf: gc.raw})
+			if err != nil {
+				t.Fatalf("decode fixture: %v", err)
+			}
+
+			h, err := newHistory(mc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h.textFormat = TextMarkdown
+
+			compareGolden(t, gc.name+".json", h.Info())
+			compareCleanGolden(t, gc.name+".clean.json", mc)
+		})
+	}
+}
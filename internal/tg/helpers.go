@@ -3,8 +3,11 @@ package tg
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/gotd/td/tg"
+	"github.com/pkg/errors"
 	"github.com/tidwall/gjson"
 )
 
@@ -31,6 +34,9 @@ func getUsername(source any) string {
 	switch u := source.(type) {
 	case *tg.User:
 		username = u.Username
+		if username == "" {
+			username = fmt.Sprintf("usr[%d]", u.ID)
+		}
 	case *tg.Chat:
 		username = fmt.Sprintf("cht[%d]", u.ID)
 	case *tg.Channel:
@@ -43,6 +49,25 @@ func getUsername(source any) string {
 	return username
 }
 
+// parseTime accepts unix timestamp, RFC3339, "2006-01-02 15:04:05" or "2006-01-02" in local time.
+func parseTime(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	if ts, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return int(ts), nil
+	}
+
+	for _, layout := range []string{time.RFC3339, time.DateTime, time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return int(t.Unix()), nil
+		}
+	}
+
+	return 0, errors.Wrapf(ErrInvalidArgument, "invalid time %q: use unix timestamp, RFC3339, %q or %q", s, time.DateTime, time.DateOnly)
+}
+
 // cleanJSON removes empty/default fields from JSON
 func cleanJSON(data []byte) []byte {
 	result := gjson.ParseBytes(data)
@@ -4,18 +4,32 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"strings"
 	"time"
 
-	"github.com/gotd/td/telegram/message"
 	"github.com/gotd/td/tg"
 	mcp "github.com/metoro-io/mcp-golang"
 	"github.com/pkg/errors"
 )
 
+const (
+	DefaultHistoryLimit = 50
+	MaxHistoryLimit     = 100
+)
+
+// nolint:lll
 type HistoryArguments struct {
-	Name   string `json:"name" jsonschema:"required,description=Name of the dialog"`
-	Offset int    `json:"offset,omitempty" jsonschema:"description=Offset for continuation"`
+	Name       string `json:"name" jsonschema:"required,description=Name of the dialog"`
+	Offset     int    `json:"offset,omitempty" jsonschema:"description=Offset for continuation"`
+	Limit      int    `json:"limit,omitempty" jsonschema:"description=Maximum number of messages (default 50\\, max 100)"`
+	Since      string `json:"since,omitempty" jsonschema:"description=Only messages after this time (unix\\, RFC3339\\, 2006-01-02 15:04:05 or 2006-01-02)"`
+	Until      string `json:"until,omitempty" jsonschema:"description=Only messages before this time (unix\\, RFC3339\\, 2006-01-02 15:04:05 or 2006-01-02)"`
+	MinID      int    `json:"min_id,omitempty" jsonschema:"description=Only messages with id greater than this"`
+	MaxID      int    `json:"max_id,omitempty" jsonschema:"description=Only messages with id less than this"`
+	Forward    bool   `json:"forward,omitempty" jsonschema:"description=Page from older to newer messages starting after offset\\, min_id or since"`
+	OnlyUnread bool   `json:"only_unread,omitempty" jsonschema:"description=Only incoming messages not read yet"`
+
+	SourceArgument
+	AccountArgument
 }
 
 type HistoryResponse struct {
@@ -23,42 +37,119 @@ type HistoryResponse struct {
 	Offset   int           `json:"offset,omitempty"`
 }
 
-func (c *Client) GetHistory(args HistoryArguments) (*mcp.ToolResponse, error) {
-	var messagesClass tg.MessagesMessagesClass
-	client := c.T()
-	if err := client.Run(context.Background(), func(ctx context.Context) (err error) {
-		api := client.API()
+// historyQuery is HistoryArguments with parsed bounds.
+type historyQuery struct {
+	HistoryArguments
+	minDate, maxDate int
+}
 
-		inputPeer, err := getInputPeerFromName(ctx, api, args.Name)
-		if err != nil {
-			return fmt.Errorf("get inputPeer from name: %w", err)
+func newHistoryQuery(args HistoryArguments) (historyQuery, error) {
+	q := historyQuery{HistoryArguments: args}
+
+	var err error
+	if q.minDate, err = parseTime(args.Since); err != nil {
+		return q, errors.Wrap(err, "since")
+	}
+
+	if q.maxDate, err = parseTime(args.Until); err != nil {
+		return q, errors.Wrap(err, "until")
+	}
+
+	switch {
+	case q.Limit <= 0:
+		q.Limit = DefaultHistoryLimit
+	case q.Limit > MaxHistoryLimit:
+		q.Limit = MaxHistoryLimit
+	}
+
+	return q, nil
+}
+
+// request maps the query onto messages.getHistory, readMaxID is read_inbox_max_id for unread only queries.
+func (q historyQuery) request(inputPeer tg.InputPeerClass, readMaxID int) *tg.MessagesGetHistoryRequest {
+	req := &tg.MessagesGetHistoryRequest{
+		Peer:  inputPeer,
+		Limit: q.Limit,
+		MinID: max(q.MinID, readMaxID),
+		MaxID: q.MaxID,
+	}
+
+	if !q.Forward {
+		req.OffsetID = q.Offset
+		req.OffsetDate = q.maxDate
+
+		return req
+	}
+
+	// negative add_offset turns the window to messages newer than offset_id/offset_date
+	req.AddOffset = -q.Limit
+	switch {
+	case q.Offset > 0:
+		req.OffsetID = q.Offset
+		req.MinID = max(req.MinID, q.Offset)
+	case req.MinID > 0:
+		req.OffsetID = req.MinID + 1
+	case q.minDate > 0:
+		req.OffsetDate = q.minDate
+	default:
+		req.OffsetID = 1
+	}
+
+	return req
+}
+
+// messages applies bounds telegram does not filter by itself and returns continuation offset, zero at the end.
+func (q historyQuery) messages(h *history) ([]MessageInfo, int) {
+	messages := make([]MessageInfo, 0, len(h.Messages))
+	var (
+		offset   int
+		exceeded bool
+	)
+	for _, msg := range h.Messages {
+		// continue after the newest message when paging forward, before the oldest otherwise;
+		// service messages count too, so a page of them does not end the history
+		if id := msg.GetID(); offset == 0 || q.Forward == (id > offset) {
+			offset = id
 		}
 
-		messagesClass, err = api.MessagesGetHistory(ctx, &tg.MessagesGetHistoryRequest{
-			Peer:     inputPeer,
-			OffsetID: args.Offset,
-		})
-		if err != nil {
-			return fmt.Errorf("failed to get history: %w", err)
+		m, ok := msg.(*tg.Message)
+		if !ok {
+			continue
 		}
 
-		//Debug
-		//jsonData, _ := json.Marshal(messagesClass)
-		//log.Info().RawJSON("history", cleanJSON(jsonData)).Msg("history")
+		// only the bound in paging direction ends the history, messages before the start bound are skipped
+		before, after := q.minDate > 0 && m.Date < q.minDate, q.maxDate > 0 && m.Date > q.maxDate
+		if q.Forward && after || !q.Forward && before {
+			exceeded = true
+		}
+		if before || after {
+			continue
+		}
 
-		return nil
-	}); err != nil {
-		return nil, errors.Wrap(err, "failed to get history")
+		if q.Forward && q.Offset > 0 && m.ID <= q.Offset {
+			continue
+		}
+
+		if q.OnlyUnread && m.Out {
+			continue
+		}
+
+		info := h.messageInfo(m)
+		info.IsUnread = q.OnlyUnread
+		messages = append(messages, info)
 	}
 
-	h, err := newHistory(messagesClass)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to process history")
+	if exceeded || len(h.Messages) < q.Limit {
+		offset = 0
 	}
 
-	rsp := HistoryResponse{
-		Messages: h.Info(),
-		Offset:   h.Offset(),
+	return messages, offset
+}
+
+func (c *Client) GetHistory(args HistoryArguments) (*mcp.ToolResponse, error) {
+	rsp, err := c.History(args)
+	if err != nil {
+		return nil, err
 	}
 
 	jsonData, err := json.Marshal(rsp)
@@ -69,40 +160,91 @@ func (c *Client) GetHistory(args HistoryArguments) (*mcp.ToolResponse, error) {
 	return mcp.NewToolResponse(mcp.NewTextContent(string(jsonData))), nil
 }
 
-func getInputPeerFromName(ctx context.Context, api *tg.Client, name string) (tg.InputPeerClass, error) {
-	isCustom := strings.Contains(name, "[") && strings.Contains(name, "]")
+// History returns messages of the dialog, see GetHistory.
+func (c *Client) History(args HistoryArguments) (*HistoryResponse, error) {
+	q, err := newHistoryQuery(args)
+	if err != nil {
+		return nil, err
+	}
 
-	switch {
-	case strings.HasPrefix(name, "chn") && isCustom:
-		var channelPeer tg.InputPeerChannel
-		_, err := fmt.Sscanf(name, "chn[%d:%d]", &channelPeer.ChannelID, &channelPeer.AccessHash)
+	local, err := args.local()
+	if err != nil {
+		return nil, err
+	}
+	if local {
+		rsp, err := c.localHistory(q)
 		if err != nil {
-			return nil, errors.Wrapf(err, "scan channel peer(%q)", name)
+			return nil, err
 		}
 
-		return &channelPeer, nil
-	case strings.HasPrefix(name, "cht") && isCustom:
-		var chatPeer tg.InputPeerChat
-		_, err := fmt.Sscanf(name, "cht[%d]", &chatPeer.ChatID)
+		return &rsp, nil
+	}
+
+	var messagesClass tg.MessagesMessagesClass
+	if err := c.run(func(ctx context.Context, api *tg.Client) (err error) {
+		inputPeer, err := c.resolvePeer(ctx, api, args.Name, accessRead)
 		if err != nil {
-			return nil, errors.Wrapf(err, "scan chat peer(%q)", name)
+			return err
 		}
 
-		return &chatPeer, nil
-	default:
-		sender := message.NewSender(api)
-		inputPeer, err := sender.Resolve(name).AsInputPeer(ctx)
+		var readMaxID int
+		if args.OnlyUnread {
+			readMaxID, err = readInboxMaxID(ctx, api, inputPeer)
+			if err != nil {
+				return err
+			}
+		}
+
+		messagesClass, err = api.MessagesGetHistory(ctx, q.request(inputPeer, readMaxID))
 		if err != nil {
-			return nil, fmt.Errorf("failed to resolve name: %w", err)
+			return fmt.Errorf("failed to get history: %w", err)
 		}
 
-		return inputPeer, nil
+		//Debug
+		//jsonData, _ := json.Marshal(messagesClass)
+		//log.Info().RawJSON("history", cleanJSON(jsonData)).Msg("history")
+
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "failed to get history")
 	}
+
+	h, err := newHistory(messagesClass)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to process history")
+	}
+	h.textFormat = c.textFormat
+
+	var rsp HistoryResponse
+	rsp.Messages, rsp.Offset = q.messages(h)
+
+	return &rsp, nil
+}
+
+// readInboxMaxID returns id of the last read incoming message of the dialog.
+func readInboxMaxID(ctx context.Context, api *tg.Client, inputPeer tg.InputPeerClass) (int, error) {
+	pd, err := api.MessagesGetPeerDialogs(ctx, []tg.InputDialogPeerClass{&tg.InputDialogPeer{Peer: inputPeer}})
+	if err != nil {
+		return 0, errors.Wrap(err, "get peer dialogs")
+	}
+
+	for _, dItem := range pd.Dialogs {
+		if dialogItem, ok := dItem.(*tg.Dialog); ok {
+			return dialogItem.ReadInboxMaxID, nil
+		}
+	}
+
+	return 0, errors.Wrap(ErrPeerNotFound, "dialog not found")
 }
 
 type history struct {
 	tg.MessagesMessages
-	users map[int64]*tg.User
+	users    map[int64]*tg.User
+	chats    map[int64]*tg.Chat
+	channels map[int64]*tg.Channel
+
+	// textFormat renders message entities, see renderText
+	textFormat string
 }
 
 func newHistory(raw tg.MessagesMessagesClass) (*history, error) {
@@ -133,6 +275,17 @@ func newHistory(raw tg.MessagesMessagesClass) (*history, error) {
 		}
 	}
 
+	h.chats = make(map[int64]*tg.Chat)
+	h.channels = make(map[int64]*tg.Channel)
+	for _, c := range h.Chats {
+		switch cT := c.(type) {
+		case *tg.Chat:
+			h.chats[cT.ID] = cT
+		case *tg.Channel:
+			h.channels[cT.ID] = cT
+		}
+	}
+
 	return &h, nil
 }
 
@@ -145,33 +298,68 @@ func (h *history) Info() []MessageInfo {
 			continue
 		}
 
-		var who string
-		if m.FromID != nil {
-			switch from := m.FromID.(type) {
-			case *tg.PeerUser:
-				if user, ok := h.users[from.UserID]; ok {
-					who = getUsername(user)
-				}
+		messages = append(messages, h.messageInfo(m))
+	}
+
+	return messages
+}
+
+func (h *history) messageInfo(m *tg.Message) MessageInfo {
+	var who string
+	if m.FromID != nil {
+		switch from := m.FromID.(type) {
+		case *tg.PeerUser:
+			if user, ok := h.users[from.UserID]; ok {
+				who = getUsername(user)
 			}
 		}
+	}
 
-		messages = append(messages, MessageInfo{
-			Who:  who,
-			When: time.Unix(int64(m.Date), 0).Format(time.DateTime),
-			Text: m.Message,
-			ts:   m.Date,
-		})
+	info := MessageInfo{
+		Who:  who,
+		When: time.Unix(int64(m.Date), 0).Format(time.DateTime),
+		Text: renderText(m.Message, m.Entities, h.textFormat),
+		ts:   m.Date,
 	}
+	fillMessageMeta(&info, m, h.dialogName)
 
-	return messages
+	return info
 }
 
-func (h *history) Offset() int {
-	for i := len(h.Messages) - 1; i >= 0; i-- {
-		if msg, ok := h.Messages[i].(*tg.Message); ok {
-			return msg.ID
+// dialogName returns dialog name in the same form as tg_dialogs.
+func (h *history) dialogName(p tg.PeerClass) string {
+	switch v := p.(type) {
+	case *tg.PeerUser:
+		if u, ok := h.users[v.UserID]; ok {
+			return getUsername(u)
+		}
+	case *tg.PeerChat:
+		if c, ok := h.chats[v.ChatID]; ok {
+			return getUsername(c)
+		}
+	case *tg.PeerChannel:
+		if c, ok := h.channels[v.ChannelID]; ok {
+			return getUsername(c)
+		}
+	}
+
+	return ""
+}
+
+// inputPeer builds input peer with access hash from entities of the response.
+func (h *history) inputPeer(p tg.PeerClass) tg.InputPeerClass {
+	switch v := p.(type) {
+	case *tg.PeerUser:
+		if u, ok := h.users[v.UserID]; ok {
+			return u.AsInputPeer()
+		}
+	case *tg.PeerChat:
+		return &tg.InputPeerChat{ChatID: v.ChatID}
+	case *tg.PeerChannel:
+		if c, ok := h.channels[v.ChannelID]; ok {
+			return c.AsInputPeer()
 		}
 	}
 
-	return 0
+	return getInputPeerID(p)
 }
@@ -0,0 +1,132 @@
+package tg
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/chaindead/telegram-mcp/internal/tgtest"
+)
+
+func messageIDs(messages []MessageInfo) []int {
+	ids := make([]int, 0, len(messages))
+	for _, m := range messages {
+		ids = append(ids, m.ID)
+	}
+
+	return ids
+}
+
+func TestGetHistory(t *testing.T) {
+	f := newFixture()
+	c := newTestClient(t, f.Fake)
+
+	rsp := decode[HistoryResponse](t)(c.GetHistory(HistoryArguments{Name: "alice"}))
+	if got, want := messageIDs(rsp.Messages), []int{5, 4, 1}; !slices.Equal(got, want) {
+		t.Fatalf("messages = %v, want %v", got, want)
+	}
+
+	if m := rsp.Messages[2]; !m.Out || m.Text != "are we meeting today?" {
+		t.Fatalf("unexpected outgoing message: %+v", m)
+	}
+	if m := rsp.Messages[0]; m.Out || m.Text != "bring the report" {
+		t.Fatalf("unexpected incoming message: %+v", m)
+	}
+	if rsp.Offset != 0 {
+		t.Fatalf("offset = %d at the end of history", rsp.Offset)
+	}
+}
+
+func TestGetHistoryPaging(t *testing.T) {
+	f := newFixture()
+	c := newTestClient(t, f.Fake)
+
+	tests := []struct {
+		name    string
+		forward bool
+		want    [][]int
+	}{
+		{"backward", false, [][]int{{5, 4}, {1}}},
+		{"forward", true, [][]int{{4, 1}, {5}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := HistoryArguments{Name: "alice", Limit: 2, Forward: tt.forward}
+			for i, want := range tt.want {
+				rsp := decode[HistoryResponse](t)(c.GetHistory(args))
+				if got := messageIDs(rsp.Messages); !slices.Equal(got, want) {
+					t.Fatalf("page %d = %v, want %v", i, got, want)
+				}
+
+				args.Offset = rsp.Offset
+			}
+
+			if args.Offset != 0 {
+				t.Fatalf("offset = %d after the last page", args.Offset)
+			}
+		})
+	}
+}
+
+func TestGetHistoryFilters(t *testing.T) {
+	f := newFixture()
+	c := newTestClient(t, f.Fake)
+
+	since := strconv.Itoa(f.alice.Messages[1].Date)
+	// telegram returns messages before offset_date, exclusive
+	until := strconv.Itoa(f.alice.Messages[1].Date + 1)
+
+	tests := []struct {
+		name string
+		args HistoryArguments
+		want []int
+	}{
+		{"only unread", HistoryArguments{Name: "alice", OnlyUnread: true}, []int{5, 4}},
+		{"since", HistoryArguments{Name: "alice", Since: since}, []int{5, 4}},
+		{"until", HistoryArguments{Name: "alice", Until: until}, []int{4, 1}},
+		{"min id", HistoryArguments{Name: "alice", MinID: 4}, []int{5}},
+		{"max id", HistoryArguments{Name: "alice", MaxID: 5}, []int{4, 1}},
+		{"channel", HistoryArguments{Name: "daily_news"}, []int{2, 1}},
+		{"group", HistoryArguments{Name: "Team Chat"}, []int{3, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rsp := decode[HistoryResponse](t)(c.GetHistory(tt.args))
+			if got := messageIDs(rsp.Messages); !slices.Equal(got, tt.want) {
+				t.Fatalf("messages = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetHistorySavedMessages(t *testing.T) {
+	f := newFixture()
+	saved := f.AddUser(f.Self())
+	saved.Message(tgtest.SelfID, 0, "note to self")
+	c := newTestClient(t, f.Fake)
+
+	rsp := decode[HistoryResponse](t)(c.GetHistory(HistoryArguments{Name: "me"}))
+	if len(rsp.Messages) != 1 || rsp.Messages[0].Text != "note to self" {
+		t.Fatalf("unexpected saved messages: %+v", rsp.Messages)
+	}
+}
+
+func TestGetHistoryForwardSince(t *testing.T) {
+	f := newFixture()
+	c := newTestClient(t, f.Fake)
+
+	// paging starts at min_id, so the first page holds a message older than since
+	since := strconv.Itoa(f.alice.Messages[2].Date)
+	args := HistoryArguments{Name: "alice", Forward: true, MinID: 1, Since: since, Limit: 1}
+
+	first := decode[HistoryResponse](t)(c.GetHistory(args))
+	if len(first.Messages) != 0 || first.Offset != 4 {
+		t.Fatalf("unexpected first page: %+v", first)
+	}
+
+	args.Offset = first.Offset
+	next := decode[HistoryResponse](t)(c.GetHistory(args))
+	if got := messageIDs(next.Messages); !slices.Equal(got, []int{5}) {
+		t.Fatalf("messages = %v, want [5]", got)
+	}
+}
@@ -0,0 +1,331 @@
+package tg
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	mcp "github.com/metoro-io/mcp-golang"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// localResponse marshals the answer of a source=local call.
+func localResponse[T any](rsp T, err error) (*mcp.ToolResponse, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	jsonData, err := json.Marshal(rsp)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal response")
+	}
+
+	return mcp.NewToolResponse(mcp.NewTextContent(string(jsonData))), nil
+}
+
+func (c *Client) localArchive() (*Archive, error) {
+	if c.archive == nil {
+		return nil, errors.Wrap(ErrInvalidArgument, "local archive is disabled, start the server with --archive")
+	}
+
+	return c.archive, nil
+}
+
+// localKey resolves name against known peers without API calls; links and phones are not supported.
+func (c *Client) localKey(name string) (peerKey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return peerKey{}, errors.Wrap(ErrInvalidArgument, "empty dialog name")
+	}
+
+	if isSelfName(name) {
+		if inputPeer, ok := c.peers.self(); ok {
+			key, _ := inputPeerKey(inputPeer)
+			return key, nil
+		}
+	}
+
+	for format, kind := range map[string]peerKind{"chn[%d": peerKindChannel, "cht[%d": peerKindChat, "usr[%d": peerKindUser} {
+		var id int64
+		if _, err := fmt.Sscanf(name, format, &id); err == nil {
+			return peerKey{kind: kind, id: id}, nil
+		}
+	}
+
+	if inputPeer, ok := c.peers.byUsername(name); ok {
+		key, _ := inputPeerKey(inputPeer)
+		return key, nil
+	}
+
+	matches, _ := matchTitle(c.peers.records(), name)
+	if len(matches) > 1 && c.policy.restricted() {
+		var err error
+		if matches, err = allowedMatches(name, matches, c.localAllowed); err != nil {
+			return peerKey{}, err
+		}
+	}
+
+	inputPeer, err := pickPeer(name, matches)
+	if err != nil {
+		return peerKey{}, err
+	}
+
+	key, _ := inputPeerKey(inputPeer)
+
+	return key, nil
+}
+
+// localPeer resolves name for an archive query and enforces policy like resolvePeer.
+func (c *Client) localPeer(name string) (peerKey, error) {
+	if err := c.policy.checkAccess(accessRead); err != nil {
+		return peerKey{}, err
+	}
+
+	key, err := c.localKey(name)
+	if err != nil {
+		return peerKey{}, err
+	}
+
+	if !c.localAllowed(key) {
+		return peerKey{}, errors.Wrapf(ErrPolicyDenied, "dialog %q", name)
+	}
+
+	return key, nil
+}
+
+// localAllowed matches policy against the archived dialog, or the known or archived peer when the dialog is not archived.
+// The folder seen in this run's listings wins over the archived one; without either, folder rules deny the peer.
+func (c *Client) localAllowed(key peerKey) bool {
+	if !c.policy.restricted() {
+		return true
+	}
+
+	folder, folderKnown := c.peers.folder(key)
+
+	if c.archive != nil {
+		d, found, err := c.archive.dialog(key)
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to read archived dialog")
+			return false
+		}
+		if found {
+			s := d.subject()
+			if folderKnown {
+				s.Folder = folder
+			}
+
+			return c.policy.allows(s)
+		}
+	}
+
+	if !folderKnown && c.policy.hasFolderRules() {
+		return false
+	}
+
+	s := c.knownSubject(key)
+	s.Folder = folder
+	if s.Type == DialogTypeUnknown && c.archive != nil {
+		if r, found, err := c.archive.peer(key); err == nil && found {
+			s.Username, s.Type = r.Username, r.Type
+		}
+	}
+
+	return c.policy.allows(s)
+}
+
+// localName returns the tool name of a known or archived peer.
+func (c *Client) localName(key peerKey) string {
+	if r, ok := c.peers.record(key); ok {
+		return r.name()
+	}
+
+	if c.archive == nil {
+		return ""
+	}
+
+	if r, ok, err := c.archive.peer(key); err == nil && ok {
+		return r.name()
+	}
+
+	return ""
+}
+
+func (c *Client) localHistory(q historyQuery) (HistoryResponse, error) {
+	archive, err := c.localArchive()
+	if err != nil {
+		return HistoryResponse{}, err
+	}
+
+	key, err := c.localPeer(q.Name)
+	if err != nil {
+		return HistoryResponse{}, err
+	}
+
+	var readMaxID int
+	if q.OnlyUnread {
+		d, found, err := archive.dialog(key)
+		if err != nil {
+			return HistoryResponse{}, errors.Wrap(err, "read archive")
+		}
+		if !found {
+			return HistoryResponse{}, errors.Wrapf(ErrPeerNotFound, "dialog %q is not archived", q.Name)
+		}
+
+		readMaxID = d.ReadInboxMaxID
+	}
+
+	rsp := HistoryResponse{Messages: []MessageInfo{}}
+	messages, offset, err := archive.history(key, q, readMaxID)
+	if err != nil {
+		return HistoryResponse{}, errors.Wrap(err, "read archive")
+	}
+	rsp.Messages = append(rsp.Messages, messages...)
+	rsp.Offset = offset
+
+	return rsp, nil
+}
+
+func (c *Client) localDialogs(args DialogsArguments, filter dialogsFilter, offset DialogsOffset, limit int) (DialogsResponse, error) {
+	archive, err := c.localArchive()
+	if err != nil {
+		return DialogsResponse{}, err
+	}
+
+	all, err := archive.dialogs()
+	if err != nil {
+		return DialogsResponse{}, errors.Wrap(err, "read archive")
+	}
+
+	rsp := DialogsResponse{Dialogs: make([]DialogInfo, 0, min(limit, len(all)))}
+	offsetKey, paged := inputPeerKey(offset.Peer)
+	for _, d := range all {
+		// continue after the offset in the order of archive.dialogs, the offset dialog may be gone
+		if paged && (d.TopDate > offset.Date || d.TopDate == offset.Date && d.ID <= offsetKey.id) {
+			continue
+		}
+
+		if (d.Folder == ArchiveFolderID) != args.Archived || !d.matches(filter) || !c.policy.allows(d.subject()) {
+			continue
+		}
+
+		info := DialogInfo{Name: d.name(), Type: string(d.Type), Title: d.Title, Empty: true}
+		if q := filter.query; q != "" &&
+			!strings.Contains(strings.ToLower(info.Title), q) && !strings.Contains(strings.ToLower(info.Name), q) {
+			continue
+		}
+
+		last, err := archive.lastMessage(d.key())
+		if err != nil {
+			return DialogsResponse{}, errors.Wrap(err, "read archive")
+		}
+		if last != nil {
+			msg := last.info(archive.textFormat)
+			if last.Raw != nil {
+				msg.Text = previewText(*last.Raw, last.Entities, archive.textFormat)
+			} else {
+				msg.Text = shortText(msg.Text)
+			}
+			msg.IsUnread = d.UnreadCount > 0
+			info.LastMessage, info.Empty = &msg, false
+		}
+
+		rsp.Dialogs = append(rsp.Dialogs, info)
+		if len(rsp.Dialogs) == limit {
+			rsp.Offset = DialogsOffset{MsgID: d.TopID, Date: d.TopDate, Peer: d.inputPeer()}
+			break
+		}
+	}
+
+	return rsp, nil
+}
+
+func (c *Client) localSearch(args SearchArguments, minDate, maxDate, limit int) (SearchResponse, error) {
+	archive, err := c.localArchive()
+	if err != nil {
+		return SearchResponse{}, err
+	}
+
+	if args.Media != "" {
+		return SearchResponse{}, errors.Wrap(ErrInvalidArgument, "media filter is not supported with source=local")
+	}
+
+	if err := c.policy.checkAccess(accessRead); err != nil {
+		return SearchResponse{}, err
+	}
+
+	match := localMatch{query: args.Query, minDate: minDate, maxDate: maxDate, allowed: c.localAllowed}
+
+	var keys []peerKey
+	if args.Name != "" {
+		key, err := c.localPeer(args.Name)
+		if err != nil {
+			return SearchResponse{}, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	if args.From != "" {
+		key, err := c.localKey(args.From)
+		if err != nil {
+			return SearchResponse{}, fmt.Errorf("get sender from name: %w", err)
+		}
+
+		match.fromID = key.id
+	}
+
+	var skip int
+	if args.Offset != "" {
+		skip, err = strconv.Atoi(args.Offset)
+		if err != nil || skip < 0 {
+			return SearchResponse{}, errors.Wrapf(ErrInvalidArgument, "invalid offset %q", args.Offset)
+		}
+	}
+
+	hits, err := archive.search(keys, match)
+	if err != nil {
+		return SearchResponse{}, errors.Wrap(err, "read archive")
+	}
+
+	rsp := SearchResponse{Messages: make([]SearchMessageInfo, 0, limit)}
+	for _, hit := range hits[min(skip, len(hits)):] {
+		if len(rsp.Messages) == limit {
+			rsp.Offset = strconv.Itoa(skip + limit)
+			break
+		}
+
+		rsp.Messages = append(rsp.Messages, SearchMessageInfo{Dialog: c.localName(hit.key), MessageInfo: hit.info(archive.textFormat)})
+	}
+
+	return rsp, nil
+}
+
+func (d archivedDialog) matches(f dialogsFilter) bool {
+	if f.onlyUnread && d.UnreadCount == 0 && !d.UnreadMark {
+		return false
+	}
+
+	if f.onlyPinned && !d.Pinned {
+		return false
+	}
+
+	if f.dialogType != DialogTypeAll && d.Type != f.dialogType {
+		return false
+	}
+
+	if f.muted != "" {
+		muted := d.MuteUntil > int(time.Now().Unix())
+		if muted != (f.muted == MutedOnly) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (d archivedDialog) subject() peerSubject {
+	return peerSubject{Key: d.key(), Username: d.Username, Type: d.Type, Folder: d.Folder}
+}
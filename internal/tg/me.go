@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 
+	"github.com/gotd/td/tg"
 	mcp "github.com/metoro-io/mcp-golang"
 	"github.com/pkg/errors"
 )
@@ -18,35 +19,56 @@ type MeResponse struct {
 type EmptyArguments struct{}
 
 func (c *Client) GetMe(_ EmptyArguments) (*mcp.ToolResponse, error) {
-	var toolResponse *mcp.ToolResponse
+	response, err := c.Me()
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert response to JSON
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal response")
+	}
+
+	return mcp.NewToolResponse(mcp.NewTextContent(string(jsonData))), nil
+}
 
-	client := c.T()
-	if err := client.Run(context.Background(), func(ctx context.Context) error {
-		self, err := client.Self(ctx)
+// Me returns the logged in user.
+func (c *Client) Me() (*MeResponse, error) {
+	var response MeResponse
+
+	if err := c.run(func(ctx context.Context, api *tg.Client) error {
+		self, err := getSelf(ctx, api)
 		if err != nil {
 			return errors.Wrap(err, "failed to get self info")
 		}
 
-		// Create response
-		response := MeResponse{
+		response = MeResponse{
 			ID:        self.ID,
 			FirstName: self.FirstName,
 			LastName:  self.LastName,
 			Username:  self.Username,
 		}
 
-		// Convert response to JSON
-		jsonData, err := json.Marshal(response)
-		if err != nil {
-			return errors.Wrap(err, "failed to marshal response")
-		}
-
-		toolResponse = mcp.NewToolResponse(mcp.NewTextContent(string(jsonData)))
-
 		return nil
 	}); err != nil {
 		return nil, errors.Wrap(err, "invalid session")
 	}
 
-	return toolResponse, nil
+	return &response, nil
+}
+
+func getSelf(ctx context.Context, api *tg.Client) (*tg.User, error) {
+	users, err := api.UsersGetUsers(ctx, []tg.InputUserClass{&tg.InputUserSelf{}})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, u := range users {
+		if self, ok := u.(*tg.User); ok {
+			return self, nil
+		}
+	}
+
+	return nil, errors.New("self user not found")
 }
@@ -0,0 +1,408 @@
+package tg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/telegram/downloader"
+	"github.com/gotd/td/tg"
+	mcp "github.com/metoro-io/mcp-golang"
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultMaxDownloadSize = 50 << 20
+
+	downloadTimeout = 10 * time.Minute
+)
+
+const (
+	MediaPhoto    = "photo"
+	MediaVideo    = "video"
+	MediaRound    = "round_video"
+	MediaVoice    = "voice"
+	MediaAudio    = "audio"
+	MediaGIF      = "gif"
+	MediaSticker  = "sticker"
+	MediaDocument = "document"
+	MediaPoll     = "poll"
+	MediaGeo      = "geo"
+	MediaVenue    = "venue"
+	MediaContact  = "contact"
+	MediaWebPage  = "webpage"
+	MediaDice     = "dice"
+	MediaOther    = "other"
+)
+
+type MediaInfo struct {
+	Kind     string       `json:"kind"`
+	FileName string       `json:"file_name,omitempty"`
+	Size     int64        `json:"size,omitempty"`
+	Mime     string       `json:"mime,omitempty"`
+	Duration float64      `json:"duration,omitempty"`
+	Title    string       `json:"title,omitempty"`
+	URL      string       `json:"url,omitempty"`
+	Question string       `json:"question,omitempty"`
+	Options  []PollOption `json:"options,omitempty"`
+	Lat      float64      `json:"lat,omitempty"`
+	Long     float64      `json:"long,omitempty"`
+	Address  string       `json:"address,omitempty"`
+	Phone    string       `json:"phone,omitempty"`
+	Contact  string       `json:"contact,omitempty"`
+}
+
+type PollOption struct {
+	Text   string `json:"text"`
+	Voters int    `json:"voters,omitempty"`
+}
+
+// nolint:lll
+type DownloadArguments struct {
+	Name      string `json:"name" jsonschema:"required,description=Name of the dialog"`
+	MessageID int    `json:"message_id" jsonschema:"required,description=ID of the message with media"`
+
+	AccountArgument
+}
+
+type DownloadResponse struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	Mime string `json:"mime,omitempty"`
+}
+
+// mediaInfo describes message media, nil when message has none.
+//
+//nolint:gocyclo // one branch per media kind
+func mediaInfo(raw tg.MessageMediaClass) *MediaInfo {
+	switch m := raw.(type) {
+	case nil, *tg.MessageMediaEmpty:
+		return nil
+	case *tg.MessageMediaPhoto:
+		info := MediaInfo{Kind: MediaPhoto, Mime: "image/jpeg"}
+		if photo, ok := m.Photo.(*tg.Photo); ok {
+			_, info.Size = largestPhotoSize(photo)
+		}
+
+		return &info
+	case *tg.MessageMediaDocument:
+		doc, ok := m.Document.(*tg.Document)
+		if !ok {
+			return &MediaInfo{Kind: MediaDocument}
+		}
+
+		return documentInfo(doc)
+	case *tg.MessageMediaPoll:
+		info := MediaInfo{Kind: MediaPoll, Question: m.Poll.Question.Text}
+		voters := make(map[string]int)
+		for _, r := range m.Results.Results {
+			voters[string(r.Option)] = r.Voters
+		}
+
+		for _, a := range m.Poll.Answers {
+			info.Options = append(info.Options, PollOption{
+				Text:   a.Text.Text,
+				Voters: voters[string(a.Option)],
+			})
+		}
+
+		return &info
+	case *tg.MessageMediaGeo:
+		info := MediaInfo{Kind: MediaGeo}
+		info.Lat, info.Long = geoPoint(m.Geo)
+
+		return &info
+	case *tg.MessageMediaGeoLive:
+		info := MediaInfo{Kind: MediaGeo, Duration: float64(m.Period)}
+		info.Lat, info.Long = geoPoint(m.Geo)
+
+		return &info
+	case *tg.MessageMediaVenue:
+		info := MediaInfo{Kind: MediaVenue, Title: m.Title, Address: m.Address}
+		info.Lat, info.Long = geoPoint(m.Geo)
+
+		return &info
+	case *tg.MessageMediaContact:
+		return &MediaInfo{
+			Kind:    MediaContact,
+			Phone:   m.PhoneNumber,
+			Contact: strings.TrimSpace(m.FirstName + " " + m.LastName),
+		}
+	case *tg.MessageMediaWebPage:
+		info := MediaInfo{Kind: MediaWebPage}
+		if page, ok := m.Webpage.(*tg.WebPage); ok {
+			info.URL = page.URL
+			info.Title = page.Title
+		}
+
+		return &info
+	case *tg.MessageMediaDice:
+		return &MediaInfo{Kind: MediaDice, Title: m.Emoticon + " " + strconv.Itoa(m.Value)}
+	default:
+		return &MediaInfo{Kind: MediaOther}
+	}
+}
+
+func documentInfo(doc *tg.Document) *MediaInfo {
+	info := MediaInfo{
+		Kind: MediaDocument,
+		Size: doc.Size,
+		Mime: doc.MimeType,
+	}
+
+	for _, attr := range doc.Attributes {
+		switch a := attr.(type) {
+		case *tg.DocumentAttributeFilename:
+			info.FileName = a.FileName
+		case *tg.DocumentAttributeVideo:
+			info.Duration = a.Duration
+			if info.Kind != MediaGIF {
+				info.Kind = MediaVideo
+				if a.RoundMessage {
+					info.Kind = MediaRound
+				}
+			}
+		case *tg.DocumentAttributeAudio:
+			info.Duration = float64(a.Duration)
+			info.Kind = MediaAudio
+			if a.Voice {
+				info.Kind = MediaVoice
+			}
+			if a.Title != "" {
+				info.Title = strings.TrimSpace(a.Performer + " - " + a.Title)
+			}
+		case *tg.DocumentAttributeAnimated:
+			info.Kind = MediaGIF
+		case *tg.DocumentAttributeSticker:
+			info.Kind = MediaSticker
+			info.Title = a.Alt
+		}
+	}
+
+	return &info
+}
+
+func geoPoint(raw tg.GeoPointClass) (float64, float64) {
+	if p, ok := raw.(*tg.GeoPoint); ok {
+		return p.Lat, p.Long
+	}
+
+	return 0, 0
+}
+
+func largestPhotoSize(photo *tg.Photo) (string, int64) {
+	var (
+		sizeType string
+		size     int64
+		area     int
+	)
+	for _, s := range photo.Sizes {
+		switch v := s.(type) {
+		case *tg.PhotoSize:
+			if v.W*v.H > area {
+				sizeType, size, area = v.Type, int64(v.Size), v.W*v.H
+			}
+		case *tg.PhotoSizeProgressive:
+			if v.W*v.H > area && len(v.Sizes) > 0 {
+				sizeType, size, area = v.Type, int64(v.Sizes[len(v.Sizes)-1]), v.W*v.H
+			}
+		}
+	}
+
+	return sizeType, size
+}
+
+// mediaFile returns download location of message media with its descriptor.
+func mediaFile(raw tg.MessageMediaClass, msgID int) (tg.InputFileLocationClass, *MediaInfo, error) {
+	info := mediaInfo(raw)
+	if info == nil {
+		return nil, nil, errors.Wrapf(ErrInvalidArgument, "message %d has no media", msgID)
+	}
+
+	switch m := raw.(type) {
+	case *tg.MessageMediaPhoto:
+		photo, ok := m.Photo.(*tg.Photo)
+		if !ok {
+			return nil, nil, errors.New("photo is not available")
+		}
+
+		sizeType, _ := largestPhotoSize(photo)
+		if info.FileName == "" {
+			info.FileName = fmt.Sprintf("photo_%d.jpg", photo.ID)
+		}
+
+		return &tg.InputPhotoFileLocation{
+			ID:            photo.ID,
+			AccessHash:    photo.AccessHash,
+			FileReference: photo.FileReference,
+			ThumbSize:     sizeType,
+		}, info, nil
+	case *tg.MessageMediaDocument:
+		doc, ok := m.Document.(*tg.Document)
+		if !ok {
+			return nil, nil, errors.New("document is not available")
+		}
+
+		if info.FileName == "" {
+			info.FileName = fmt.Sprintf("%s_%d", info.Kind, doc.ID)
+			if exts, _ := mime.ExtensionsByType(doc.MimeType); len(exts) > 0 {
+				info.FileName += exts[0]
+			}
+		}
+
+		return &tg.InputDocumentFileLocation{
+			ID:            doc.ID,
+			AccessHash:    doc.AccessHash,
+			FileReference: doc.FileReference,
+		}, info, nil
+	default:
+		return nil, nil, errors.Wrapf(ErrInvalidArgument, "media %q of message %d can not be downloaded", info.Kind, msgID)
+	}
+}
+
+// DownloadMedia saves photo or document of a message into the download directory.
+func (c *Client) DownloadMedia(args DownloadArguments) (*mcp.ToolResponse, error) {
+	if c.downloadDir == "" {
+		return nil, errors.Wrap(ErrDisabled, "media download")
+	}
+
+	var rsp DownloadResponse
+	if err := c.runTimeout(downloadTimeout, func(ctx context.Context, api *tg.Client) error {
+		inputPeer, err := c.resolvePeer(ctx, api, args.Name, accessRead)
+		if err != nil {
+			return err
+		}
+
+		msg, err := getMessage(ctx, api, inputPeer, args.MessageID)
+		if err != nil {
+			return err
+		}
+
+		location, info, err := mediaFile(msg.Media, msg.ID)
+		if err != nil {
+			return err
+		}
+
+		if c.maxDownloadSize > 0 && info.Size > c.maxDownloadSize {
+			return errors.Wrapf(ErrFileTooLarge, "file size %d exceeds limit %d", info.Size, c.maxDownloadSize)
+		}
+
+		dir := filepath.Join(c.downloadDir, strconv.FormatInt(getInputPeerIDValue(inputPeer), 10))
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("mkdir(%s): %w", dir, err)
+		}
+
+		path := filepath.Join(dir, fmt.Sprintf("%d_%s", msg.ID, safeFileName(info.FileName)))
+		size, err := downloadFile(ctx, api, location, path, c.maxDownloadSize)
+		if err != nil {
+			return err
+		}
+
+		rsp = DownloadResponse{Path: path, Size: size, Mime: info.Mime}
+
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "failed to download media")
+	}
+
+	jsonData, err := json.Marshal(rsp)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal response")
+	}
+
+	return mcp.NewToolResponse(mcp.NewTextContent(string(jsonData))), nil
+}
+
+// downloadFile saves the file at location into path, failing once it grows past maxSize when it is positive.
+// Sizes of some photos are unknown in advance, so the limit is enforced while writing.
+func downloadFile(ctx context.Context, api *tg.Client, location tg.InputFileLocationClass, path string, maxSize int64) (int64, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, fmt.Errorf("create %s: %w", path, err)
+	}
+
+	w := &limitWriter{w: f, limit: maxSize}
+	_, err = downloader.NewDownloader().Download(api, location).Stream(ctx, w)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		if errors.Is(err, ErrFileTooLarge) {
+			return 0, err
+		}
+
+		return 0, fmt.Errorf("download: %w", err)
+	}
+
+	return w.n, nil
+}
+
+// limitWriter counts written bytes and fails with ErrFileTooLarge past limit, zero limit is unlimited.
+type limitWriter struct {
+	w     io.Writer
+	n     int64
+	limit int64
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if l.limit > 0 && l.n+int64(len(p)) > l.limit {
+		return 0, errors.Wrapf(ErrFileTooLarge, "file exceeds limit %d", l.limit)
+	}
+
+	n, err := l.w.Write(p)
+	l.n += int64(n)
+
+	return n, err
+}
+
+// getMessage loads a single message of the dialog by id.
+func getMessage(ctx context.Context, api *tg.Client, inputPeer tg.InputPeerClass, id int) (*tg.Message, error) {
+	ids := []tg.InputMessageClass{&tg.InputMessageID{ID: id}}
+
+	var (
+		raw tg.MessagesMessagesClass
+		err error
+	)
+	if ch, ok := inputPeer.(*tg.InputPeerChannel); ok {
+		raw, err = api.ChannelsGetMessages(ctx, &tg.ChannelsGetMessagesRequest{
+			Channel: &tg.InputChannel{ChannelID: ch.ChannelID, AccessHash: ch.AccessHash},
+			ID:      ids,
+		})
+	} else {
+		raw, err = api.MessagesGetMessages(ctx, ids)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get message: %w", err)
+	}
+
+	h, err := newHistory(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range h.Messages {
+		// message ids of users and chats are global, so make sure it belongs to the dialog
+		if msg, ok := m.(*tg.Message); ok && msg.ID == id && getPeerID(msg.PeerID) == getInputPeerIDValue(inputPeer) {
+			return msg, nil
+		}
+	}
+
+	return nil, errors.Wrapf(ErrInvalidArgument, "message %d not found", id)
+}
+
+func safeFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" || name == ".." {
+		return "file"
+	}
+
+	return name
+}
@@ -0,0 +1,55 @@
+package tg
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+)
+
+func TestDownloadMedia(t *testing.T) {
+	f := newFixture()
+	f.Handle(tg.UploadGetFileRequestTypeID, func(context.Context, bin.Encoder) (bin.Encoder, error) {
+		return &tg.UploadFile{Type: &tg.StorageFileJpeg{}, Bytes: []byte("0123456789")}, nil
+	})
+	// the size of the photo is not known before downloading it
+	m := f.alice.Message(aliceID, 0, "photo")
+	m.SetMedia(&tg.MessageMediaPhoto{Photo: &tg.Photo{
+		ID:    77,
+		Sizes: []tg.PhotoSizeClass{&tg.PhotoSize{Type: "x", W: 800, H: 600}},
+	}})
+	args := DownloadArguments{Name: "alice", MessageID: m.ID}
+
+	t.Run("disabled", func(t *testing.T) {
+		c := newTestClient(t, f.Fake)
+
+		_, err := c.DownloadMedia(args)
+		requireCode(t, err, CodeDisabled)
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		dir := t.TempDir()
+		c := newTestClient(t, f.Fake, WithDownloads(dir, 4))
+
+		_, err := c.DownloadMedia(args)
+		requireCode(t, err, CodeFileTooLarge)
+
+		files, _ := filepath.Glob(filepath.Join(dir, "*", "*"))
+		if len(files) != 0 {
+			t.Fatalf("partial files left: %v", files)
+		}
+	})
+
+	t.Run("downloaded", func(t *testing.T) {
+		c := newTestClient(t, f.Fake, WithDownloads(t.TempDir(), 10))
+
+		rsp := decode[DownloadResponse](t)(c.DownloadMedia(args))
+		data, err := os.ReadFile(rsp.Path)
+		if err != nil || string(data) != "0123456789" || rsp.Size != 10 {
+			t.Fatalf("downloaded %+v: %q, %v", rsp, data, err)
+		}
+	})
+}
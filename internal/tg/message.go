@@ -0,0 +1,84 @@
+package tg
+
+import (
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+type ReplyInfo struct {
+	MsgID  int    `json:"msg_id,omitempty"`
+	TopID  int    `json:"top_id,omitempty"`
+	Dialog string `json:"dialog,omitempty"`
+	Quote  string `json:"quote,omitempty"`
+}
+
+type ForwardInfo struct {
+	From   string `json:"from,omitempty"`
+	When   string `json:"when"`
+	PostID int    `json:"post_id,omitempty"`
+}
+
+// peerNamer resolves a peer to the name used by tools, empty when the peer is unknown.
+type peerNamer func(tg.PeerClass) string
+
+// fillMessageMeta adds id, direction, edit, reply, forward and media details of m to info.
+func fillMessageMeta(info *MessageInfo, m *tg.Message, name peerNamer) {
+	info.ID = m.ID
+	info.Out = m.Out
+
+	if editDate, ok := m.GetEditDate(); ok && !m.EditHide {
+		info.Edited = time.Unix(int64(editDate), 0).Format(time.DateTime)
+	}
+
+	if replyTo, ok := m.GetReplyTo(); ok {
+		info.ReplyTo = replyInfo(replyTo, name)
+	}
+
+	if fwd, ok := m.GetFwdFrom(); ok {
+		info.Forward = forwardInfo(fwd, name)
+	}
+
+	if media, ok := m.GetMedia(); ok {
+		info.Media = mediaInfo(media)
+	}
+}
+
+func replyInfo(raw tg.MessageReplyHeaderClass, name peerNamer) *ReplyInfo {
+	h, ok := raw.(*tg.MessageReplyHeader)
+	if !ok {
+		return nil
+	}
+
+	info := ReplyInfo{
+		MsgID: h.ReplyToMsgID,
+		TopID: h.ReplyToTopID,
+		Quote: h.QuoteText,
+	}
+
+	if peer, ok := h.GetReplyToPeerID(); ok {
+		info.Dialog = name(peer)
+	}
+
+	if info == (ReplyInfo{}) {
+		return nil
+	}
+
+	return &info
+}
+
+func forwardInfo(h tg.MessageFwdHeader, name peerNamer) *ForwardInfo {
+	info := ForwardInfo{
+		From:   h.FromName,
+		When:   time.Unix(int64(h.Date), 0).Format(time.DateTime),
+		PostID: h.ChannelPost,
+	}
+
+	if from, ok := h.GetFromID(); ok {
+		if n := name(from); n != "" {
+			info.From = n
+		}
+	}
+
+	return &info
+}
@@ -0,0 +1,467 @@
+package tg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"github.com/rs/zerolog/log"
+)
+
+// peerRecord is a user, chat or channel seen in any API response.
+type peerRecord struct {
+	ID         int64      `json:"id"`
+	AccessHash int64      `json:"access_hash,omitempty"`
+	Username   string     `json:"username,omitempty"`
+	Title      string     `json:"title,omitempty"`
+	Type       DialogType `json:"type"`
+	Self       bool       `json:"self,omitempty"`
+}
+
+type peerKind int
+
+const (
+	peerKindUser peerKind = iota
+	peerKindChat
+	peerKindChannel
+)
+
+type peerKey struct {
+	kind peerKind
+	id   int64
+}
+
+func (r peerRecord) key() peerKey {
+	switch r.Type {
+	case DialogTypeChat:
+		return peerKey{kind: peerKindChat, id: r.ID}
+	case DialogTypeChannel:
+		return peerKey{kind: peerKindChannel, id: r.ID}
+	default:
+		return peerKey{kind: peerKindUser, id: r.ID}
+	}
+}
+
+func (r peerRecord) inputPeer() tg.InputPeerClass {
+	switch r.key().kind {
+	case peerKindChat:
+		return &tg.InputPeerChat{ChatID: r.ID}
+	case peerKindChannel:
+		return &tg.InputPeerChannel{ChannelID: r.ID, AccessHash: r.AccessHash}
+	default:
+		return &tg.InputPeerUser{UserID: r.ID, AccessHash: r.AccessHash}
+	}
+}
+
+// name returns the dialog name tools accept for the peer.
+func (r peerRecord) name() string {
+	switch {
+	case r.Self:
+		return selfName
+	case r.Username != "":
+		return r.Username
+	case r.key().kind == peerKindChat:
+		return fmt.Sprintf("cht[%d]", r.ID)
+	case r.key().kind == peerKindChannel:
+		return fmt.Sprintf("chn[%d:%d]", r.ID, r.AccessHash)
+	default:
+		return fmt.Sprintf("usr[%d]", r.ID)
+	}
+}
+
+// peerStore keeps access hashes of known peers in a file next to the session,
+// so names and offsets resolve without extra round trips.
+type peerStore struct {
+	path   string
+	sealer *sealer
+
+	mu        sync.RWMutex
+	peers     map[peerKey]peerRecord
+	usernames map[string]peerKey
+	// folders of dialogs seen in listings and folder updates, kept in memory only
+	folders map[peerKey]int
+}
+
+// peersPath returns peer store location for the session file.
+func peersPath(sessionPath string) string {
+	if sessionPath == "" {
+		return ""
+	}
+
+	return strings.TrimSuffix(sessionPath, filepath.Ext(sessionPath)) + ".peers.json"
+}
+
+func newPeerStore(path string, sealer *sealer) *peerStore {
+	s := &peerStore{
+		path:      path,
+		sealer:    sealer,
+		peers:     make(map[peerKey]peerRecord),
+		usernames: make(map[string]peerKey),
+		folders:   make(map[peerKey]int),
+	}
+
+	if err := s.load(); err != nil {
+		log.Warn().Err(err).Str("path", path).Msg("failed to load peer cache, starting empty")
+	}
+
+	return s
+}
+
+func (s *peerStore) load() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := readSealed(s.path, s.sealer)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read peers: %w", err)
+	}
+
+	var records []peerRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return fmt.Errorf("parse peers: %w", err)
+	}
+
+	for _, r := range records {
+		s.set(r)
+	}
+
+	return nil
+}
+
+func (s *peerStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	records := make([]peerRecord, 0, len(s.peers))
+	for _, r := range s.peers {
+		records = append(records, r)
+	}
+
+	data, err := json.Marshal(records)
+	if err != nil {
+		return fmt.Errorf("marshal peers: %w", err)
+	}
+
+	return writeSealed(s.path, data, s.sealer)
+}
+
+// set stores r and reports whether anything changed, caller holds the lock.
+func (s *peerStore) set(r peerRecord) bool {
+	key := r.key()
+	old, ok := s.peers[key]
+	if ok && old == r {
+		return false
+	}
+
+	if ok && old.Username != "" && s.usernames[strings.ToLower(old.Username)] == key {
+		delete(s.usernames, strings.ToLower(old.Username))
+	}
+
+	s.peers[key] = r
+	if r.Username != "" {
+		s.usernames[strings.ToLower(r.Username)] = key
+	}
+
+	return true
+}
+
+// apply records users and chats of a response, persisting the store when it changed.
+func (s *peerStore) apply(users []tg.UserClass, chats []tg.ChatClass) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var changed bool
+	for _, u := range users {
+		if user, ok := u.(*tg.User); ok {
+			changed = s.set(s.userRecord(user)) || changed
+		}
+	}
+
+	for _, c := range chats {
+		if r, ok := s.chatRecord(c); ok {
+			changed = s.set(r) || changed
+		}
+	}
+
+	if !changed {
+		return
+	}
+
+	if err := s.save(); err != nil {
+		log.Warn().Err(err).Str("path", s.path).Msg("failed to save peer cache")
+	}
+}
+
+func (s *peerStore) userRecord(u *tg.User) peerRecord {
+	r := peerRecord{
+		ID:         u.ID,
+		AccessHash: u.AccessHash,
+		Username:   u.Username,
+		Title:      getTitle(u),
+		Type:       DialogTypeUser,
+		Self:       u.Self,
+	}
+	if u.Bot {
+		r.Type = DialogTypeBot
+	}
+
+	// access hash of min constructors is not valid for input peers
+	if u.Min {
+		r.AccessHash = s.peers[r.key()].AccessHash
+	}
+
+	return r
+}
+
+func (s *peerStore) chatRecord(raw tg.ChatClass) (peerRecord, bool) {
+	switch c := raw.(type) {
+	case *tg.Chat:
+		return peerRecord{ID: c.ID, Title: c.Title, Type: DialogTypeChat}, true
+	case *tg.ChatForbidden:
+		return peerRecord{ID: c.ID, Title: c.Title, Type: DialogTypeChat}, true
+	case *tg.Channel:
+		r := peerRecord{
+			ID:         c.ID,
+			AccessHash: c.AccessHash,
+			Username:   c.Username,
+			Title:      c.Title,
+			Type:       DialogTypeChannel,
+		}
+		if c.Min {
+			r.AccessHash = s.peers[r.key()].AccessHash
+		}
+
+		return r, true
+	case *tg.ChannelForbidden:
+		return peerRecord{ID: c.ID, AccessHash: c.AccessHash, Title: c.Title, Type: DialogTypeChannel}, true
+	default:
+		return peerRecord{}, false
+	}
+}
+
+// byUsername returns input peer of a known username, leading @ is ignored.
+func (s *peerStore) byUsername(username string) (tg.InputPeerClass, bool) {
+	s.mu.RLock()
+	key, ok := s.usernames[strings.ToLower(strings.TrimPrefix(username, "@"))]
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, false
+	}
+
+	return s.byKey(key)
+}
+
+// byKey returns input peer of a known peer, users and channels need an access hash.
+func (s *peerStore) byKey(key peerKey) (tg.InputPeerClass, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	r, ok := s.peers[key]
+	if !ok || key.kind != peerKindChat && r.AccessHash == 0 {
+		return nil, false
+	}
+
+	return r.inputPeer(), true
+}
+
+// record returns the stored record of a peer.
+func (s *peerStore) record(key peerKey) (peerRecord, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	r, ok := s.peers[key]
+
+	return r, ok
+}
+
+// folder returns the folder of the dialog with the peer, false when no listing showed it yet.
+func (s *peerStore) folder(key peerKey) (int, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	folder, ok := s.folders[key]
+
+	return folder, ok
+}
+
+func (s *peerStore) setFolder(key peerKey, folder int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.folders[key] = folder
+}
+
+// byPeer returns input peer with access hash for p.
+func (s *peerStore) byPeer(p tg.PeerClass) (tg.InputPeerClass, bool) {
+	switch v := p.(type) {
+	case *tg.PeerUser:
+		return s.byKey(peerKey{peerKindUser, v.UserID})
+	case *tg.PeerChat:
+		return s.byKey(peerKey{peerKindChat, v.ChatID})
+	case *tg.PeerChannel:
+		return s.byKey(peerKey{peerKindChannel, v.ChannelID})
+	default:
+		return nil, false
+	}
+}
+
+// self returns input peer of the logged in user when it was seen already.
+func (s *peerStore) self() (tg.InputPeerClass, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, r := range s.peers {
+		if r.Self && r.AccessHash != 0 {
+			return r.inputPeer(), true
+		}
+	}
+
+	return nil, false
+}
+
+// records returns a snapshot of all known peers.
+func (s *peerStore) records() []peerRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	records := make([]peerRecord, 0, len(s.peers))
+	for _, r := range s.peers {
+		records = append(records, r)
+	}
+
+	return records
+}
+
+// withAccessHash fills missing access hash of user and channel peers from the store.
+func (s *peerStore) withAccessHash(p tg.InputPeerClass) tg.InputPeerClass {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	switch v := p.(type) {
+	case *tg.InputPeerUser:
+		if v.AccessHash == 0 {
+			return &tg.InputPeerUser{UserID: v.UserID, AccessHash: s.peers[peerKey{peerKindUser, v.UserID}].AccessHash}
+		}
+	case *tg.InputPeerChannel:
+		if v.AccessHash == 0 {
+			return &tg.InputPeerChannel{ChannelID: v.ChannelID, AccessHash: s.peers[peerKey{peerKindChannel, v.ChannelID}].AccessHash}
+		}
+	}
+
+	return p
+}
+
+// Handle implements telegram.Middleware, recording entities of every response.
+func (s *peerStore) Handle(next tg.Invoker) telegram.InvokeFunc {
+	return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		if err := next.Invoke(ctx, input, output); err != nil {
+			return err
+		}
+
+		s.apply(responseEntities(output))
+		for _, raw := range responseDialogs(output) {
+			d, ok := raw.(*tg.Dialog)
+			if !ok {
+				continue
+			}
+
+			if key, ok := peerKeyOf(d.Peer); ok {
+				s.setFolder(key, d.FolderID)
+			}
+		}
+
+		return nil
+	}
+}
+
+// responseDialogs extracts dialogs of a decoded response.
+func responseDialogs(output bin.Decoder) []tg.DialogClass {
+	switch v := output.(type) {
+	case *tg.MessagesDialogsBox:
+		if d, ok := v.Dialogs.AsModified(); ok {
+			return d.GetDialogs()
+		}
+	case *tg.MessagesPeerDialogs:
+		return v.Dialogs
+	}
+
+	return nil
+}
+
+// responseEntities extracts users and chats attached to a decoded response.
+func responseEntities(output bin.Decoder) ([]tg.UserClass, []tg.ChatClass) {
+	var value any = output
+	switch v := output.(type) {
+	case *tg.MessagesMessagesBox:
+		value = v.Messages
+	case *tg.MessagesDialogsBox:
+		value = v.Dialogs
+	case *tg.MessagesChatsBox:
+		value = v.Chats
+	case *tg.UpdatesBox:
+		value = v.Updates
+	case *tg.UserClassVector:
+		return v.Elems, nil
+	case *tg.ChatInviteBox:
+		if c, ok := v.ChatInvite.(interface{ GetChat() tg.ChatClass }); ok {
+			return nil, []tg.ChatClass{c.GetChat()}
+		}
+	}
+
+	var (
+		users []tg.UserClass
+		chats []tg.ChatClass
+	)
+	if u, ok := value.(interface{ GetUsers() []tg.UserClass }); ok {
+		users = u.GetUsers()
+	}
+	if c, ok := value.(interface{ GetChats() []tg.ChatClass }); ok {
+		chats = c.GetChats()
+	}
+
+	return users, chats
+}
+
+// GetChannelAccessHash implements updates.ChannelAccessHasher, the store holds a single account.
+func (s *peerStore) GetChannelAccessHash(_ context.Context, _, channelID int64) (int64, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	r, ok := s.peers[peerKey{peerKindChannel, channelID}]
+	if !ok || r.AccessHash == 0 {
+		return 0, false, nil
+	}
+
+	return r.AccessHash, true, nil
+}
+
+// SetChannelAccessHash implements updates.ChannelAccessHasher.
+func (s *peerStore) SetChannelAccessHash(_ context.Context, _, channelID, accessHash int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.peers[peerKey{peerKindChannel, channelID}]
+	if !ok {
+		r = peerRecord{ID: channelID, Type: DialogTypeChannel}
+	}
+	r.AccessHash = accessHash
+
+	if !s.set(r) {
+		return nil
+	}
+
+	return s.save()
+}
@@ -0,0 +1,346 @@
+package tg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gotd/td/tg"
+	"github.com/pkg/errors"
+)
+
+// ErrPolicyDenied is returned when the policy forbids access to a dialog or a write action.
+var ErrPolicyDenied = errors.New("denied by policy")
+
+// Policy restricts which dialogs tools may access and whether they may change anything.
+//
+// Rules are matched against a dialog as follows:
+//   - "username" or "@username": dialog username (case-insensitive)
+//   - "usr[ID]", "cht[ID]", "chn[ID]" or "chn[ID:HASH]": user, chat or channel id, as printed by tg_dialogs
+//   - "id:ID": peer id of any kind, users, chats and channels have separate id spaces so it may match several
+//   - "type:T": dialog type (user, bot, chat, channel)
+//   - "folder:N": folder id (0 is main list, 1 is archive)
+//
+// A dialog is allowed when no deny rule matches it and either Allow is empty or one of its rules matches.
+type Policy struct {
+	ReadOnly bool     `json:"read_only,omitempty"`
+	Allow    []string `json:"allow,omitempty"`
+	Deny     []string `json:"deny,omitempty"`
+
+	allow []policyRule
+	deny  []policyRule
+}
+
+type access int
+
+const (
+	accessRead access = iota
+	accessWrite
+)
+
+type policyRule struct {
+	kind  string
+	value string
+	id    int64
+	peer  peerKey
+}
+
+const (
+	ruleUsername = "username"
+	ruleID       = "id"
+	rulePeer     = "peer"
+	ruleType     = "type"
+	ruleFolder   = "folder"
+)
+
+// peerSubject holds dialog attributes used for policy matching.
+type peerSubject struct {
+	Key      peerKey
+	Username string
+	Type     DialogType
+	Folder   int
+}
+
+// LoadPolicy reads policy from JSON file. Missing file yields an empty policy.
+func LoadPolicy(path string) (*Policy, error) {
+	var p Policy
+	if path == "" {
+		return &p, p.compile()
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &p, p.compile()
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "read policy(%s)", path)
+	}
+
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, errors.Wrapf(err, "parse policy(%s)", path)
+	}
+
+	return &p, p.compile()
+}
+
+// Merge adds flag-provided settings on top of file settings: read-only is set by either,
+// deny rules of both apply and allow rules are joined.
+func (p *Policy) Merge(readOnly bool, allow, deny []string) error {
+	p.ReadOnly = p.ReadOnly || readOnly
+	p.Allow = append(p.Allow, allow...)
+	p.Deny = append(p.Deny, deny...)
+
+	return p.compile()
+}
+
+func (p *Policy) compile() error {
+	var err error
+	if p.allow, err = parseRules(p.Allow); err != nil {
+		return errors.Wrap(err, "allow")
+	}
+	if p.deny, err = parseRules(p.Deny); err != nil {
+		return errors.Wrap(err, "deny")
+	}
+
+	return nil
+}
+
+// restricted reports whether dialog attributes are needed to make a decision.
+func (p *Policy) restricted() bool {
+	return p != nil && (len(p.allow) > 0 || len(p.deny) > 0)
+}
+
+// hasFolderRules reports whether any rule matches on folder, so subjects of unknown folder can't be decided.
+func (p *Policy) hasFolderRules() bool {
+	if p == nil {
+		return false
+	}
+
+	for _, r := range slices.Concat(p.allow, p.deny) {
+		if r.kind == ruleFolder {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *Policy) checkAccess(a access) error {
+	if p != nil && p.ReadOnly && a == accessWrite {
+		return errors.Wrap(ErrPolicyDenied, "server is in read-only mode")
+	}
+
+	return nil
+}
+
+func (p *Policy) allows(s peerSubject) bool {
+	if p == nil {
+		return true
+	}
+
+	for _, r := range p.deny {
+		if r.match(s) {
+			return false
+		}
+	}
+
+	if len(p.allow) == 0 {
+		return true
+	}
+
+	for _, r := range p.allow {
+		if r.match(s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseRules(raw []string) ([]policyRule, error) {
+	rules := make([]policyRule, 0, len(raw))
+	for _, r := range raw {
+		rule, err := parseRule(strings.TrimSpace(r))
+		if err != nil {
+			return nil, err
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// customPeerKinds maps prefixes of custom dialog names onto peer kinds.
+var customPeerKinds = map[string]peerKind{
+	"usr[": peerKindUser,
+	"cht[": peerKindChat,
+	"chn[": peerKindChannel,
+}
+
+func parseRule(raw string) (policyRule, error) {
+	if raw == "" {
+		return policyRule{}, errors.New("empty rule")
+	}
+
+	if kind, ok := customPeerKinds[raw[:min(len(raw), 4)]]; ok && strings.HasSuffix(raw, "]") {
+		idPart, _, _ := strings.Cut(strings.TrimSuffix(raw[4:], "]"), ":")
+		id, err := strconv.ParseInt(idPart, 10, 64)
+		if err != nil {
+			return policyRule{}, fmt.Errorf("invalid rule %q: %w", raw, err)
+		}
+
+		return policyRule{kind: rulePeer, peer: peerKey{kind, id}}, nil
+	}
+
+	switch {
+	case strings.HasPrefix(raw, "id:"):
+		id, err := strconv.ParseInt(strings.TrimPrefix(raw, "id:"), 10, 64)
+		if err != nil {
+			return policyRule{}, fmt.Errorf("invalid rule %q: %w", raw, err)
+		}
+
+		return policyRule{kind: ruleID, id: id}, nil
+	case strings.HasPrefix(raw, "type:"):
+		t := DialogType(strings.TrimPrefix(raw, "type:"))
+		switch t {
+		case DialogTypeUser, DialogTypeBot, DialogTypeChat, DialogTypeChannel:
+		default:
+			return policyRule{}, fmt.Errorf("invalid rule %q: unknown dialog type", raw)
+		}
+
+		return policyRule{kind: ruleType, value: string(t)}, nil
+	case strings.HasPrefix(raw, "folder:"):
+		folder, err := strconv.ParseInt(strings.TrimPrefix(raw, "folder:"), 10, 64)
+		if err != nil {
+			return policyRule{}, fmt.Errorf("invalid rule %q: %w", raw, err)
+		}
+
+		return policyRule{kind: ruleFolder, id: folder}, nil
+	default:
+		return policyRule{kind: ruleUsername, value: strings.ToLower(strings.TrimPrefix(raw, "@"))}, nil
+	}
+}
+
+func (r policyRule) match(s peerSubject) bool {
+	switch r.kind {
+	case ruleUsername:
+		return s.Username != "" && strings.ToLower(s.Username) == r.value
+	case ruleID:
+		return s.Key.id == r.id
+	case rulePeer:
+		return s.Key == r.peer
+	case ruleType:
+		return string(s.Type) == r.value
+	case ruleFolder:
+		return int64(s.Folder) == r.id
+	default:
+		return false
+	}
+}
+
+// resolvePeer resolves dialog name and enforces policy before any further API call on it.
+func (c *Client) resolvePeer(ctx context.Context, api *tg.Client, name string, a access) (tg.InputPeerClass, error) {
+	if err := c.policy.checkAccess(a); err != nil {
+		return nil, err
+	}
+
+	inputPeer, err := c.inputPeerFromName(ctx, api, name)
+	if err != nil {
+		return nil, fmt.Errorf("get inputPeer from name: %w", err)
+	}
+
+	if !c.policy.restricted() {
+		return inputPeer, nil
+	}
+
+	subject, err := c.peerSubjectOf(ctx, api, inputPeer)
+	if err != nil {
+		return nil, errors.Wrap(err, "check policy")
+	}
+
+	if !c.policy.allows(subject) {
+		return nil, errors.Wrapf(ErrPolicyDenied, "dialog %q", name)
+	}
+
+	return inputPeer, nil
+}
+
+// peerSubjectOf loads dialog attributes of the peer, falling back to the peer cache when it is not in dialog list.
+func (c *Client) peerSubjectOf(ctx context.Context, api *tg.Client, inputPeer tg.InputPeerClass) (peerSubject, error) {
+	subjects, err := c.peerSubjects(ctx, api, []tg.InputPeerClass{inputPeer})
+	if err != nil {
+		return peerSubject{}, err
+	}
+
+	key, _ := inputPeerKey(inputPeer)
+
+	return subjects[key], nil
+}
+
+// peerSubjects loads dialog attributes of several peers with a single request.
+// Peers without a dialog, e.g. a user found by username and never written to, get username and type from the peer cache.
+func (c *Client) peerSubjects(ctx context.Context, api *tg.Client, inputPeers []tg.InputPeerClass) (map[peerKey]peerSubject, error) {
+	subjects := make(map[peerKey]peerSubject, len(inputPeers))
+	dialogPeers := make([]tg.InputDialogPeerClass, 0, len(inputPeers))
+	for _, p := range inputPeers {
+		key, _ := inputPeerKey(p)
+		subjects[key] = c.knownSubject(key)
+		dialogPeers = append(dialogPeers, &tg.InputDialogPeer{Peer: p})
+	}
+
+	if len(dialogPeers) == 0 {
+		return subjects, nil
+	}
+
+	pd, err := api.MessagesGetPeerDialogs(ctx, dialogPeers)
+	if err != nil {
+		return nil, errors.Wrap(err, "get peer dialogs")
+	}
+
+	d, err := newDialogs(&tg.MessagesDialogs{
+		Dialogs:  pd.Dialogs,
+		Messages: pd.Messages,
+		Chats:    pd.Chats,
+		Users:    pd.Users,
+	}, dialogsFilter{}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dItem := range d.Dialogs {
+		if dialogItem, ok := dItem.(*tg.Dialog); ok {
+			s := d.subject(dialogItem)
+			subjects[s.Key] = s
+		}
+	}
+
+	return subjects, nil
+}
+
+// knownSubject builds policy subject from the peer cache, folder is unknown without a dialog.
+func (c *Client) knownSubject(key peerKey) peerSubject {
+	s := peerSubject{Key: key, Type: DialogTypeUnknown}
+	if r, ok := c.peers.record(key); ok {
+		s.Username, s.Type = r.Username, r.Type
+	}
+
+	return s
+}
+
+func getInputPeerIDValue(p tg.InputPeerClass) int64 {
+	switch v := p.(type) {
+	case *tg.InputPeerUser:
+		return v.UserID
+	case *tg.InputPeerChat:
+		return v.ChatID
+	case *tg.InputPeerChannel:
+		return v.ChannelID
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,134 @@
+package tg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPolicyRules(t *testing.T) {
+	alice := peerSubject{Key: peerKey{peerKindUser, 10}, Username: "Alice", Type: DialogTypeUser}
+	bot := peerSubject{Key: peerKey{peerKindUser, 12}, Username: "helper_bot", Type: DialogTypeBot}
+	team := peerSubject{Key: peerKey{peerKindChat, 20}, Type: DialogTypeChat}
+	news := peerSubject{Key: peerKey{peerKindChannel, 30}, Username: "daily_news", Type: DialogTypeChannel, Folder: 1}
+
+	tests := []struct {
+		rule string
+		want [4]bool
+	}{
+		{"alice", [4]bool{true, false, false, false}},
+		{"@ALICE", [4]bool{true, false, false, false}},
+		{"type:bot", [4]bool{false, true, false, false}},
+		{"type:chat", [4]bool{false, false, true, false}},
+		{"folder:0", [4]bool{true, true, true, false}},
+		{"folder:1", [4]bool{false, false, false, true}},
+		{"id:20", [4]bool{false, false, true, false}},
+		// dialogs without username never match a username rule
+		{"cht", [4]bool{false, false, false, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			r, err := parseRule(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, s := range []peerSubject{alice, bot, team, news} {
+				if got := r.match(s); got != tt.want[i] {
+					t.Fatalf("match(%+v) = %t, want %t", s.Key, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseRuleInvalid(t *testing.T) {
+	tests := []struct {
+		rule string
+		want string
+	}{
+		{"", "empty rule"},
+		{"type:group", "unknown dialog type"},
+		{"id:abc", "invalid syntax"},
+		{"folder:x", "invalid syntax"},
+		{"chn[abc]", "invalid syntax"},
+		{"usr[]", "invalid syntax"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			_, err := parseRule(tt.rule)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("parseRule(%q) error = %v, want %q", tt.rule, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyRuleKinds(t *testing.T) {
+	user := peerSubject{Key: peerKey{peerKindUser, 123}, Type: DialogTypeUser}
+	chat := peerSubject{Key: peerKey{peerKindChat, 123}, Type: DialogTypeChat}
+	channel := peerSubject{Key: peerKey{peerKindChannel, 123}, Type: DialogTypeChannel}
+
+	tests := []struct {
+		rule string
+		want [3]bool
+	}{
+		{"usr[123]", [3]bool{true, false, false}},
+		{"cht[123]", [3]bool{false, true, false}},
+		{"chn[123]", [3]bool{false, false, true}},
+		{"chn[123:456]", [3]bool{false, false, true}},
+		{"id:123", [3]bool{true, true, true}},
+		{"chn[124]", [3]bool{false, false, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			r, err := parseRule(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, s := range []peerSubject{user, chat, channel} {
+				if got := r.match(s); got != tt.want[i] {
+					t.Fatalf("match(%+v) = %t, want %t", s.Key, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPolicyMerge(t *testing.T) {
+	alice := peerSubject{Key: peerKey{peerKindUser, 10}, Username: "alice", Type: DialogTypeUser}
+	bob := peerSubject{Key: peerKey{peerKindUser, 11}, Username: "bob", Type: DialogTypeUser}
+	news := peerSubject{Key: peerKey{peerKindChannel, 30}, Username: "daily_news", Type: DialogTypeChannel}
+
+	tests := []struct {
+		name        string
+		file, flags Policy
+		readOnly    bool
+		allowed     [3]bool
+	}{
+		{"empty", Policy{}, Policy{}, false, [3]bool{true, true, true}},
+		{"read-only flag", Policy{}, Policy{ReadOnly: true}, true, [3]bool{true, true, true}},
+		{"read-only file", Policy{ReadOnly: true}, Policy{}, true, [3]bool{true, true, true}},
+		{"deny of both", Policy{Deny: []string{"alice"}}, Policy{Deny: []string{"type:channel"}}, false, [3]bool{false, true, false}},
+		{"allow joined", Policy{Allow: []string{"alice"}}, Policy{Allow: []string{"bob"}}, false, [3]bool{true, true, false}},
+		{"allow flag only", Policy{}, Policy{Allow: []string{"bob"}}, false, [3]bool{false, true, false}},
+		{"flag deny beats file allow", Policy{Allow: []string{"type:user"}}, Policy{Deny: []string{"alice"}}, false, [3]bool{false, true, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.file
+			if err := p.Merge(tt.flags.ReadOnly, tt.flags.Allow, tt.flags.Deny); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := p.checkAccess(accessWrite) != nil; got != tt.readOnly {
+				t.Fatalf("read-only = %t, want %t", got, tt.readOnly)
+			}
+			for i, s := range []peerSubject{alice, bob, news} {
+				if got := p.allows(s); got != tt.allowed[i] {
+					t.Fatalf("allows(%s) = %t, want %t", s.Username, got, tt.allowed[i])
+				}
+			}
+		})
+	}
+}
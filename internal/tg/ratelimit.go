@@ -0,0 +1,187 @@
+package tg
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tdp"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/time/rate"
+)
+
+const (
+	DefaultRate         = 10
+	DefaultMaxFloodWait = 30 * time.Second
+
+	maxFloodRetries = 3
+)
+
+// RateLimit configures API call throttling and FLOOD_WAIT handling.
+type RateLimit struct {
+	// Rate is the global number of requests per second, zero disables the limit. Reads and sends of all dialogs,
+	// tg_unread included, share this bucket; there is no per-dialog bucket, so reading a chat never delays the reply.
+	Rate float64
+	// Methods overrides rate of single methods, e.g. "messages.getHistory": 2.
+	Methods map[string]float64
+	// MaxFloodWait is the longest FLOOD_WAIT slept and retried, longer ones are returned as RetryAfterError.
+	MaxFloodWait time.Duration
+}
+
+// ParseMethodRates parses "method=rate" pairs such as "messages.search=0.5".
+func ParseMethodRates(pairs []string) (map[string]float64, error) {
+	rates := make(map[string]float64, len(pairs))
+	for _, pair := range pairs {
+		method, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid method rate %q: use method=rate", pair)
+		}
+
+		r, err := strconv.ParseFloat(value, 64)
+		if err != nil || r < 0 {
+			return nil, fmt.Errorf("invalid method rate %q: rate must be a non-negative number", pair)
+		}
+
+		rates[strings.TrimSpace(method)] = r
+	}
+
+	return rates, nil
+}
+
+// RetryAfterError is returned when Telegram asks to wait longer than the client is willing to sleep.
+type RetryAfterError struct {
+	Method string
+	After  time.Duration
+}
+
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("telegram rate limit on %s: retry after %d seconds", e.Method, int(e.After.Round(time.Second).Seconds()))
+}
+
+// rateLimiter is a telegram.Middleware throttling calls and retrying short flood waits.
+type rateLimiter struct {
+	global       *rate.Limiter
+	methods      map[string]*rate.Limiter
+	maxFloodWait time.Duration
+
+	mu sync.Mutex
+	// blocked holds the time a method is flood waited until
+	blocked map[string]time.Time
+}
+
+func newRateLimiter(cfg RateLimit) *rateLimiter {
+	l := &rateLimiter{
+		global:       newLimiter(cfg.Rate),
+		methods:      make(map[string]*rate.Limiter, len(cfg.Methods)),
+		maxFloodWait: cfg.MaxFloodWait,
+		blocked:      make(map[string]time.Time),
+	}
+	for method, r := range cfg.Methods {
+		l.methods[method] = newLimiter(r)
+	}
+
+	return l
+}
+
+func newLimiter(r float64) *rate.Limiter {
+	if r <= 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+
+	return rate.NewLimiter(rate.Limit(r), max(1, int(r)))
+}
+
+// Handle implements telegram.Middleware.
+func (l *rateLimiter) Handle(next tg.Invoker) telegram.InvokeFunc {
+	return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		method := methodName(input)
+
+		for attempt := 0; ; attempt++ {
+			if err := l.wait(ctx, method); err != nil {
+				return err
+			}
+
+			err := next.Invoke(ctx, input, output)
+			d, ok := tgerr.AsFloodWait(err)
+			if !ok {
+				return err
+			}
+
+			l.block(method, d)
+			if d > l.maxFloodWait || attempt >= maxFloodRetries {
+				return &RetryAfterError{Method: method, After: d}
+			}
+
+			log.Warn().Str("method", method).Dur("wait", d).Msg("flood wait, retrying")
+		}
+	}
+}
+
+// wait blocks until the method may be called, failing fast when a flood wait is too long.
+func (l *rateLimiter) wait(ctx context.Context, method string) error {
+	if left := l.blockedFor(method); left > 0 {
+		if left > l.maxFloodWait {
+			return &RetryAfterError{Method: method, After: left}
+		}
+
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < left {
+			return &RetryAfterError{Method: method, After: left}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(left):
+		}
+	}
+
+	if limiter, ok := l.methods[method]; ok {
+		if err := limiter.Wait(ctx); err != nil {
+			return errors.Wrap(err, "rate limiter wait")
+		}
+	}
+
+	if err := l.global.Wait(ctx); err != nil {
+		return errors.Wrap(err, "rate limiter wait")
+	}
+
+	return nil
+}
+
+func (l *rateLimiter) block(method string, d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until := time.Now().Add(d); until.After(l.blocked[method]) {
+		l.blocked[method] = until
+	}
+}
+
+func (l *rateLimiter) blockedFor(method string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	left := time.Until(l.blocked[method])
+	if left <= 0 {
+		delete(l.blocked, method)
+		return 0
+	}
+
+	return left
+}
+
+func methodName(input bin.Encoder) string {
+	if t, ok := input.(interface{ TypeInfo() tdp.Type }); ok {
+		return t.TypeInfo().Name
+	}
+
+	return fmt.Sprintf("%T", input)
+}
@@ -0,0 +1,91 @@
+package tg
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+func TestRateLimiterFloodWait(t *testing.T) {
+	const method = "messages.getHistory"
+	errOther := tgerr.New(400, "PEER_ID_INVALID")
+
+	tests := []struct {
+		name    string
+		replies []error
+		calls   int
+		want    error
+		after   time.Duration
+	}{
+		{"no wait", []error{nil}, 1, nil, 0},
+		{"short wait retried", []error{tgerr.New(420, "FLOOD_WAIT_0"), nil}, 2, nil, 0},
+		{"premium wait retried", []error{tgerr.New(420, "FLOOD_PREMIUM_WAIT_0"), nil}, 2, nil, 0},
+		{"long wait returned", []error{tgerr.New(420, "FLOOD_WAIT_60")}, 1, &RetryAfterError{}, time.Minute},
+		{"retries exhausted", []error{tgerr.New(420, "FLOOD_WAIT_0")}, maxFloodRetries + 1, &RetryAfterError{}, 0},
+		{"other error", []error{errOther}, 1, errOther, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newRateLimiter(RateLimit{MaxFloodWait: time.Second})
+
+			var calls int
+			next := telegram.InvokeFunc(func(context.Context, bin.Encoder, bin.Decoder) error {
+				err := tt.replies[min(calls, len(tt.replies)-1)]
+				calls++
+
+				return err
+			})
+
+			err := l.Handle(next).Invoke(context.Background(), &tg.MessagesGetHistoryRequest{}, nil)
+			if calls != tt.calls {
+				t.Fatalf("calls = %d, want %d", calls, tt.calls)
+			}
+
+			var retry *RetryAfterError
+			switch {
+			case tt.want == nil:
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			case errors.As(tt.want, &retry):
+				if !errors.As(err, &retry) || retry.Method != method || retry.After != tt.after {
+					t.Fatalf("error = %v, want retry after %s", err, tt.after)
+				}
+			case !errors.Is(err, tt.want):
+				t.Fatalf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimiterBlocked(t *testing.T) {
+	l := newRateLimiter(RateLimit{MaxFloodWait: time.Minute})
+	l.block("messages.getHistory", 30*time.Second)
+
+	var calls int
+	next := telegram.InvokeFunc(func(context.Context, bin.Encoder, bin.Decoder) error {
+		calls++
+		return nil
+	})
+	h := l.Handle(next)
+
+	// a deadline before the flood wait ends fails fast instead of sleeping
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var retry *RetryAfterError
+	if err := h.Invoke(ctx, &tg.MessagesGetHistoryRequest{}, nil); !errors.As(err, &retry) || calls != 0 {
+		t.Fatalf("blocked call = %v, %d calls", err, calls)
+	}
+
+	// other methods are not blocked
+	if err := h.Invoke(ctx, &tg.MessagesGetDialogsRequest{}, nil); err != nil || calls != 1 {
+		t.Fatalf("other method = %v, %d calls", err, calls)
+	}
+}
@@ -12,6 +12,8 @@ import (
 
 type ReadArguments struct {
 	Name string `json:"name" jsonschema:"description=Name of the dialog"`
+
+	AccountArgument
 }
 
 type ReadResponse struct {
@@ -19,16 +21,11 @@ type ReadResponse struct {
 }
 
 func (c *Client) ReadHistory(args ReadArguments) (*mcp.ToolResponse, error) {
-	ctx := context.Background()
-
 	var affectedMsgs *tg.MessagesAffectedMessages
-	client := c.T()
-	if err := client.Run(ctx, func(ctx context.Context) error {
-		api := client.API()
-
-		inputPeer, err := getInputPeerFromName(ctx, api, args.Name)
+	if err := c.run(func(ctx context.Context, api *tg.Client) error {
+		inputPeer, err := c.resolvePeer(ctx, api, args.Name, accessWrite)
 		if err != nil {
-			return fmt.Errorf("get inputPeer from name: %w", err)
+			return err
 		}
 
 		switch p := inputPeer.(type) {
@@ -0,0 +1,30 @@
+package tg
+
+import "testing"
+
+func TestReadHistory(t *testing.T) {
+	f := newFixture()
+	c := newTestClient(t, f.Fake)
+
+	tests := []struct {
+		name   string
+		dialog string
+		result string
+	}{
+		{"user", "alice", "done"},
+		{"channel", "daily_news", "done"},
+		{"already read", "Bob", "unread messages not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rsp := decode[ReadResponse](t)(c.ReadHistory(ReadArguments{Name: tt.dialog}))
+			if rsp.Result != tt.result {
+				t.Fatalf("result = %q, want %q", rsp.Result, tt.result)
+			}
+		})
+	}
+
+	if f.alice.ReadInboxMaxID != 5 || f.news.ReadInboxMaxID != 2 {
+		t.Fatalf("read inbox max id: alice %d, news %d", f.alice.ReadInboxMaxID, f.news.ReadInboxMaxID)
+	}
+}
@@ -0,0 +1,323 @@
+package tg
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+)
+
+var (
+	record        = flag.Bool("record", false, "record testdata fixtures from the live session in TG_SESSION_PATH")
+	recordHistory = flag.Int("record.history", 3, "number of dialogs whose history is recorded")
+)
+
+const recordLimit = 20
+
+// TestRecord captures raw responses of a real account into testdata with PII scrubbed:
+//
+//	TG_APP_ID=... TG_API_HASH=... TG_SESSION_PATH=... go test ./internal/tg -run TestRecord -record
+//	go test ./internal/tg -run Golden -update
+//
+// Review the fixtures and golden files before committing them.
+func TestRecord(t *testing.T) {
+	if !*record {
+		t.Skip("run with -record to capture fixtures from a live session")
+	}
+
+	appID, err := strconv.Atoi(os.Getenv("TG_APP_ID"))
+	if err != nil {
+		t.Fatalf("TG_APP_ID: %v", err)
+	}
+	sessionPath := os.Getenv("TG_SESSION_PATH")
+	c := New(appID, os.Getenv("TG_API_HASH"), sessionPath,
+		WithSessionStorage(NewSessionStorage(sessionPath, []byte(os.Getenv("TG_SESSION_PASSPHRASE")))))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		if err := c.Run(ctx); err != nil {
+			t.Logf("client stopped: %v", err)
+		}
+	}()
+
+	s := newScrubber()
+	if err := c.run(func(ctx context.Context, api *tg.Client) error {
+		dc, err := api.MessagesGetDialogs(ctx, &tg.MessagesGetDialogsRequest{
+			OffsetPeer: &tg.InputPeerEmpty{},
+			Limit:      recordLimit,
+		})
+		if err != nil {
+			return fmt.Errorf("get dialogs: %w", err)
+		}
+
+		d, err := newDialogs(dc, dialogsFilter{}, nil)
+		if err != nil {
+			return err
+		}
+
+		// peers are resolved before scrubbing changes their ids
+		var peers []tg.InputPeerClass
+		for _, dItem := range d.Dialogs {
+			if dialogItem, ok := dItem.(*tg.Dialog); ok && len(peers) < *recordHistory {
+				peers = append(peers, d.inputPeer(dialogItem.Peer))
+			}
+		}
+
+		if err := writeFixture(s, filepath.Join("testdata", "dialogs", "recorded.tl"), dc); err != nil {
+			return err
+		}
+
+		for i, peer := range peers {
+			mc, err := api.MessagesGetHistory(ctx, &tg.MessagesGetHistoryRequest{Peer: peer, Limit: recordLimit})
+			if err != nil {
+				return fmt.Errorf("get history: %w", err)
+			}
+
+			path := filepath.Join("testdata", "history", fmt.Sprintf("recorded-%d.tl", i+1))
+			if err := writeFixture(s, path, mc); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeFixture(s *scrubber, path string, v bin.Object) error {
+	s.scrub(v)
+
+	var buf bin.Buffer
+	if err := v.Encode(&buf); err != nil {
+		return fmt.Errorf("encode %s: %w", path, err)
+	}
+
+	return os.WriteFile(path, buf.Buf, 0o644)
+}
+
+// scrubber replaces personal data of TL objects in place, consistently across fixtures of one recording:
+// peer ids and access hashes are renumbered, names and usernames get placeholders,
+// texts keep their shape with letters and digits masked, thumbnails and locations are dropped.
+type scrubber struct {
+	ids     map[int64]int64
+	hashes  map[int64]int64
+	strings map[string]string
+}
+
+func newScrubber() *scrubber {
+	return &scrubber{
+		ids:     make(map[int64]int64),
+		hashes:  make(map[int64]int64),
+		strings: make(map[string]string),
+	}
+}
+
+// peerTypes have ID field holding a peer id.
+var peerTypes = map[reflect.Type]bool{
+	reflect.TypeOf(tg.User{}):             true,
+	reflect.TypeOf(tg.UserEmpty{}):        true,
+	reflect.TypeOf(tg.Chat{}):             true,
+	reflect.TypeOf(tg.ChatEmpty{}):        true,
+	reflect.TypeOf(tg.ChatForbidden{}):    true,
+	reflect.TypeOf(tg.Channel{}):          true,
+	reflect.TypeOf(tg.ChannelForbidden{}): true,
+}
+
+func (s *scrubber) scrub(v any) {
+	s.walk(reflect.ValueOf(v), nil)
+}
+
+func (s *scrubber) walk(v reflect.Value, owner reflect.Type) {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if !v.IsNil() {
+			s.walk(v.Elem(), owner)
+		}
+	case reflect.Slice:
+		for i := range v.Len() {
+			s.walk(v.Index(i), owner)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := range v.NumField() {
+			f := v.Field(i)
+			if !f.CanSet() {
+				continue
+			}
+
+			s.field(t, t.Field(i).Name, f)
+		}
+	}
+}
+
+func (s *scrubber) field(owner reflect.Type, name string, f reflect.Value) {
+	switch f.Kind() {
+	case reflect.Int64:
+		switch {
+		case name == "ID" && peerTypes[owner], name == "UserID", name == "ChatID", name == "ChannelID":
+			f.SetInt(renumber(s.ids, f.Int(), 1000))
+		case name == "AccessHash":
+			f.SetInt(renumber(s.hashes, f.Int(), 9000))
+		}
+	case reflect.Float64:
+		if name == "Lat" || name == "Long" {
+			f.SetFloat(0)
+		}
+	case reflect.String:
+		f.SetString(s.text(name, f.String()))
+	case reflect.Slice:
+		if f.Type().Elem().Kind() == reflect.Uint8 {
+			if name == "Bytes" || name == "StrippedThumb" || name == "FileReference" {
+				f.SetBytes(nil)
+			}
+
+			return
+		}
+
+		s.walk(f, owner)
+	default:
+		s.walk(f, owner)
+	}
+}
+
+func (s *scrubber) text(field, v string) string {
+	if v == "" {
+		return v
+	}
+
+	switch field {
+	case "FirstName", "LastName", "Title", "FromName", "PostAuthor", "SiteName", "Author", "Address", "Performer":
+		return s.placeholder(field, v, field+" ")
+	case "Username":
+		return s.placeholder(field, v, "user_")
+	case "Phone", "PhoneNumber", "Vcard":
+		return ""
+	case "Message", "Text", "QuoteText", "Description", "About", "URL", "DisplayURL":
+		return mask(v)
+	case "FileName":
+		// the extension tells the media kind and is kept
+		ext := filepath.Ext(v)
+		return mask(strings.TrimSuffix(v, ext)) + ext
+	default:
+		return v
+	}
+}
+
+// placeholder keeps equal values equal, e.g. a username met in dialogs and in history.
+func (s *scrubber) placeholder(field, v, prefix string) string {
+	key := field + "\x00" + v
+	if p, ok := s.strings[key]; ok {
+		return p
+	}
+
+	p := prefix + strconv.Itoa(len(s.strings)+1)
+	s.strings[key] = p
+
+	return p
+}
+
+// mask hides letters and digits but keeps words, punctuation and UTF-16 length, so entities stay valid.
+func mask(v string) string {
+	runes := []rune(v)
+	for i, r := range runes {
+		switch {
+		case r > 0xFFFF:
+			// outside BMP, replacing would change UTF-16 length
+		case unicode.IsUpper(r):
+			runes[i] = 'X'
+		case unicode.IsLetter(r):
+			runes[i] = 'x'
+		case unicode.IsDigit(r):
+			runes[i] = '0'
+		}
+	}
+
+	return string(runes)
+}
+
+func renumber(m map[int64]int64, v, base int64) int64 {
+	if v == 0 {
+		return 0
+	}
+
+	n, ok := m[v]
+	if !ok {
+		n = base + int64(len(m)) + 1
+		m[v] = n
+	}
+
+	return n
+}
+
+func TestScrubber(t *testing.T) {
+	alice := &tg.User{ID: aliceID, AccessHash: 1010, FirstName: "Alice", LastName: "Smith", Username: "alice", Phone: "15550001010"}
+	dc := &tg.MessagesDialogs{
+		Dialogs: []tg.DialogClass{&tg.Dialog{Peer: &tg.PeerUser{UserID: aliceID}, TopMessage: 7}},
+		Messages: []tg.MessageClass{&tg.Message{
+			ID:      7,
+			PeerID:  &tg.PeerUser{UserID: aliceID},
+			Message: "Call Алиса at 555-0101",
+			Media:   &tg.MessageMediaGeo{Geo: &tg.GeoPoint{Lat: 51.5, Long: -0.12}},
+		}},
+		Users: []tg.UserClass{alice},
+	}
+
+	s := newScrubber()
+	s.scrub(dc)
+
+	want := &tg.User{ID: 1001, AccessHash: 9001, FirstName: "FirstName 1", LastName: "LastName 2", Username: "user_3"}
+	if !reflect.DeepEqual(alice, want) {
+		t.Fatalf("user = %+v, want %+v", alice, want)
+	}
+
+	msg := dc.Messages[0].(*tg.Message)
+	if msg.ID != 7 || msg.PeerID.(*tg.PeerUser).UserID != 1001 || msg.Message != "Xxxx Xxxxx xx 000-0000" {
+		t.Fatalf("unexpected message: %+v", msg)
+	}
+	if geo := msg.Media.(*tg.MessageMediaGeo).Geo.(*tg.GeoPoint); geo.Lat != 0 || geo.Long != 0 {
+		t.Fatalf("location kept: %+v", geo)
+	}
+
+	doc := &tg.Message{
+		ID:     8,
+		PeerID: &tg.PeerUser{UserID: aliceID},
+		Media: &tg.MessageMediaDocument{Document: &tg.Document{
+			ID:            5,
+			FileReference: []byte{1, 2},
+			Attributes: []tg.DocumentAttributeClass{
+				&tg.DocumentAttributeFilename{FileName: "Alice passport.pdf"},
+				&tg.DocumentAttributeAudio{Title: "Song", Performer: "Alice Band"},
+			},
+		}},
+	}
+	s.scrub(doc)
+
+	document := doc.Media.(*tg.MessageMediaDocument).Document.(*tg.Document)
+	if name := document.Attributes[0].(*tg.DocumentAttributeFilename).FileName; name != "Xxxxx xxxxxxxx.pdf" {
+		t.Fatalf("file name = %q", name)
+	}
+	if audio := document.Attributes[1].(*tg.DocumentAttributeAudio); audio.Performer != "Performer 5" || audio.Title != "Title 4" {
+		t.Fatalf("audio = %+v", audio)
+	}
+	if document.FileReference != nil {
+		t.Fatalf("file reference kept: %v", document.FileReference)
+	}
+
+	// the same peer met in another response maps to the same placeholder
+	other := &tg.User{ID: aliceID, Username: "alice"}
+	s.scrub(other)
+	if other.ID != 1001 || other.Username != "user_3" {
+		t.Fatalf("inconsistent scrubbing: %+v", other)
+	}
+}
@@ -0,0 +1,438 @@
+package tg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"github.com/pkg/errors"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	selfName = "me"
+
+	maxNameCandidates = 10
+)
+
+var (
+	usernameRe = regexp.MustCompile(`^@?[a-zA-Z][a-zA-Z0-9_]{3,31}$`)
+	phoneRe    = regexp.MustCompile(`^\+?[0-9][0-9 ()\-]{5,}$`)
+)
+
+type NameCandidate struct {
+	Name  string     `json:"name"`
+	Title string     `json:"title,omitempty"`
+	Type  DialogType `json:"type"`
+}
+
+// AmbiguousNameError is returned when a dialog title matches several peers.
+type AmbiguousNameError struct {
+	Name       string
+	Candidates []NameCandidate
+}
+
+func (e *AmbiguousNameError) Error() string {
+	data, _ := json.Marshal(e.Candidates)
+	return fmt.Sprintf("ambiguous name %q, candidates: %s", e.Name, data)
+}
+
+// inputPeerFromName resolves dialog name: me/saved, t.me and tg:// links, cht[ID]/chn[ID:HASH]/usr[ID],
+// phone number, username or display title. Access hashes come from the peer cache when possible.
+func (c *Client) inputPeerFromName(ctx context.Context, api *tg.Client, name string) (tg.InputPeerClass, error) {
+	name = strings.TrimSpace(name)
+	isCustom := strings.Contains(name, "[") && strings.Contains(name, "]")
+
+	switch {
+	case name == "":
+		return nil, errors.Wrap(ErrInvalidArgument, "empty dialog name")
+	case isSelfName(name):
+		return c.selfPeer(ctx, api)
+	case isLink(name):
+		return c.resolveLink(ctx, api, name)
+	case strings.HasPrefix(name, "chn") && isCustom:
+		var channelPeer tg.InputPeerChannel
+		if _, err := fmt.Sscanf(name, "chn[%d:%d]", &channelPeer.ChannelID, &channelPeer.AccessHash); err != nil {
+			if _, err := fmt.Sscanf(name, "chn[%d]", &channelPeer.ChannelID); err != nil {
+				return nil, errors.Wrapf(err, "scan channel peer(%q)", name)
+			}
+		}
+
+		return c.peers.withAccessHash(&channelPeer), nil
+	case strings.HasPrefix(name, "cht") && isCustom:
+		var chatPeer tg.InputPeerChat
+		_, err := fmt.Sscanf(name, "cht[%d]", &chatPeer.ChatID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "scan chat peer(%q)", name)
+		}
+
+		return &chatPeer, nil
+	case strings.HasPrefix(name, "usr") && isCustom:
+		var userID int64
+		if _, err := fmt.Sscanf(name, "usr[%d]", &userID); err != nil {
+			return nil, errors.Wrapf(err, "scan user peer(%q)", name)
+		}
+
+		inputPeer, ok := c.peers.byKey(peerKey{peerKindUser, userID})
+		if !ok {
+			return nil, errors.Wrapf(ErrPeerNotFound, "user %d is unknown, list dialogs first", userID)
+		}
+
+		return inputPeer, nil
+	case phoneRe.MatchString(name):
+		return c.resolvePhone(ctx, api, name)
+	case strings.HasPrefix(name, "@"):
+		if inputPeer, ok := c.peers.byUsername(name); ok {
+			return inputPeer, nil
+		}
+
+		return c.resolveUsername(ctx, api, name)
+	default:
+		return c.resolveTitle(ctx, api, name)
+	}
+}
+
+// resolveTitle matches display titles of known peers, falling back to fresh dialog list and then to username.
+// A plain name like "John" may be someone's username too, so strangers are looked up only when no dialog matches.
+func (c *Client) resolveTitle(ctx context.Context, api *tg.Client, name string) (tg.InputPeerClass, error) {
+	isUsername := usernameRe.MatchString(name)
+	if isUsername {
+		if inputPeer, ok := c.peers.byUsername(name); ok {
+			return inputPeer, nil
+		}
+	}
+
+	matches, _ := matchTitle(c.peers.records(), name)
+	if len(matches) == 0 {
+		// dialogs pass through the peer cache, so the next match sees them
+		if _, err := api.MessagesGetDialogs(ctx, &tg.MessagesGetDialogsRequest{
+			OffsetPeer: &tg.InputPeerEmpty{},
+			Limit:      DefaultDialogsLimit,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to get dialogs: %w", err)
+		}
+
+		matches, _ = matchTitle(c.peers.records(), name)
+	}
+
+	if len(matches) == 0 && isUsername {
+		inputPeer, err := c.resolveUsername(ctx, api, name)
+		if !tgerr.Is(err, "USERNAME_NOT_OCCUPIED", "USERNAME_INVALID") {
+			return inputPeer, err
+		}
+	}
+
+	return c.pickAllowedPeer(ctx, api, name, matches)
+}
+
+// pickAllowedPeer is pickPeer among matches allowed by policy, so candidates never reveal denied dialogs.
+func (c *Client) pickAllowedPeer(ctx context.Context, api *tg.Client, name string, matches []peerRecord) (tg.InputPeerClass, error) {
+	if len(matches) < 2 || !c.policy.restricted() {
+		return pickPeer(name, matches)
+	}
+
+	inputPeers := make([]tg.InputPeerClass, 0, len(matches))
+	for _, r := range matches {
+		inputPeers = append(inputPeers, r.inputPeer())
+	}
+
+	subjects, err := c.peerSubjects(ctx, api, inputPeers)
+	if err != nil {
+		return nil, errors.Wrap(err, "check policy")
+	}
+
+	matches, err = allowedMatches(name, matches, func(key peerKey) bool {
+		return c.policy.allows(subjects[key])
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return pickPeer(name, matches)
+}
+
+// allowedMatches keeps allowed matches, failing as a denied dialog when none is left.
+func allowedMatches(name string, matches []peerRecord, allowed func(peerKey) bool) ([]peerRecord, error) {
+	kept := make([]peerRecord, 0, len(matches))
+	for _, r := range matches {
+		if allowed(r.key()) {
+			kept = append(kept, r)
+		}
+	}
+
+	if len(kept) == 0 && len(matches) > 0 {
+		return nil, errors.Wrapf(ErrPolicyDenied, "dialog %q", name)
+	}
+
+	return kept, nil
+}
+
+func pickPeer(name string, matches []peerRecord) (tg.InputPeerClass, error) {
+	switch len(matches) {
+	case 0:
+		return nil, errors.Wrapf(ErrPeerNotFound, "dialog %q", name)
+	case 1:
+		return matches[0].inputPeer(), nil
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Title < matches[j].Title })
+
+	candidates := make([]NameCandidate, 0, min(len(matches), maxNameCandidates))
+	for _, r := range matches[:min(len(matches), maxNameCandidates)] {
+		candidates = append(candidates, NameCandidate{Name: r.name(), Title: r.Title, Type: r.Type})
+	}
+
+	return nil, &AmbiguousNameError{Name: name, Candidates: candidates}
+}
+
+// matchTitle returns peers of the best match tier: exact title or username, title prefix, all words contained.
+func matchTitle(records []peerRecord, name string) ([]peerRecord, bool) {
+	query := normalizeTitle(name)
+	words := strings.Fields(query)
+	if len(words) == 0 {
+		return nil, false
+	}
+
+	const (
+		tierWords = iota + 1
+		tierPrefix
+		tierExact
+	)
+
+	var (
+		best    int
+		matches []peerRecord
+	)
+	for _, r := range records {
+		if r.key().kind != peerKindChat && r.AccessHash == 0 {
+			continue
+		}
+
+		title := normalizeTitle(r.Title)
+
+		var tier int
+		switch {
+		case title == query || strings.EqualFold(r.Username, name):
+			tier = tierExact
+		case strings.HasPrefix(title, query):
+			tier = tierPrefix
+		case containsWords(title, words):
+			tier = tierWords
+		default:
+			continue
+		}
+
+		if tier > best {
+			best, matches = tier, matches[:0]
+		}
+		if tier == best {
+			matches = append(matches, r)
+		}
+	}
+
+	return matches, best == tierExact
+}
+
+func containsWords(title string, words []string) bool {
+	for _, w := range words {
+		if !strings.Contains(title, w) {
+			return false
+		}
+	}
+
+	return true
+}
+
+var diacritics = transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+
+// normalizeTitle lowercases s, strips diacritics and collapses spaces.
+func normalizeTitle(s string) string {
+	if stripped, _, err := transform.String(diacritics, s); err == nil {
+		s = stripped
+	}
+
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+func isSelfName(name string) bool {
+	switch strings.ToLower(name) {
+	case selfName, "self", "saved", "saved messages":
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *Client) selfPeer(ctx context.Context, api *tg.Client) (tg.InputPeerClass, error) {
+	if inputPeer, ok := c.peers.self(); ok {
+		return inputPeer, nil
+	}
+
+	self, err := getSelf(ctx, api)
+	if err != nil {
+		return nil, errors.Wrap(err, "get self")
+	}
+
+	return self.AsInputPeer(), nil
+}
+
+func (c *Client) resolveUsername(ctx context.Context, api *tg.Client, name string) (tg.InputPeerClass, error) {
+	resolved, err := api.ContactsResolveUsername(ctx, &tg.ContactsResolveUsernameRequest{
+		Username: strings.TrimPrefix(name, "@"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve name: %w", err)
+	}
+
+	return c.resolvedPeer(resolved)
+}
+
+func (c *Client) resolvePhone(ctx context.Context, api *tg.Client, phone string) (tg.InputPeerClass, error) {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+
+		return -1
+	}, phone)
+
+	resolved, err := api.ContactsResolvePhone(ctx, digits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve phone: %w", err)
+	}
+
+	return c.resolvedPeer(resolved)
+}
+
+// resolvedPeer takes input peer from the cache, which already recorded entities of the response.
+func (c *Client) resolvedPeer(resolved *tg.ContactsResolvedPeer) (tg.InputPeerClass, error) {
+	inputPeer, ok := c.peers.byPeer(resolved.Peer)
+	if !ok {
+		return nil, errors.Wrapf(ErrPeerNotFound, "resolved peer %d has no access hash", getPeerID(resolved.Peer))
+	}
+
+	return inputPeer, nil
+}
+
+func isLink(name string) bool {
+	lower := strings.ToLower(name)
+	for _, prefix := range []string{"tg://", "https://", "http://", "t.me/", "telegram.me/", "telegram.dog/"} {
+		if strings.HasPrefix(lower, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolveLink resolves t.me/..., telegram.me/... and tg://... links to dialogs.
+func (c *Client) resolveLink(ctx context.Context, api *tg.Client, link string) (tg.InputPeerClass, error) {
+	target, invite, err := parseLink(link)
+	if err != nil {
+		return nil, err
+	}
+
+	if invite != "" {
+		return c.resolveInvite(ctx, api, invite)
+	}
+
+	return c.inputPeerFromName(ctx, api, target)
+}
+
+// parseLink converts link to a dialog name or an invite hash.
+func parseLink(link string) (string, string, error) {
+	if !strings.Contains(link, "://") {
+		link = "https://" + link
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "parse link %q", link)
+	}
+
+	q := u.Query()
+	if strings.EqualFold(u.Scheme, "tg") {
+		switch strings.ToLower(u.Host) {
+		case "resolve":
+			if phone := q.Get("phone"); phone != "" {
+				return "+" + phone, "", nil
+			}
+			if domain := q.Get("domain"); domain != "" {
+				return "@" + domain, "", nil
+			}
+		case "user":
+			if id := q.Get("id"); id != "" {
+				return "usr[" + id + "]", "", nil
+			}
+		case "privatepost":
+			if channel := q.Get("channel"); channel != "" {
+				return "chn[" + channel + "]", "", nil
+			}
+		case "join":
+			if invite := q.Get("invite"); invite != "" {
+				return "", invite, nil
+			}
+		}
+
+		return "", "", errors.Wrapf(ErrInvalidArgument, "unsupported link %q", link)
+	}
+
+	switch strings.ToLower(u.Hostname()) {
+	case "t.me", "telegram.me", "telegram.dog":
+	default:
+		return "", "", errors.Wrapf(ErrInvalidArgument, "unsupported link %q", link)
+	}
+
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	switch {
+	case parts[0] == "":
+		return "", "", errors.Wrapf(ErrInvalidArgument, "link %q has no dialog", link)
+	case parts[0] == "c" && len(parts) > 1:
+		return "chn[" + parts[1] + "]", "", nil
+	case (parts[0] == "joinchat" || parts[0] == "s") && len(parts) > 1:
+		if parts[0] == "joinchat" {
+			return "", parts[1], nil
+		}
+
+		return "@" + parts[1], "", nil
+	case strings.HasPrefix(parts[0], "+"):
+		if phoneRe.MatchString(parts[0]) {
+			return parts[0], "", nil
+		}
+
+		return "", strings.TrimPrefix(parts[0], "+"), nil
+	default:
+		return "@" + parts[0], "", nil
+	}
+}
+
+// resolveInvite returns chat of an invite link the user already joined.
+func (c *Client) resolveInvite(ctx context.Context, api *tg.Client, hash string) (tg.InputPeerClass, error) {
+	invite, err := api.MessagesCheckChatInvite(ctx, hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check invite: %w", err)
+	}
+
+	already, ok := invite.(*tg.ChatInviteAlready)
+	if !ok {
+		return nil, errors.Wrap(ErrPeerNotFound, "invite link of a chat you are not a member of")
+	}
+
+	switch chat := already.Chat.(type) {
+	case *tg.Chat:
+		return &tg.InputPeerChat{ChatID: chat.ID}, nil
+	case *tg.Channel:
+		return chat.AsInputPeer(), nil
+	default:
+		return nil, errors.Wrapf(ErrPeerNotFound, "invite chat %T is not available", already.Chat)
+	}
+}
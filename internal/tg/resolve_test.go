@@ -0,0 +1,133 @@
+package tg
+
+import (
+	"testing"
+
+	"github.com/gotd/td/tg"
+)
+
+func TestResolveNames(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"@alice", "bring the report"},
+		{"alice", "bring the report"},
+		{"Alice Smith", "bring the report"},
+		{"alice smith", "bring the report"},
+		{"+1 555 000 1010", "bring the report"},
+		{"t.me/alice", "bring the report"},
+		{"Bob", "hi there"},
+		{"Team Chat", "ok"},
+		{"cht[20]", "ok"},
+		{"daily_news", "evening edition"},
+		{"chn[30:3030]", "evening edition"},
+		{"https://t.me/daily_news", "evening edition"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// a fresh client has no cached peers
+			c := newTestClient(t, newFixture().Fake)
+
+			rsp := decode[HistoryResponse](t)(c.GetHistory(HistoryArguments{Name: tt.name, Limit: 1}))
+			if len(rsp.Messages) != 1 || rsp.Messages[0].Text != tt.want {
+				t.Fatalf("messages = %+v, want %q", rsp.Messages, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveCachedUser(t *testing.T) {
+	f := newFixture()
+	c := newTestClient(t, f.Fake)
+
+	_, err := c.GetHistory(HistoryArguments{Name: "usr[11]"})
+	requireCode(t, err, CodePeerNotFound)
+
+	decode[dialogsPage](t)(c.GetDialogs(DialogsArguments{}))
+
+	rsp := decode[HistoryResponse](t)(c.GetHistory(HistoryArguments{Name: "usr[11]"}))
+	if len(rsp.Messages) != 1 || rsp.Messages[0].Text != "hi there" {
+		t.Fatalf("unexpected messages: %+v", rsp.Messages)
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	f := newFixture()
+	f.AddChat(&tg.Chat{ID: 21, Title: "Team Alpha"}).Message(aliceID, 0, "hello")
+	c := newTestClient(t, f.Fake)
+
+	_, err := c.GetHistory(HistoryArguments{Name: "nobody_here"})
+	requireCode(t, err, CodePeerNotFound)
+
+	_, err = c.GetHistory(HistoryArguments{Name: ""})
+	requireCode(t, err, CodeInvalidArgument)
+
+	_, err = c.GetHistory(HistoryArguments{Name: "Team"})
+	requireCode(t, err, CodeAmbiguousPeer)
+
+	te := toolError(err).(*ToolError)
+	if len(te.Candidates) != 2 || te.Candidates[0].Name != "cht[21]" || te.Candidates[1].Name != "cht[20]" {
+		t.Fatalf("unexpected candidates: %+v", te.Candidates)
+	}
+}
+
+func TestResolveDeniedCandidates(t *testing.T) {
+	f := newFixture()
+	f.AddChannel(&tg.Channel{ID: 31, AccessHash: 3131, Title: "Project"}).Message(0, 0, "public plan")
+	f.AddChannel(&tg.Channel{ID: 32, AccessHash: 3232, Title: "Project"}).Message(0, 0, "secret plan")
+
+	policy, err := LoadPolicy("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := policy.Merge(false, nil, []string{"chn[32]"}); err != nil {
+		t.Fatal(err)
+	}
+	c := newTestClient(t, f.Fake, WithPolicy(policy))
+	decode[dialogsPage](t)(c.GetDialogs(DialogsArguments{}))
+
+	// the denied namesake is neither a candidate nor a reason for ambiguity
+	rsp := decode[HistoryResponse](t)(c.GetHistory(HistoryArguments{Name: "Project"}))
+	if len(rsp.Messages) != 1 || rsp.Messages[0].Text != "public plan" {
+		t.Fatalf("unexpected messages: %+v", rsp.Messages)
+	}
+
+	f.AddChannel(&tg.Channel{ID: 33, AccessHash: 3333, Title: "Project"}).Message(0, 0, "other plan")
+	decode[dialogsPage](t)(c.GetDialogs(DialogsArguments{}))
+
+	_, err = c.GetHistory(HistoryArguments{Name: "Project"})
+	requireCode(t, err, CodeAmbiguousPeer)
+	for _, cand := range toolError(err).(*ToolError).Candidates {
+		if cand.Name == "chn[32:3232]" {
+			t.Fatalf("denied dialog among candidates: %+v", cand)
+		}
+	}
+	if n := len(toolError(err).(*ToolError).Candidates); n != 2 {
+		t.Fatalf("got %d candidates, want 2", n)
+	}
+}
+
+func TestResolveTitleBeforeUsername(t *testing.T) {
+	f := newFixture()
+	f.AddUser(&tg.User{ID: 40, AccessHash: 4040, FirstName: "John", LastName: "Smith"}).Message(40, 0, "from the dialog")
+	// a stranger whose username equals the typed name, never written to
+	f.AddUser(&tg.User{ID: 41, AccessHash: 4141, FirstName: "Stranger", Username: "john"})
+	c := newTestClient(t, f.Fake)
+
+	rsp := decode[HistoryResponse](t)(c.GetHistory(HistoryArguments{Name: "John", Limit: 1}))
+	if len(rsp.Messages) != 1 || rsp.Messages[0].Text != "from the dialog" {
+		t.Fatalf("messages = %+v, want the John Smith dialog", rsp.Messages)
+	}
+
+	// several dialogs match, the stranger is not a candidate
+	f.AddUser(&tg.User{ID: 42, AccessHash: 4242, FirstName: "John", LastName: "Doe"}).Message(42, 0, "other")
+	c = newTestClient(t, f.Fake)
+	_, err := c.GetHistory(HistoryArguments{Name: "John"})
+	requireCode(t, err, CodeAmbiguousPeer)
+
+	// the @ form always means the username
+	if _, err := c.GetHistory(HistoryArguments{Name: "@john"}); err != nil {
+		t.Fatalf("@john: %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+package tg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/gotd/td/tg"
+	mcp "github.com/metoro-io/mcp-golang"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	ResourceMimeType = "application/json"
+
+	// MessagesResource is the sub path of dialog messages resource.
+	MessagesResource = "/messages"
+
+	// resourcesWait bounds waiting for connections when the client lists resources.
+	resourcesWait = 10 * time.Second
+)
+
+// DialogResource is a dialog exposed as telegram://dialog/{name} and telegram://dialog/{name}/messages.
+type DialogResource struct {
+	Account string
+	Name    string
+	Title   string
+}
+
+// URI returns resource uri of the dialog with optional sub path like MessagesResource.
+func (r DialogResource) URI(sub string) string {
+	return DialogURI(r.Account, r.Name, sub)
+}
+
+// DialogURI returns resource uri of the dialog, non default accounts are selected by the account query.
+func DialogURI(account, name, sub string) string {
+	uri := "telegram://dialog/" + url.PathEscape(name) + sub
+	if account != DefaultAccount {
+		uri += "?account=" + url.QueryEscape(account)
+	}
+
+	return uri
+}
+
+// Resources lists the first page of dialogs of every account, accounts not connected in time or failing to list are skipped.
+func (a *Accounts) Resources(ctx context.Context) []DialogResource {
+	ctx, cancel := context.WithTimeout(ctx, resourcesWait)
+	defer cancel()
+
+	var resources []DialogResource
+	for _, name := range a.Names() {
+		c := a.clients[name]
+		if _, err := c.waitAPI(ctx); err != nil {
+			log.Warn().Err(err).Str("account", name).Msg("skip dialog resources")
+			continue
+		}
+
+		rsp, err := c.Dialogs(DialogsArguments{})
+		if err != nil {
+			log.Warn().Err(err).Str("account", name).Msg("failed to list dialog resources")
+			continue
+		}
+
+		for _, d := range rsp.Dialogs {
+			if d.Name == "" {
+				continue
+			}
+
+			resources = append(resources, DialogResource{Account: name, Name: d.Name, Title: d.Title})
+		}
+	}
+
+	return resources
+}
+
+// ReadDialog returns content of the dialog resource: its type, title and last message.
+func (a *Accounts) ReadDialog(r DialogResource) (*mcp.ResourceResponse, error) {
+	c, err := a.Client(r.Account)
+	if err != nil {
+		return nil, toolError(err)
+	}
+
+	info, err := c.Dialog(r.Name)
+	if err != nil {
+		return nil, toolError(err)
+	}
+
+	return jsonResource(r.URI(""), info)
+}
+
+// ReadMessages returns content of the messages resource: the latest messages of the dialog.
+func (a *Accounts) ReadMessages(r DialogResource) (*mcp.ResourceResponse, error) {
+	c, err := a.Client(r.Account)
+	if err != nil {
+		return nil, toolError(err)
+	}
+
+	rsp, err := c.History(HistoryArguments{Name: r.Name})
+	if err != nil {
+		return nil, toolError(err)
+	}
+
+	return jsonResource(r.URI(MessagesResource), rsp)
+}
+
+// Dialog returns info of a single dialog by name.
+func (c *Client) Dialog(name string) (*DialogInfo, error) {
+	filter, err := DialogsArguments{}.filter()
+	if err != nil {
+		return nil, err
+	}
+
+	var pd *tg.MessagesPeerDialogs
+	if err := c.run(func(ctx context.Context, api *tg.Client) (err error) {
+		inputPeer, err := c.resolvePeer(ctx, api, name, accessRead)
+		if err != nil {
+			return err
+		}
+
+		pd, err = api.MessagesGetPeerDialogs(ctx, []tg.InputDialogPeerClass{&tg.InputDialogPeer{Peer: inputPeer}})
+		if err != nil {
+			return fmt.Errorf("failed to get peer dialogs: %w", err)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "failed to get dialog")
+	}
+
+	d, err := newDialogs(&tg.MessagesDialogs{
+		Dialogs:  pd.Dialogs,
+		Messages: pd.Messages,
+		Chats:    pd.Chats,
+		Users:    pd.Users,
+	}, filter, c.policy)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get dialog")
+	}
+
+	infos := d.Info()
+	if len(infos) == 0 {
+		return nil, errors.Wrapf(ErrPeerNotFound, "dialog %q", name)
+	}
+
+	return &infos[0], nil
+}
+
+func jsonResource(uri string, v any) (*mcp.ResourceResponse, error) {
+	jsonData, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal response")
+	}
+
+	return mcp.NewResourceResponse(mcp.NewTextEmbeddedResource(uri, string(jsonData), ResourceMimeType)), nil
+}
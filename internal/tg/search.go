@@ -0,0 +1,344 @@
+package tg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/gotd/td/tg"
+	mcp "github.com/metoro-io/mcp-golang"
+	"github.com/pkg/errors"
+)
+
+const DefaultSearchLimit = 50
+
+// nolint:lll
+type SearchArguments struct {
+	Query  string `json:"query" jsonschema:"description=Text to search for\\, may be empty when other filters are set"`
+	Name   string `json:"name,omitempty" jsonschema:"description=Name of the dialog to search in\\, all dialogs if empty"`
+	From   string `json:"from,omitempty" jsonschema:"description=Name of the message sender"`
+	Since  string `json:"since,omitempty" jsonschema:"description=Only messages after this time (unix\\, RFC3339\\, 2006-01-02 15:04:05 or 2006-01-02)"`
+	Until  string `json:"until,omitempty" jsonschema:"description=Only messages before this time (unix\\, RFC3339\\, 2006-01-02 15:04:05 or 2006-01-02)"`
+	Media  string `json:"media,omitempty" jsonschema:"enum=photo,enum=video,enum=photo_video,enum=document,enum=url,enum=gif,enum=voice,enum=music,enum=round_video,enum=geo,enum=contacts,enum=pinned,enum=mentions,description=Only messages of this kind"`
+	Limit  int    `json:"limit,omitempty" jsonschema:"description=Maximum number of messages (default 50)"`
+	Offset string `json:"offset,omitempty" jsonschema:"description=Offset for continuation"`
+
+	SourceArgument
+	AccountArgument
+}
+
+type SearchMessageInfo struct {
+	Dialog string `json:"dialog"`
+	MessageInfo
+}
+
+type SearchResponse struct {
+	Messages []SearchMessageInfo `json:"messages"`
+	Offset   string              `json:"offset,omitempty"`
+}
+
+// Search looks for messages in a single dialog or across all dialogs.
+func (c *Client) Search(args SearchArguments) (*mcp.ToolResponse, error) {
+	filter, err := searchFilter(args.Media)
+	if err != nil {
+		return nil, err
+	}
+
+	minDate, err := parseTime(args.Since)
+	if err != nil {
+		return nil, errors.Wrap(err, "since")
+	}
+
+	maxDate, err := parseTime(args.Until)
+	if err != nil {
+		return nil, errors.Wrap(err, "until")
+	}
+
+	limit := args.Limit
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+
+	local, err := args.local()
+	if err != nil {
+		return nil, err
+	}
+	if local {
+		return localResponse(c.localSearch(args, minDate, maxDate, limit))
+	}
+
+	var rsp SearchResponse
+	if err := c.run(func(ctx context.Context, api *tg.Client) error {
+		var fromPeer tg.InputPeerClass
+		if args.From != "" {
+			fromPeer, err = c.inputPeerFromName(ctx, api, args.From)
+			if err != nil {
+				return fmt.Errorf("get sender from name: %w", err)
+			}
+		}
+
+		var raw tg.MessagesMessagesClass
+		if args.Name != "" {
+			raw, err = c.searchDialog(ctx, api, args, filter, fromPeer, minDate, maxDate, limit)
+		} else {
+			raw, err = c.searchGlobal(ctx, api, args, filter, minDate, maxDate, limit)
+		}
+		if err != nil {
+			return err
+		}
+
+		h, err := newHistory(raw)
+		if err != nil {
+			return errors.Wrap(err, "failed to process search results")
+		}
+		h.textFormat = c.textFormat
+
+		// messages.search filters by sender itself, global search is filtered here
+		var globalFrom tg.InputPeerClass
+		if args.Name == "" {
+			globalFrom = fromPeer
+		}
+
+		rsp.Messages, err = c.searchResults(ctx, api, h, globalFrom)
+		if err != nil {
+			return err
+		}
+
+		rsp.Offset = searchOffset(raw, h, args.Name != "", limit)
+
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "failed to search messages")
+	}
+
+	jsonData, err := json.Marshal(rsp)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal response")
+	}
+
+	return mcp.NewToolResponse(mcp.NewTextContent(string(jsonData))), nil
+}
+
+func (c *Client) searchDialog(
+	ctx context.Context,
+	api *tg.Client,
+	args SearchArguments,
+	filter tg.MessagesFilterClass,
+	fromPeer tg.InputPeerClass,
+	minDate, maxDate, limit int,
+) (tg.MessagesMessagesClass, error) {
+	inputPeer, err := c.resolvePeer(ctx, api, args.Name, accessRead)
+	if err != nil {
+		return nil, err
+	}
+
+	var offsetID int
+	if args.Offset != "" {
+		offsetID, err = strconv.Atoi(args.Offset)
+		if err != nil {
+			return nil, errors.Wrapf(ErrInvalidArgument, "invalid offset %q", args.Offset)
+		}
+	}
+
+	req := &tg.MessagesSearchRequest{
+		Peer:     inputPeer,
+		Q:        args.Query,
+		Filter:   filter,
+		MinDate:  minDate,
+		MaxDate:  maxDate,
+		OffsetID: offsetID,
+		Limit:    limit,
+	}
+	if fromPeer != nil {
+		req.SetFromID(fromPeer)
+	}
+
+	raw, err := api.MessagesSearch(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("search: %w", err)
+	}
+
+	return raw, nil
+}
+
+func (c *Client) searchGlobal(
+	ctx context.Context,
+	api *tg.Client,
+	args SearchArguments,
+	filter tg.MessagesFilterClass,
+	minDate, maxDate, limit int,
+) (tg.MessagesMessagesClass, error) {
+	var offset DialogsOffset
+	if args.Offset != "" {
+		if err := offset.UnmarshalJSON([]byte(args.Offset)); err != nil {
+			return nil, errors.Wrapf(ErrInvalidArgument, "invalid offset %q: %v", args.Offset, err)
+		}
+	}
+	if offset.Peer == nil {
+		offset.Peer = &tg.InputPeerEmpty{}
+	}
+	offset.Peer = c.peers.withAccessHash(offset.Peer)
+
+	raw, err := api.MessagesSearchGlobal(ctx, &tg.MessagesSearchGlobalRequest{
+		Q:          args.Query,
+		Filter:     filter,
+		MinDate:    minDate,
+		MaxDate:    maxDate,
+		OffsetRate: offset.Date,
+		OffsetPeer: offset.Peer,
+		OffsetID:   offset.MsgID,
+		Limit:      limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("search global: %w", err)
+	}
+
+	return raw, nil
+}
+
+// searchResults converts found messages, dropping those from other senders or denied dialogs.
+func (c *Client) searchResults(
+	ctx context.Context,
+	api *tg.Client,
+	h *history,
+	fromPeer tg.InputPeerClass,
+) ([]SearchMessageInfo, error) {
+	var allowed map[peerKey]bool
+	if c.policy.restricted() {
+		var peers []tg.InputPeerClass
+		seen := make(map[peerKey]bool)
+		for _, msg := range h.Messages {
+			m, ok := msg.(*tg.Message)
+			if !ok {
+				continue
+			}
+
+			key, _ := peerKeyOf(m.PeerID)
+			if seen[key] {
+				continue
+			}
+
+			seen[key] = true
+			peers = append(peers, h.inputPeer(m.PeerID))
+		}
+
+		subjects, err := c.peerSubjects(ctx, api, peers)
+		if err != nil {
+			return nil, errors.Wrap(err, "check policy")
+		}
+
+		allowed = make(map[peerKey]bool, len(subjects))
+		for key, s := range subjects {
+			allowed[key] = c.policy.allows(s)
+		}
+	}
+
+	fromID := getInputPeerIDValue(fromPeer)
+	messages := make([]SearchMessageInfo, 0, len(h.Messages))
+	for _, msg := range h.Messages {
+		m, ok := msg.(*tg.Message)
+		if !ok {
+			continue
+		}
+
+		if allowed != nil {
+			if key, _ := peerKeyOf(m.PeerID); !allowed[key] {
+				continue
+			}
+		}
+
+		if fromID != 0 && senderID(m) != fromID {
+			continue
+		}
+
+		messages = append(messages, SearchMessageInfo{
+			Dialog:      h.dialogName(m.PeerID),
+			MessageInfo: h.messageInfo(m),
+		})
+	}
+
+	return messages, nil
+}
+
+// searchOffset returns continuation for the next page or empty string when results are exhausted.
+func searchOffset(raw tg.MessagesMessagesClass, h *history, inDialog bool, limit int) string {
+	// messages.messages is the complete result, a short page is the end of a slice
+	if _, ok := raw.(*tg.MessagesMessages); ok || len(h.Messages) < limit {
+		return ""
+	}
+
+	var last *tg.Message
+	for i := len(h.Messages) - 1; i >= 0; i-- {
+		if m, ok := h.Messages[i].(*tg.Message); ok {
+			last = m
+			break
+		}
+	}
+	if last == nil {
+		return ""
+	}
+
+	if inDialog {
+		return strconv.Itoa(last.ID)
+	}
+
+	rate := last.Date
+	if slice, ok := raw.(*tg.MessagesMessagesSlice); ok {
+		if nextRate, ok := slice.GetNextRate(); ok {
+			rate = nextRate
+		}
+	}
+
+	offset := DialogsOffset{
+		MsgID: last.ID,
+		Date:  rate,
+		Peer:  getInputPeerID(last.PeerID),
+	}
+
+	return offset.String()
+}
+
+// senderID returns id of the message author; private messages without from_id belong to the peer.
+func senderID(m *tg.Message) int64 {
+	if m.FromID != nil {
+		return getPeerID(m.FromID)
+	}
+
+	return getPeerID(m.PeerID)
+}
+
+func searchFilter(media string) (tg.MessagesFilterClass, error) {
+	switch media {
+	case "":
+		return &tg.InputMessagesFilterEmpty{}, nil
+	case "photo":
+		return &tg.InputMessagesFilterPhotos{}, nil
+	case "video":
+		return &tg.InputMessagesFilterVideo{}, nil
+	case "photo_video":
+		return &tg.InputMessagesFilterPhotoVideo{}, nil
+	case "document":
+		return &tg.InputMessagesFilterDocument{}, nil
+	case "url":
+		return &tg.InputMessagesFilterURL{}, nil
+	case "gif":
+		return &tg.InputMessagesFilterGif{}, nil
+	case "voice":
+		return &tg.InputMessagesFilterVoice{}, nil
+	case "music":
+		return &tg.InputMessagesFilterMusic{}, nil
+	case "round_video":
+		return &tg.InputMessagesFilterRoundVideo{}, nil
+	case "geo":
+		return &tg.InputMessagesFilterGeo{}, nil
+	case "contacts":
+		return &tg.InputMessagesFilterContacts{}, nil
+	case "pinned":
+		return &tg.InputMessagesFilterPinned{}, nil
+	case "mentions":
+		return &tg.InputMessagesFilterMyMentions{}, nil
+	default:
+		return nil, errors.Wrapf(ErrInvalidArgument, "unknown media filter %q", media)
+	}
+}
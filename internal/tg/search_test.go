@@ -0,0 +1,54 @@
+package tg
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	f := newFixture()
+	c := newTestClient(t, f.Fake)
+
+	tests := []struct {
+		name string
+		args SearchArguments
+		want []string
+	}{
+		{"dialog", SearchArguments{Query: "edition", Name: "daily_news"}, []string{"evening edition", "morning edition"}},
+		{"global", SearchArguments{Query: "report"}, []string{"bring the report"}},
+		{"nothing", SearchArguments{Query: "lunch"}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rsp := decode[SearchResponse](t)(c.Search(tt.args))
+
+			texts := make([]string, 0, len(rsp.Messages))
+			for _, m := range rsp.Messages {
+				texts = append(texts, m.Text)
+			}
+			if !slices.Equal(texts, tt.want) {
+				t.Fatalf("messages = %v, want %v", texts, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchLastPage(t *testing.T) {
+	f := newFixture()
+	c := newTestClient(t, f.Fake)
+
+	first := decode[SearchResponse](t)(c.Search(SearchArguments{Query: "edition", Name: "daily_news", Limit: 1}))
+	if len(first.Messages) != 1 || first.Offset == "" {
+		t.Fatalf("unexpected first page: %+v", first)
+	}
+
+	last := decode[SearchResponse](t)(c.Search(SearchArguments{Query: "edition", Name: "daily_news", Limit: 2, Offset: first.Offset}))
+	if len(last.Messages) != 1 || last.Offset != "" {
+		t.Fatalf("unexpected last page: %+v", last)
+	}
+
+	global := decode[SearchResponse](t)(c.Search(SearchArguments{Query: "report"}))
+	if global.Offset != "" {
+		t.Fatalf("offset %q after all results", global.Offset)
+	}
+}
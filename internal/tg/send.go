@@ -0,0 +1,121 @@
+package tg
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gotd/td/tg"
+	mcp "github.com/metoro-io/mcp-golang"
+	"github.com/pkg/errors"
+)
+
+// nolint:lll
+type SendArguments struct {
+	Name      string `json:"name" jsonschema:"required,description=Name of the dialog"`
+	Text      string `json:"text" jsonschema:"required,description=Plain text of the message"`
+	ReplyTo   int    `json:"reply_to,omitempty" jsonschema:"description=ID of the message to reply to"`
+	Silent    bool   `json:"silent,omitempty" jsonschema:"description=Send without notification sound"`
+	NoPreview bool   `json:"no_preview,omitempty" jsonschema:"description=Disable link preview"`
+
+	AccountArgument
+}
+
+type SendResponse struct {
+	ID   int    `json:"id"`
+	When string `json:"when"`
+}
+
+// SendMessage delivers a text message to the dialog, unlike SendDraft which only saves a draft.
+func (c *Client) SendMessage(args SendArguments) (*mcp.ToolResponse, error) {
+	var rsp SendResponse
+	if err := c.run(func(ctx context.Context, api *tg.Client) error {
+		inputPeer, err := c.resolvePeer(ctx, api, args.Name, accessWrite)
+		if err != nil {
+			return err
+		}
+
+		randomID, err := randomID()
+		if err != nil {
+			return fmt.Errorf("generate random id: %w", err)
+		}
+
+		req := &tg.MessagesSendMessageRequest{
+			Peer:      inputPeer,
+			Message:   args.Text,
+			RandomID:  randomID,
+			Silent:    args.Silent,
+			NoWebpage: args.NoPreview,
+		}
+		if args.ReplyTo != 0 {
+			req.SetReplyTo(&tg.InputReplyToMessage{ReplyToMsgID: args.ReplyTo})
+		}
+
+		updates, err := api.MessagesSendMessage(ctx, req)
+		if err != nil {
+			return fmt.Errorf("send message: %w", err)
+		}
+
+		id, date := sentMessage(updates, randomID)
+		rsp = SendResponse{
+			ID:   id,
+			When: time.Unix(int64(date), 0).Format(time.DateTime),
+		}
+
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "failed to send message")
+	}
+
+	jsonData, err := json.Marshal(rsp)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal response")
+	}
+
+	return mcp.NewToolResponse(mcp.NewTextContent(string(jsonData))), nil
+}
+
+// sentMessage extracts id and date of the sent message from the updates returned by sendMessage.
+func sentMessage(updates tg.UpdatesClass, randomID int64) (int, int) {
+	switch u := updates.(type) {
+	case *tg.UpdateShortSentMessage:
+		return u.ID, u.Date
+	case *tg.Updates:
+		var id int
+		for _, upd := range u.Updates {
+			if v, ok := upd.(*tg.UpdateMessageID); ok && v.RandomID == randomID {
+				id = v.ID
+			}
+		}
+
+		for _, upd := range u.Updates {
+			var msg tg.MessageClass
+			switch v := upd.(type) {
+			case *tg.UpdateNewMessage:
+				msg = v.Message
+			case *tg.UpdateNewChannelMessage:
+				msg = v.Message
+			}
+
+			if m, ok := msg.(*tg.Message); ok && (id == 0 || m.ID == id) {
+				return m.ID, m.Date
+			}
+		}
+
+		return id, u.Date
+	default:
+		return 0, int(time.Now().Unix())
+	}
+}
+
+func randomID() (int64, error) {
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return 0, err
+	}
+
+	return int64(binary.LittleEndian.Uint64(buf[:])), nil
+}
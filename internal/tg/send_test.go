@@ -0,0 +1,49 @@
+package tg
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+)
+
+func TestSendMessage(t *testing.T) {
+	f := newFixture()
+	c := newTestClient(t, f.Fake)
+
+	rsp := decode[SendResponse](t)(c.SendMessage(SendArguments{Name: "alice", Text: "on my way", ReplyTo: 5}))
+	if rsp.ID != 7 {
+		t.Fatalf("id = %d, want 7", rsp.ID)
+	}
+
+	last := f.alice.Messages[len(f.alice.Messages)-1]
+	if last.ID != rsp.ID || !last.Out || last.Message != "on my way" {
+		t.Fatalf("unexpected sent message: %+v", last)
+	}
+}
+
+func TestSendMessageDeniedWithoutDialog(t *testing.T) {
+	for _, rule := range []string{"@stranger", "type:bot"} {
+		t.Run(rule, func(t *testing.T) {
+			f := newFixture()
+			f.AddUser(&tg.User{ID: 50, AccessHash: 5050, FirstName: "Stranger", Username: "stranger", Bot: true})
+			// telegram has no dialog with a user never written to
+			f.Handle(tg.MessagesGetPeerDialogsRequestTypeID, func(context.Context, bin.Encoder) (bin.Encoder, error) {
+				return &tg.MessagesPeerDialogs{State: tg.UpdatesState{}}, nil
+			})
+
+			policy, err := LoadPolicy("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := policy.Merge(false, nil, []string{rule}); err != nil {
+				t.Fatal(err)
+			}
+			c := newTestClient(t, f.Fake, WithPolicy(policy))
+
+			_, err = c.SendMessage(SendArguments{Name: "@stranger", Text: "hi"})
+			requireCode(t, err, CodePolicyDenied)
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package tg
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/gotd/td/session"
+	"github.com/gotd/td/telegram"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	// encryptedMagic starts every encrypted session file and is authenticated with the payload.
+	encryptedMagic = "TGMCP-ENC1\n"
+	saltSize       = 16
+
+	argonTime    = 1
+	argonMemory  = 64 * 1024
+	argonThreads = 4
+)
+
+// ErrSessionNotEncrypted is returned when an encrypted storage reads a plaintext session.
+var ErrSessionNotEncrypted = fmt.Errorf("session file is not encrypted, run migrate command: %w", ErrSessionInvalid)
+
+// NewSessionStorage returns encrypted file storage when secret is set and plaintext file storage otherwise.
+func NewSessionStorage(path string, secret []byte) telegram.SessionStorage {
+	if len(secret) == 0 {
+		return &telegram.FileSessionStorage{Path: path}
+	}
+
+	return &EncryptedSessionStorage{Path: path, Secret: secret}
+}
+
+// EncryptedSessionStorage keeps the session in a file sealed with XChaCha20-Poly1305,
+// the key is derived from Secret with Argon2id and a random salt per write.
+type EncryptedSessionStorage struct {
+	Path   string
+	Secret []byte
+
+	mu sync.Mutex
+}
+
+// LoadSession implements telegram.SessionStorage.
+func (s *EncryptedSessionStorage) LoadSession(_ context.Context) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return nil, session.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read session: %w", err)
+	}
+
+	return openSession(s.Secret, data)
+}
+
+// StoreSession implements telegram.SessionStorage.
+func (s *EncryptedSessionStorage) StoreSession(_ context.Context, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sealed, err := sealSession(s.Secret, data)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.Path, sealed)
+}
+
+func sealSession(secret, plain []byte) ([]byte, error) {
+	return newSealer(secret).seal(plain)
+}
+
+func openSession(secret, data []byte) ([]byte, error) {
+	return newSealer(secret).open(data)
+}
+
+// sealer encrypts files like the session, caching the derived key so frequent writes of
+// side files do not pay for Argon2 every time. Nil sealer keeps files plaintext.
+type sealer struct {
+	secret []byte
+
+	mu   sync.Mutex
+	salt []byte
+	key  []byte
+}
+
+func newSealer(secret []byte) *sealer {
+	if len(secret) == 0 {
+		return nil
+	}
+
+	return &sealer{secret: secret}
+}
+
+// sealerOf returns the sealer of encrypted session storage, nil for plaintext one.
+func sealerOf(storage telegram.SessionStorage) *sealer {
+	if s, ok := storage.(*EncryptedSessionStorage); ok {
+		return newSealer(s.Secret)
+	}
+
+	return nil
+}
+
+func (s *sealer) keyFor(salt []byte) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.key == nil || !bytes.Equal(s.salt, salt) {
+		s.salt, s.key = bytes.Clone(salt), sessionKey(s.secret, salt)
+	}
+
+	return s.key
+}
+
+func (s *sealer) seal(plain []byte) ([]byte, error) {
+	s.mu.Lock()
+	salt := s.salt
+	s.mu.Unlock()
+
+	if salt == nil {
+		salt = make([]byte, saltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, fmt.Errorf("generate salt: %w", err)
+		}
+	}
+
+	aead, err := chacha20poly1305.NewX(s.keyFor(salt))
+	if err != nil {
+		return nil, fmt.Errorf("init cipher: %w", err)
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+
+	out := make([]byte, 0, len(encryptedMagic)+len(salt)+len(nonce)+len(plain)+aead.Overhead())
+	out = append(out, encryptedMagic...)
+	out = append(out, salt...)
+	out = append(out, nonce...)
+
+	return aead.Seal(out, nonce, plain, []byte(encryptedMagic)), nil
+}
+
+func (s *sealer) open(data []byte) ([]byte, error) {
+	if !isEncryptedSession(data) {
+		return nil, ErrSessionNotEncrypted
+	}
+
+	data = data[len(encryptedMagic):]
+	if len(data) < saltSize+chacha20poly1305.NonceSizeX {
+		return nil, errors.Wrap(ErrSessionInvalid, "encrypted session is truncated")
+	}
+
+	salt, data := data[:saltSize], data[saltSize:]
+	aead, err := chacha20poly1305.NewX(s.keyFor(salt))
+	if err != nil {
+		return nil, fmt.Errorf("init cipher: %w", err)
+	}
+
+	nonce, data := data[:aead.NonceSize()], data[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, data, []byte(encryptedMagic))
+	if err != nil {
+		return nil, errors.Wrap(ErrSessionInvalid, "decrypt session: wrong passphrase or corrupted file")
+	}
+
+	return plain, nil
+}
+
+// readSealed reads a side file of the session, plaintext files are accepted and get encrypted on the next write.
+func readSealed(path string, s *sealer) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil || !isEncryptedSession(data) {
+		return data, err
+	}
+
+	if s == nil {
+		return nil, errors.Wrapf(ErrSessionInvalid, "%s is encrypted, session passphrase or key file is required", path)
+	}
+
+	return s.open(data)
+}
+
+// writeSealed writes a side file of the session, encrypted when s is set.
+func writeSealed(path string, data []byte, s *sealer) error {
+	if s != nil {
+		sealed, err := s.seal(data)
+		if err != nil {
+			return err
+		}
+		data = sealed
+	}
+
+	return writeFileAtomic(path, data)
+}
+
+func isEncryptedSession(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(encryptedMagic))
+}
+
+func sessionKey(secret, salt []byte) []byte {
+	return argon2.IDKey(secret, salt, argonTime, argonMemory, argonThreads, chacha20poly1305.KeySize)
+}
+
+// MigrateSession encrypts a plaintext session file, its peer cache, updates state and archive in place,
+// or decrypts them back when decrypt is set. Files already in the wanted form are left as is.
+func MigrateSession(path string, secret []byte, decrypt bool) error {
+	if len(secret) == 0 {
+		return errors.New("session passphrase or key file is required")
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("read session: %w", err)
+	}
+
+	s := newSealer(secret)
+	for _, p := range []string{path, peersPath(path), updatesPath(path)} {
+		if err := migrateFile(p, s, decrypt); err != nil {
+			return err
+		}
+	}
+
+	return migrateArchive(ArchivePath(path), secret, decrypt)
+}
+
+func migrateFile(path string, s *sealer, decrypt bool) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read %s: %w", path, err)
+	}
+
+	if isEncryptedSession(data) != decrypt {
+		return nil
+	}
+
+	if decrypt {
+		plain, err := s.open(data)
+		if err != nil {
+			return errors.Wrap(err, path)
+		}
+
+		return writeFileAtomic(path, plain)
+	}
+
+	return writeSealed(path, data, s)
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("write %s: %w", tmp, err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("rename %s: %w", tmp, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,232 @@
+package tg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gotd/td/session"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestEncryptedSessionStorage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.json")
+	plain := []byte(`{"auth_key":"secret"}`)
+	ctx := context.Background()
+
+	if _, err := NewSessionStorage(path, []byte("passphrase")).LoadSession(ctx); !errors.Is(err, session.ErrNotFound) {
+		t.Fatalf("load of missing session = %v, want not found", err)
+	}
+	if err := NewSessionStorage(path, []byte("passphrase")).StoreSession(ctx, plain); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(path); err != nil || !isEncryptedSession(data) || bytes.Contains(data, plain) {
+		t.Fatalf("stored session is not sealed: %q, %v", data, err)
+	}
+
+	tests := []struct {
+		name   string
+		secret string
+		want   error
+	}{
+		{"same passphrase", "passphrase", nil},
+		{"wrong passphrase", "other", ErrSessionInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewSessionStorage(path, []byte(tt.secret)).LoadSession(ctx)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("load error = %v, want %v", err, tt.want)
+			}
+			if tt.want == nil && !bytes.Equal(got, plain) {
+				t.Fatalf("loaded %q, want %q", got, plain)
+			}
+		})
+	}
+}
+
+func TestOpenSessionInvalid(t *testing.T) {
+	secret := []byte("passphrase")
+	sealed, err := sealSession(secret, []byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := bytes.Clone(sealed)
+	tampered[len(tampered)-1] ^= 1
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"plaintext", []byte(`{"auth_key":"secret"}`), ErrSessionNotEncrypted},
+		{"truncated", sealed[:len(encryptedMagic)+saltSize], ErrSessionInvalid},
+		{"tampered", tampered, ErrSessionInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := openSession(secret, tt.data); !errors.Is(err, tt.want) {
+				t.Fatalf("open error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMigrateSessionSideFiles(t *testing.T) {
+	secret := []byte("passphrase")
+	sessionPath := filepath.Join(t.TempDir(), "session.json")
+	files := map[string]string{
+		sessionPath:              `{"auth_key":"secret"}`,
+		peersPath(sessionPath):   `[{"id":10,"access_hash":1010}]`,
+		updatesPath(sessionPath): `{}`,
+	}
+	for path, data := range files {
+		if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := MigrateSession(sessionPath, secret, false); err != nil {
+		t.Fatal(err)
+	}
+	for path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil || !isEncryptedSession(data) {
+			t.Fatalf("%s is not encrypted: %v", path, err)
+		}
+	}
+
+	// the peer cache is readable only with the key
+	s := newPeerStore(peersPath(sessionPath), newSealer(secret))
+	if _, ok := s.record(peerKey{peerKindUser, 10}); !ok {
+		t.Fatal("peer cache lost after encryption")
+	}
+	if _, err := readSealed(peersPath(sessionPath), nil); err == nil {
+		t.Fatal("encrypted peer cache read without key")
+	}
+
+	// migrating twice is a no-op
+	if err := MigrateSession(sessionPath, secret, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := MigrateSession(sessionPath, secret, true); err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range files {
+		if data, err := os.ReadFile(path); err != nil || string(data) != want {
+			t.Fatalf("%s = %q, %v after decrypt", path, data, err)
+		}
+	}
+}
+
+// archiveSealed reports whether every peer and message value of the archive is encrypted.
+func archiveSealed(t *testing.T, path string) bool {
+	t.Helper()
+
+	a, err := OpenArchive(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = a.Close() }()
+
+	sealed := true
+	if err := a.db.View(func(tx *bolt.Tx) error {
+		check := func(_, v []byte) error {
+			sealed = sealed && isEncryptedSession(v)
+			return nil
+		}
+		if err := tx.Bucket(bucketPeers).ForEach(check); err != nil {
+			return err
+		}
+
+		return tx.Bucket(bucketMessages).Bucket(peerKey{peerKindUser, 10}.bytes()).ForEach(check)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	return sealed
+}
+
+func TestMigrateSessionArchive(t *testing.T) {
+	secret := []byte("passphrase")
+	sessionPath := filepath.Join(t.TempDir(), "session.json")
+	if err := os.WriteFile(sessionPath, []byte(`{"auth_key":"secret"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	key := peerKey{peerKindUser, 10}
+	put := func(secret []byte, id int) {
+		t.Helper()
+
+		a, err := OpenArchive(ArchivePath(sessionPath), secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = a.Close() }()
+
+		if err := a.db.Update(func(tx *bolt.Tx) error {
+			if err := a.putJSON(tx.Bucket(bucketPeers), key.bytes(), peerRecord{ID: 10, AccessHash: 1010}); err != nil {
+				return err
+			}
+
+			b, err := tx.Bucket(bucketMessages).CreateBucketIfNotExists(key.bytes())
+			if err != nil {
+				return err
+			}
+
+			return a.putJSON(b, messageKey(id), archivedMessage{MessageInfo: MessageInfo{ID: id, Text: "hello"}})
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	put(nil, 1)
+	if err := MigrateSession(sessionPath, secret, false); err != nil {
+		t.Fatal(err)
+	}
+	if !archiveSealed(t, ArchivePath(sessionPath)) {
+		t.Fatal("archive is not encrypted after migration")
+	}
+
+	// values are readable only with the key, new ones are sealed too
+	a, err := OpenArchive(ArchivePath(sessionPath), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := a.peer(key); !errors.Is(err, ErrSessionInvalid) {
+		t.Fatalf("encrypted archive read without key: %v", err)
+	}
+	_ = a.Close()
+
+	put(secret, 2)
+	if !archiveSealed(t, ArchivePath(sessionPath)) {
+		t.Fatal("archive value written with key is not encrypted")
+	}
+
+	a, err = OpenArchive(ArchivePath(sessionPath), secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, ok, err := a.peer(key)
+	if err != nil || !ok || r.AccessHash != 1010 {
+		t.Fatalf("peer = %+v, %v, %v", r, ok, err)
+	}
+	_ = a.Close()
+
+	if err := MigrateSession(sessionPath, secret, true); err != nil {
+		t.Fatal(err)
+	}
+	a, err = OpenArchive(ArchivePath(sessionPath), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = a.Close() }()
+	messages, _, err := a.history(key, historyQuery{HistoryArguments: HistoryArguments{Limit: 10}}, 0)
+	if err != nil || len(messages) != 2 {
+		t.Fatalf("history after decrypt = %+v, %v", messages, err)
+	}
+}
@@ -0,0 +1,248 @@
+package tg
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gotd/td/tg"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultSyncDepth limits messages fetched per dialog by one sync.
+const DefaultSyncDepth = 1000
+
+// SyncOptions selects what Sync copies into the archive.
+type SyncOptions struct {
+	// Dialogs to sync by name, all allowed dialogs of both folders when empty.
+	Dialogs []string
+	// Depth is the number of messages fetched per dialog by one sync, zero fetches everything.
+	// New messages go first, the rest of the depth continues below the oldest archived message.
+	Depth int
+}
+
+// SyncResult counts what Sync fetched.
+type SyncResult struct {
+	Dialogs  int
+	Messages int
+	// Partial counts dialogs whose archive does not reach the beginning of the history yet
+	Partial int
+}
+
+// syncTarget is a dialog to sync, top is its newest message id when known.
+type syncTarget struct {
+	name      string
+	inputPeer tg.InputPeerClass
+	top       int
+}
+
+// Sync copies dialogs and messages newer than the archived ones into the archive.
+// It waits for the connection started by Run and stops when ctx is done.
+func (c *Client) Sync(ctx context.Context, opts SyncOptions) (SyncResult, error) {
+	var result SyncResult
+	if _, err := c.localArchive(); err != nil {
+		return result, err
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+
+	api, err := c.waitAPI(waitCtx)
+	if err != nil {
+		return result, err
+	}
+
+	var targets []syncTarget
+	if len(opts.Dialogs) > 0 {
+		for _, name := range opts.Dialogs {
+			inputPeer, err := c.resolvePeer(ctx, api, name, accessRead)
+			if err != nil {
+				return result, errors.Wrapf(err, "dialog %q", name)
+			}
+
+			targets = append(targets, syncTarget{name: name, inputPeer: inputPeer})
+		}
+	} else {
+		for _, folder := range []int{0, ArchiveFolderID} {
+			folderTargets, err := c.syncTargets(ctx, api, folder)
+			if err != nil {
+				return result, err
+			}
+
+			targets = append(targets, folderTargets...)
+		}
+	}
+
+	for _, t := range targets {
+		n, complete, err := c.syncDialog(ctx, api, t, opts.Depth)
+		if err != nil {
+			return result, errors.Wrapf(err, "sync %s", t.name)
+		}
+
+		result.Dialogs++
+		result.Messages += n
+		if !complete {
+			result.Partial++
+		}
+		log.Info().Str("dialog", t.name).Int("messages", n).Bool("complete", complete).Msg("dialog synced")
+	}
+
+	return result, nil
+}
+
+// syncTargets lists allowed dialogs of the folder, the archive records them while paging.
+func (c *Client) syncTargets(ctx context.Context, api *tg.Client, folder int) ([]syncTarget, error) {
+	var (
+		targets []syncTarget
+		offset  = DialogsOffset{Peer: &tg.InputPeerEmpty{}}
+	)
+	for {
+		req := &tg.MessagesGetDialogsRequest{
+			OffsetPeer: c.peers.withAccessHash(offset.Peer),
+			OffsetID:   offset.MsgID,
+			OffsetDate: offset.Date,
+			Limit:      DefaultDialogsLimit,
+		}
+		req.SetFolderID(folder)
+
+		dc, err := api.MessagesGetDialogs(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get dialogs: %w", err)
+		}
+
+		d, err := newDialogs(dc, dialogsFilter{}, c.policy)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get dialogs")
+		}
+
+		for _, dItem := range d.Dialogs {
+			dialogItem, ok := dItem.(*tg.Dialog)
+			if !ok || !c.policy.allows(d.subject(dialogItem)) {
+				continue
+			}
+
+			targets = append(targets, syncTarget{
+				name:      d.peerName(dialogItem.Peer),
+				inputPeer: d.inputPeer(dialogItem.Peer),
+				top:       dialogItem.TopMessage,
+			})
+		}
+
+		next := d.Offset()
+		if next.Peer == nil || len(d.Dialogs) == 0 {
+			return targets, nil
+		}
+
+		offset = next
+	}
+}
+
+// syncDialog fetches messages newer than the synced range first, then continues below it until
+// the beginning of the history, at most depth messages in total. It reports whether the archive
+// holds the whole history of the dialog.
+func (c *Client) syncDialog(ctx context.Context, api *tg.Client, t syncTarget, depth int) (int, bool, error) {
+	key, ok := inputPeerKey(t.inputPeer)
+	if !ok {
+		return 0, false, errors.Errorf("unexpected peer %T", t.inputPeer)
+	}
+
+	state, err := c.archive.syncState(key)
+	if err != nil {
+		return 0, false, errors.Wrap(err, "read archive")
+	}
+	if state.Complete && t.top != 0 && t.top <= state.Newest {
+		return 0, true, nil
+	}
+
+	// newer messages, down to the synced range
+	newer, err := c.syncRange(ctx, api, t.inputPeer, 0, state.Newest, depth)
+	if err != nil {
+		return newer.fetched, false, err
+	}
+
+	switch {
+	case newer.fetched == 0:
+		state.Complete = state.Complete || state.Newest == 0
+	case state.Newest == 0 || !newer.reached:
+		// first sync, or depth left a gap above the synced range which is fetched again below
+		state = syncState{Newest: newer.newest, Oldest: newer.oldest, Complete: newer.reached}
+	default:
+		state.Newest = newer.newest
+	}
+
+	fetched := newer.fetched
+	if !state.Complete && state.Oldest > 0 && (depth == 0 || fetched < depth) {
+		budget := 0
+		if depth > 0 {
+			budget = depth - fetched
+		}
+
+		older, err := c.syncRange(ctx, api, t.inputPeer, state.Oldest, 0, budget)
+		fetched += older.fetched
+		if older.fetched > 0 {
+			state.Oldest = older.oldest
+		}
+		state.Complete = older.reached
+		if err != nil {
+			// keep what was archived so far
+			_ = c.archive.setSyncState(key, state)
+			return fetched, false, err
+		}
+	}
+
+	if err := c.archive.setSyncState(key, state); err != nil {
+		return fetched, false, errors.Wrap(err, "write archive")
+	}
+
+	return fetched, state.Complete, nil
+}
+
+// syncPage is what syncRange fetched, reached is set when it got to minID or to the beginning.
+type syncPage struct {
+	fetched, oldest, newest int
+	reached                 bool
+}
+
+// syncRange pages history down from offsetID (the top when zero) to minID, at most budget messages unless zero.
+// The archive middleware records the pages.
+func (c *Client) syncRange(ctx context.Context, api *tg.Client, peer tg.InputPeerClass, offsetID, minID, budget int) (syncPage, error) {
+	var p syncPage
+	for budget == 0 || p.fetched < budget {
+		limit := MaxHistoryLimit
+		if budget > 0 {
+			limit = min(limit, budget-p.fetched)
+		}
+
+		raw, err := api.MessagesGetHistory(ctx, &tg.MessagesGetHistoryRequest{
+			Peer:     peer,
+			OffsetID: offsetID,
+			MinID:    minID,
+			Limit:    limit,
+		})
+		if err != nil {
+			return p, fmt.Errorf("failed to get history: %w", err)
+		}
+
+		h, err := newHistory(raw)
+		if err != nil {
+			return p, errors.Wrap(err, "failed to process history")
+		}
+
+		for _, msg := range h.Messages {
+			id := msg.GetID()
+			if p.oldest == 0 || id < p.oldest {
+				p.oldest = id
+			}
+			p.newest = max(p.newest, id)
+		}
+		offsetID = p.oldest
+
+		p.fetched += len(h.Messages)
+		if len(h.Messages) < limit {
+			p.reached = true
+			break
+		}
+	}
+
+	return p, nil
+}
@@ -0,0 +1,76 @@
+package tg
+
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// archivedCount returns the number of archived messages of the peer.
+func archivedCount(t *testing.T, a *Archive, key peerKey) int {
+	t.Helper()
+
+	var n int
+	if err := a.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(bucketMessages).Bucket(key.bytes()); b != nil {
+			n = b.Stats().KeyN
+		}
+
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	return n
+}
+
+func TestSyncBackfill(t *testing.T) {
+	f := newFixture()
+	for i := range 230 {
+		f.bob.Message(bobID, 0, "message "+strconv.Itoa(i))
+	}
+
+	a, err := OpenArchive(filepath.Join(t.TempDir(), "session.archive.db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = a.Close() })
+	c := newTestClient(t, f.Fake, WithArchive(a))
+
+	key := peerKey{peerKindUser, bobID}
+	opts := SyncOptions{Dialogs: []string{"Bob"}, Depth: 100}
+
+	result, err := c.Sync(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Messages != 100 || result.Partial != 1 {
+		t.Fatalf("unexpected first sync: %+v", result)
+	}
+
+	// new messages come first, the rest of the depth goes to older history
+	for i := range 5 {
+		f.bob.Message(bobID, 0, "new "+strconv.Itoa(i))
+	}
+	if result, err = c.Sync(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	if result.Messages != 100 || result.Partial != 1 || archivedCount(t, a, key) != 200 {
+		t.Fatalf("unexpected second sync: %+v, archived %d", result, archivedCount(t, a, key))
+	}
+
+	if result, err = c.Sync(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	if result.Partial != 0 || archivedCount(t, a, key) != len(f.bob.Messages) {
+		t.Fatalf("unexpected last sync: %+v, archived %d of %d", result, archivedCount(t, a, key), len(f.bob.Messages))
+	}
+
+	// nothing new, nothing fetched
+	if result, err = c.Sync(context.Background(), opts); err != nil || result.Messages != 0 {
+		t.Fatalf("unexpected sync without news: %+v, %v", result, err)
+	}
+}
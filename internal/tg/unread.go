@@ -0,0 +1,239 @@
+package tg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/gotd/td/tg"
+	mcp "github.com/metoro-io/mcp-golang"
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultUnreadPerDialog = 20
+	DefaultUnreadDialogs   = 20
+)
+
+// nolint:lll
+type UnreadArguments struct {
+	Limit      int `json:"limit,omitempty" jsonschema:"description=Maximum unread messages per dialog (default 20)"`
+	MaxDialogs int `json:"max_dialogs,omitempty" jsonschema:"description=Maximum dialogs to include (default 20)"`
+
+	AccountArgument
+}
+
+type UnreadDialog struct {
+	Name            string        `json:"name"`
+	Type            string        `json:"type"`
+	Title           string        `json:"title"`
+	UnreadCount     int           `json:"unread_count"`
+	UnreadMentions  int           `json:"unread_mentions,omitempty"`
+	UnreadReactions int           `json:"unread_reactions,omitempty"`
+	Messages        []MessageInfo `json:"messages"`
+	Truncated       bool          `json:"truncated,omitempty"`
+	// Error is set when unread messages of the dialog could not be fetched
+	Error string `json:"error,omitempty"`
+}
+
+type UnreadResponse struct {
+	Dialogs []UnreadDialog `json:"dialogs"`
+	// More is set when more dialogs than max_dialogs have unread messages
+	More bool `json:"more,omitempty"`
+}
+
+// unreadItem is an unread dialog with the page it was listed on.
+type unreadItem struct {
+	d      *dialogs
+	dialog *tg.Dialog
+}
+
+// GetUnread collects unread incoming messages of every unread dialog in a single call.
+func (c *Client) GetUnread(args UnreadArguments) (*mcp.ToolResponse, error) {
+	rsp, err := c.Unread(args)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonData, err := json.Marshal(rsp)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal response")
+	}
+
+	return mcp.NewToolResponse(mcp.NewTextContent(string(jsonData))), nil
+}
+
+// Unread returns unread digest, see GetUnread.
+func (c *Client) Unread(args UnreadArguments) (*UnreadResponse, error) {
+	perDialog := args.Limit
+	if perDialog <= 0 {
+		perDialog = DefaultUnreadPerDialog
+	}
+
+	maxDialogs := args.MaxDialogs
+	if maxDialogs <= 0 {
+		maxDialogs = DefaultUnreadDialogs
+	}
+
+	rsp := UnreadResponse{Dialogs: make([]UnreadDialog, 0)}
+	if err := c.run(func(ctx context.Context, api *tg.Client) error {
+		unread, err := c.unreadDialogs(ctx, api, maxDialogs)
+		if err != nil {
+			return err
+		}
+
+		if len(unread) > maxDialogs {
+			unread, rsp.More = unread[:maxDialogs], true
+		}
+
+		for _, u := range unread {
+			item, err := u.d.unreadDialog(ctx, api, u.dialog, perDialog)
+			if err != nil {
+				if ctx.Err() != nil {
+					return err
+				}
+
+				item = UnreadDialog{
+					Name:        u.d.peerName(u.dialog.Peer),
+					UnreadCount: u.dialog.UnreadCount,
+					Messages:    []MessageInfo{},
+					Truncated:   true,
+					Error:       err.Error(),
+				}
+			}
+
+			rsp.Dialogs = append(rsp.Dialogs, item)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "failed to get unread messages")
+	}
+
+	return &rsp, nil
+}
+
+// unreadDialogs pages through dialogs until more than limit unread ones are found, newest first.
+// Pinned dialogs come first regardless of date, so only the rest count towards the limit.
+func (c *Client) unreadDialogs(ctx context.Context, api *tg.Client, limit int) ([]unreadItem, error) {
+	var (
+		unread   []unreadItem
+		unpinned int
+		offset   = DialogsOffset{Peer: &tg.InputPeerEmpty{}}
+	)
+	for {
+		dc, err := api.MessagesGetDialogs(ctx, &tg.MessagesGetDialogsRequest{
+			OffsetPeer: c.peers.withAccessHash(offset.Peer),
+			OffsetID:   offset.MsgID,
+			OffsetDate: offset.Date,
+			Limit:      DefaultDialogsLimit,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get dialogs: %w", err)
+		}
+
+		d, err := newDialogs(dc, dialogsFilter{onlyUnread: true}, c.policy)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to process dialogs")
+		}
+		d.textFormat = c.textFormat
+
+		for _, dialogItem := range d.unreadDialogs() {
+			unread = append(unread, unreadItem{d: d, dialog: dialogItem})
+			if !dialogItem.Pinned {
+				unpinned++
+			}
+		}
+
+		next := d.Offset()
+		if unpinned > limit || next.Peer == nil || len(d.Dialogs) == 0 {
+			break
+		}
+
+		offset = next
+	}
+
+	sort.SliceStable(unread, func(i, j int) bool {
+		return unread[i].d.topDate(unread[i].dialog) > unread[j].d.topDate(unread[j].dialog)
+	})
+
+	return unread, nil
+}
+
+// unreadDialogs returns allowed dialogs with unread messages, newest first.
+func (d *dialogs) unreadDialogs() []*tg.Dialog {
+	unread := make([]*tg.Dialog, 0, len(d.Dialogs))
+	for _, dItem := range d.Dialogs {
+		dialogItem, ok := dItem.(*tg.Dialog)
+		if !ok || dialogItem.UnreadCount == 0 {
+			continue
+		}
+
+		if !d.policy.allows(d.subject(dialogItem)) {
+			continue
+		}
+
+		unread = append(unread, dialogItem)
+	}
+
+	sort.SliceStable(unread, func(i, j int) bool {
+		return d.topDate(unread[i]) > d.topDate(unread[j])
+	})
+
+	return unread
+}
+
+func (d *dialogs) topDate(dialogItem *tg.Dialog) int {
+	if msg, ok := d.messages[getPeerID(dialogItem.Peer)]; ok {
+		return msg.Date
+	}
+
+	return 0
+}
+
+// unreadDialog fetches incoming messages newer than read_inbox_max_id.
+func (d *dialogs) unreadDialog(ctx context.Context, api *tg.Client, dialogItem *tg.Dialog, limit int) (UnreadDialog, error) {
+	info, err := d.processDialog(dialogItem)
+	if err != nil {
+		return UnreadDialog{}, err
+	}
+
+	messagesClass, err := api.MessagesGetHistory(ctx, &tg.MessagesGetHistoryRequest{
+		Peer:  d.inputPeer(dialogItem.Peer),
+		Limit: limit,
+		MinID: dialogItem.ReadInboxMaxID,
+	})
+	if err != nil {
+		return UnreadDialog{}, fmt.Errorf("failed to get history: %w", err)
+	}
+
+	h, err := newHistory(messagesClass)
+	if err != nil {
+		return UnreadDialog{}, errors.Wrap(err, "failed to process history")
+	}
+	h.textFormat = d.textFormat
+
+	messages := make([]MessageInfo, 0, len(h.Messages))
+	for _, msg := range h.Messages {
+		m, ok := msg.(*tg.Message)
+		if !ok || m.Out || m.ID <= dialogItem.ReadInboxMaxID {
+			continue
+		}
+
+		mi := h.messageInfo(m)
+		mi.IsUnread = true
+		messages = append(messages, mi)
+	}
+
+	return UnreadDialog{
+		Name:            info.Name,
+		Type:            info.Type,
+		Title:           info.Title,
+		UnreadCount:     dialogItem.UnreadCount,
+		UnreadMentions:  dialogItem.UnreadMentionsCount,
+		UnreadReactions: dialogItem.UnreadReactionsCount,
+		Messages:        messages,
+		Truncated:       dialogItem.UnreadCount > len(messages),
+	}, nil
+}
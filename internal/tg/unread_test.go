@@ -0,0 +1,75 @@
+package tg
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/chaindead/telegram-mcp/internal/tgtest"
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+func TestGetUnread(t *testing.T) {
+	f := newFixture()
+	c := newTestClient(t, f.Fake)
+
+	rsp := decode[UnreadResponse](t)(c.GetUnread(UnreadArguments{}))
+
+	var names []string
+	for _, d := range rsp.Dialogs {
+		names = append(names, d.Name)
+	}
+	if want := []string{"daily_news", "alice", "cht[20]"}; !slices.Equal(names, want) {
+		t.Fatalf("dialogs = %v, want %v", names, want)
+	}
+
+	alice := rsp.Dialogs[1]
+	if alice.UnreadCount != 2 || !slices.Equal(messageIDs(alice.Messages), []int{5, 4}) {
+		t.Fatalf("unexpected unread dialog: %+v", alice)
+	}
+}
+
+func TestGetUnreadPaging(t *testing.T) {
+	f := newFixture()
+	// read dialogs newer than the unread ones fill the first page
+	for i := range DefaultDialogsLimit + 20 {
+		d := f.AddUser(&tg.User{ID: int64(1000 + i), AccessHash: 1, FirstName: "Reader"})
+		d.Message(tgtest.SelfID, 0, "seen")
+	}
+	c := newTestClient(t, f.Fake)
+
+	rsp := decode[UnreadResponse](t)(c.GetUnread(UnreadArguments{}))
+	if len(rsp.Dialogs) != 3 || rsp.More {
+		t.Fatalf("unexpected unread dialogs: %+v", rsp)
+	}
+
+	rsp = decode[UnreadResponse](t)(c.GetUnread(UnreadArguments{MaxDialogs: 2}))
+	if len(rsp.Dialogs) != 2 || !rsp.More {
+		t.Fatalf("unexpected limited unread dialogs: %+v", rsp)
+	}
+}
+
+func TestGetUnreadDialogError(t *testing.T) {
+	f := newFixture()
+	f.Handle(tg.MessagesGetHistoryRequestTypeID, func(ctx context.Context, input bin.Encoder) (bin.Encoder, error) {
+		if req := input.(*tg.MessagesGetHistoryRequest); getInputPeerIDValue(req.Peer) == aliceID {
+			return nil, tgerr.New(500, "INTERNAL_SERVER_ERROR")
+		}
+
+		return f.Serve(ctx, input)
+	})
+	c := newTestClient(t, f.Fake)
+
+	rsp := decode[UnreadResponse](t)(c.GetUnread(UnreadArguments{}))
+	if len(rsp.Dialogs) != 3 {
+		t.Fatalf("dialogs = %+v", rsp.Dialogs)
+	}
+	if alice := rsp.Dialogs[1]; alice.Name != "alice" || alice.Error == "" || alice.UnreadCount != 2 {
+		t.Fatalf("unexpected failed dialog: %+v", alice)
+	}
+	if rsp.Dialogs[0].Error != "" || len(rsp.Dialogs[0].Messages) == 0 {
+		t.Fatalf("unexpected dialog: %+v", rsp.Dialogs[0])
+	}
+}
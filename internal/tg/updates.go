@@ -0,0 +1,325 @@
+package tg
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/telegram/updates"
+	"github.com/gotd/td/tg"
+	mcp "github.com/metoro-io/mcp-golang"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DefaultUpdatesBuffer = 1000
+	DefaultUpdatesLimit  = 100
+	MaxUpdatesWait       = time.Minute
+)
+
+type UpdateKind string
+
+const (
+	UpdateNew    UpdateKind = "new"
+	UpdateEdit   UpdateKind = "edit"
+	UpdateDelete UpdateKind = "delete"
+)
+
+// UpdateInfo is a new, edited or deleted message received from Telegram.
+type UpdateInfo struct {
+	Seq     int64        `json:"seq"`
+	Kind    UpdateKind   `json:"kind"`
+	Dialog  string       `json:"dialog,omitempty"`
+	Message *MessageInfo `json:"message,omitempty"`
+	Deleted []int        `json:"deleted,omitempty"`
+	When    string       `json:"when"`
+
+	key    peerKey
+	hasKey bool
+}
+
+// nolint:lll
+type UpdatesArguments struct {
+	Since int64  `json:"since,omitempty" jsonschema:"description=Return updates after this seq (next of the previous call)\\, 0 returns the whole buffer"`
+	Name  string `json:"name,omitempty" jsonschema:"description=Only updates of this dialog"`
+	Wait  int    `json:"wait,omitempty" jsonschema:"description=Seconds to wait for an update when there is none yet (max 60)"`
+	Limit int    `json:"limit,omitempty" jsonschema:"description=Maximum number of updates (default 100)"`
+
+	AccountArgument
+}
+
+type UpdatesResponse struct {
+	Updates []UpdateInfo `json:"updates"`
+	Next    int64        `json:"next"`
+	// Missed is set when updates after since were dropped from the buffer or the server restarted.
+	Missed bool `json:"missed,omitempty"`
+}
+
+// updateBuffer keeps the latest updates in memory, seq grows by one per update.
+type updateBuffer struct {
+	size int
+
+	mu      sync.Mutex
+	seq     int64
+	updates []UpdateInfo
+	// changed is closed and replaced on every push
+	changed chan struct{}
+}
+
+func newUpdateBuffer(size int) *updateBuffer {
+	return &updateBuffer{size: size, changed: make(chan struct{})}
+}
+
+func (b *updateBuffer) push(u UpdateInfo) UpdateInfo {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	u.Seq = b.seq
+	b.updates = append(b.updates, u)
+	if len(b.updates) > b.size {
+		b.updates = append(b.updates[:0], b.updates[len(b.updates)-b.size:]...)
+	}
+
+	close(b.changed)
+	b.changed = make(chan struct{})
+
+	return u
+}
+
+// since returns updates after seq matching the filter, at most limit of them.
+func (b *updateBuffer) since(seq int64, match func(UpdateInfo) bool, limit int) UpdatesResponse {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	rsp := UpdatesResponse{Updates: []UpdateInfo{}, Next: b.seq}
+	if seq > b.seq {
+		// seq of a previous server run
+		seq, rsp.Missed = 0, true
+	}
+	if seq > 0 && len(b.updates) > 0 && b.updates[0].Seq > seq+1 {
+		rsp.Missed = true
+	}
+
+	for _, u := range b.updates {
+		if u.Seq <= seq || !match(u) {
+			continue
+		}
+
+		rsp.Updates = append(rsp.Updates, u)
+		if len(rsp.Updates) == limit {
+			rsp.Next = u.Seq
+			break
+		}
+	}
+
+	return rsp
+}
+
+// wait blocks until an update after seq arrives or ctx is done.
+func (b *updateBuffer) wait(ctx context.Context, seq int64) {
+	b.mu.Lock()
+	last, changed := b.seq, b.changed
+	b.mu.Unlock()
+
+	if last > seq {
+		return
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-changed:
+	}
+}
+
+// OnUpdate sets a callback for every buffered update, it must be set before Run.
+func (c *Client) OnUpdate(f func(UpdateInfo)) {
+	c.onUpdate = f
+}
+
+// updatesManager returns gap handling manager dispatching updates into the buffer, nil when updates are disabled.
+func (c *Client) updatesManager() *updates.Manager {
+	if c.updates == nil {
+		return nil
+	}
+
+	d := tg.NewUpdateDispatcher()
+	d.OnNewMessage(func(_ context.Context, e tg.Entities, u *tg.UpdateNewMessage) error {
+		c.pushMessage(e, UpdateNew, u.Message)
+		return nil
+	})
+	d.OnNewChannelMessage(func(_ context.Context, e tg.Entities, u *tg.UpdateNewChannelMessage) error {
+		c.pushMessage(e, UpdateNew, u.Message)
+		return nil
+	})
+	d.OnEditMessage(func(_ context.Context, e tg.Entities, u *tg.UpdateEditMessage) error {
+		c.pushMessage(e, UpdateEdit, u.Message)
+		return nil
+	})
+	d.OnEditChannelMessage(func(_ context.Context, e tg.Entities, u *tg.UpdateEditChannelMessage) error {
+		c.pushMessage(e, UpdateEdit, u.Message)
+		return nil
+	})
+	d.OnDeleteMessages(func(_ context.Context, _ tg.Entities, u *tg.UpdateDeleteMessages) error {
+		c.pushDeleted(u.Messages)
+		return nil
+	})
+	d.OnDeleteChannelMessages(func(_ context.Context, _ tg.Entities, u *tg.UpdateDeleteChannelMessages) error {
+		key := peerKey{peerKindChannel, u.ChannelID}
+		if c.localAllowed(key) {
+			c.pushUpdate(UpdateInfo{Kind: UpdateDelete, Dialog: c.localName(key), Deleted: u.Messages, key: key, hasKey: true})
+		}
+		return nil
+	})
+
+	d.OnFolderPeers(func(_ context.Context, _ tg.Entities, u *tg.UpdateFolderPeers) error {
+		for _, p := range u.FolderPeers {
+			if key, ok := peerKeyOf(p.Peer); ok {
+				c.peers.setFolder(key, p.FolderID)
+			}
+		}
+		return nil
+	})
+
+	return updates.New(updates.Config{
+		Handler:      d,
+		Storage:      c.updatesState,
+		AccessHasher: c.peers,
+	})
+}
+
+func (c *Client) pushMessage(e tg.Entities, kind UpdateKind, raw tg.MessageClass) {
+	m, ok := raw.(*tg.Message)
+	if !ok {
+		return
+	}
+
+	h := &history{
+		MessagesMessages: tg.MessagesMessages{Messages: []tg.MessageClass{m}},
+		users:            e.Users,
+		chats:            e.Chats,
+		channels:         e.Channels,
+		textFormat:       c.textFormat,
+	}
+	for _, u := range e.Users {
+		h.Users = append(h.Users, u)
+	}
+	for _, ch := range e.Chats {
+		h.Chats = append(h.Chats, ch)
+	}
+	for _, ch := range e.Channels {
+		h.Chats = append(h.Chats, ch)
+	}
+
+	// pushed updates bypass middlewares, so entities are recorded here
+	c.peers.apply(h.Users, h.Chats)
+	if c.archive != nil {
+		if err := c.archive.record(&tg.MessagesMessagesBox{Messages: &h.MessagesMessages}, c.peers); err != nil {
+			log.Warn().Err(err).Msg("failed to archive update")
+		}
+	}
+
+	key, ok := peerKeyOf(m.PeerID)
+	if !ok || !c.localAllowed(key) {
+		return
+	}
+
+	name := h.dialogName(m.PeerID)
+	if name == "" {
+		name = c.localName(key)
+	}
+
+	info := h.messageInfo(m)
+	c.pushUpdate(UpdateInfo{Kind: kind, Dialog: name, Message: &info, key: key, hasKey: true})
+}
+
+// pushDeleted pushes deletions in private chats and basic groups. Telegram does not tell the dialog,
+// so ids are attributed through the archive; with policy rules set, ids of unknown dialogs are dropped.
+func (c *Client) pushDeleted(ids []int) {
+	var byPeer map[peerKey][]int
+	if c.archive != nil {
+		var err error
+		if byPeer, err = c.archive.messagePeers(ids); err != nil {
+			log.Warn().Err(err).Msg("failed to find dialogs of deleted messages")
+		}
+	}
+
+	attributed := make(map[int]bool, len(ids))
+	for key, deleted := range byPeer {
+		for _, id := range deleted {
+			attributed[id] = true
+		}
+
+		if c.localAllowed(key) {
+			c.pushUpdate(UpdateInfo{Kind: UpdateDelete, Dialog: c.localName(key), Deleted: deleted, key: key, hasKey: true})
+		}
+	}
+
+	if c.policy.restricted() {
+		return
+	}
+
+	var unknown []int
+	for _, id := range ids {
+		if !attributed[id] {
+			unknown = append(unknown, id)
+		}
+	}
+	if len(unknown) > 0 {
+		c.pushUpdate(UpdateInfo{Kind: UpdateDelete, Deleted: unknown})
+	}
+}
+
+func (c *Client) pushUpdate(u UpdateInfo) {
+	u.When = time.Now().Format(time.DateTime)
+	u = c.updates.push(u)
+
+	if c.onUpdate != nil {
+		c.onUpdate(u)
+	}
+}
+
+// GetUpdates returns buffered updates after since, optionally waiting for the next one.
+func (c *Client) GetUpdates(args UpdatesArguments) (*mcp.ToolResponse, error) {
+	if c.updates == nil {
+		return nil, errors.Wrap(ErrInvalidArgument, "updates are disabled, start the server with --updates")
+	}
+
+	match := func(UpdateInfo) bool { return true }
+	if args.Name != "" {
+		key, err := c.localPeer(args.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		match = func(u UpdateInfo) bool { return u.hasKey && u.key == key }
+	}
+
+	limit := args.Limit
+	if limit <= 0 {
+		limit = DefaultUpdatesLimit
+	}
+
+	wait := min(time.Duration(args.Wait)*time.Second, MaxUpdatesWait)
+	deadline := time.Now().Add(wait)
+
+	rsp := c.updates.since(args.Since, match, limit)
+	for len(rsp.Updates) == 0 && time.Now().Before(deadline) {
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		c.updates.wait(ctx, rsp.Next)
+		cancel()
+
+		next := c.updates.since(rsp.Next, match, limit)
+		next.Missed = next.Missed || rsp.Missed
+		rsp = next
+	}
+
+	jsonData, err := json.Marshal(rsp)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal response")
+	}
+
+	return mcp.NewToolResponse(mcp.NewTextContent(string(jsonData))), nil
+}
@@ -0,0 +1,214 @@
+package tg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/telegram/updates"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// updatesSaveDelay batches state changes into one write, every update moves pts or seq.
+const updatesSaveDelay = time.Second
+
+var (
+	_ updates.StateStorage        = (*updatesState)(nil)
+	_ updates.ChannelAccessHasher = (*peerStore)(nil)
+)
+
+type userUpdatesState struct {
+	State    updates.State `json:"state"`
+	Channels map[int64]int `json:"channels,omitempty"`
+}
+
+// updatesState persists pts, qts, date, seq and channel pts in a file next to the session,
+// so updates missed while the server was down are fetched on start.
+type updatesState struct {
+	path   string
+	sealer *sealer
+
+	mu    sync.Mutex
+	users map[int64]*userUpdatesState
+	dirty bool
+	timer *time.Timer
+}
+
+// updatesPath returns updates state location for the session file.
+func updatesPath(sessionPath string) string {
+	return strings.TrimSuffix(sessionPath, filepath.Ext(sessionPath)) + ".updates.json"
+}
+
+func newUpdatesState(path string, sealer *sealer) (*updatesState, error) {
+	s := &updatesState{path: path, sealer: sealer, users: make(map[int64]*userUpdatesState)}
+
+	data, err := readSealed(path, sealer)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read updates state: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &s.users); err != nil {
+		return nil, fmt.Errorf("parse updates state: %w", err)
+	}
+
+	return s, nil
+}
+
+func (s *updatesState) save() error {
+	data, err := json.Marshal(s.users)
+	if err != nil {
+		return fmt.Errorf("marshal updates state: %w", err)
+	}
+
+	return writeSealed(s.path, data, s.sealer)
+}
+
+// scheduleSave writes the state after updatesSaveDelay, caller holds the lock.
+// Changes lost on a crash are fetched from telegram again as a difference.
+func (s *updatesState) scheduleSave() {
+	s.dirty = true
+	if s.timer != nil {
+		return
+	}
+
+	s.timer = time.AfterFunc(updatesSaveDelay, func() {
+		if err := s.flush(); err != nil {
+			log.Warn().Err(err).Str("path", s.path).Msg("failed to save updates state")
+		}
+	})
+}
+
+// flush writes pending changes right away.
+func (s *updatesState) flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+
+	if !s.dirty {
+		return nil
+	}
+
+	if err := s.save(); err != nil {
+		return err
+	}
+	s.dirty = false
+
+	return nil
+}
+
+// update changes existing state of the user and schedules saving it.
+func (s *updatesState) update(userID int64, f func(u *userUpdatesState)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return errors.Errorf("updates state of user %d not found", userID)
+	}
+
+	f(u)
+	s.scheduleSave()
+
+	return nil
+}
+
+func (s *updatesState) GetState(_ context.Context, userID int64) (updates.State, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return updates.State{}, false, nil
+	}
+
+	return u.State, true, nil
+}
+
+func (s *updatesState) SetState(_ context.Context, userID int64, state updates.State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users[userID] = &userUpdatesState{State: state, Channels: make(map[int64]int)}
+	s.scheduleSave()
+
+	return nil
+}
+
+func (s *updatesState) SetPts(_ context.Context, userID int64, pts int) error {
+	return s.update(userID, func(u *userUpdatesState) { u.State.Pts = pts })
+}
+
+func (s *updatesState) SetQts(_ context.Context, userID int64, qts int) error {
+	return s.update(userID, func(u *userUpdatesState) { u.State.Qts = qts })
+}
+
+func (s *updatesState) SetDate(_ context.Context, userID int64, date int) error {
+	return s.update(userID, func(u *userUpdatesState) { u.State.Date = date })
+}
+
+func (s *updatesState) SetSeq(_ context.Context, userID int64, seq int) error {
+	return s.update(userID, func(u *userUpdatesState) { u.State.Seq = seq })
+}
+
+func (s *updatesState) SetDateSeq(_ context.Context, userID int64, date, seq int) error {
+	return s.update(userID, func(u *userUpdatesState) { u.State.Date, u.State.Seq = date, seq })
+}
+
+func (s *updatesState) GetChannelPts(_ context.Context, userID, channelID int64) (int, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return 0, false, nil
+	}
+
+	pts, ok := u.Channels[channelID]
+
+	return pts, ok, nil
+}
+
+func (s *updatesState) SetChannelPts(_ context.Context, userID, channelID int64, pts int) error {
+	return s.update(userID, func(u *userUpdatesState) {
+		if u.Channels == nil {
+			u.Channels = make(map[int64]int)
+		}
+		u.Channels[channelID] = pts
+	})
+}
+
+func (s *updatesState) ForEachChannels(
+	ctx context.Context,
+	userID int64,
+	f func(ctx context.Context, channelID int64, pts int) error,
+) error {
+	s.mu.Lock()
+	channels := make(map[int64]int)
+	if u, ok := s.users[userID]; ok {
+		for id, pts := range u.Channels {
+			channels[id] = pts
+		}
+	}
+	s.mu.Unlock()
+
+	for id, pts := range channels {
+		if err := f(ctx, id, pts); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
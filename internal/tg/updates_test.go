@@ -0,0 +1,140 @@
+package tg
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/gotd/td/telegram/updates"
+	"github.com/gotd/td/tg"
+)
+
+func TestPushDeleted(t *testing.T) {
+	f := newFixture()
+	a, err := OpenArchive(filepath.Join(t.TempDir(), "session.archive.db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = a.Close() })
+	decode[HistoryResponse](t)(newTestClient(t, f.Fake, WithArchive(a)).GetHistory(HistoryArguments{Name: "alice"}))
+
+	tests := []struct {
+		name string
+		deny []string
+		want []UpdateInfo
+	}{
+		{
+			name: "no rules",
+			want: []UpdateInfo{{Dialog: "alice", Deleted: []int{1}}, {Deleted: []int{999}}},
+		},
+		{
+			name: "allowed dialog",
+			deny: []string{"bob"},
+			want: []UpdateInfo{{Dialog: "alice", Deleted: []int{1}}},
+		},
+		{
+			name: "denied dialog",
+			deny: []string{"alice"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := LoadPolicy("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := policy.Merge(false, nil, tt.deny); err != nil {
+				t.Fatal(err)
+			}
+			c := newTestClient(t, f.Fake, WithArchive(a), WithPolicy(policy), WithUpdates(10))
+
+			c.pushDeleted([]int{1, 999})
+
+			got := c.updates.since(0, func(UpdateInfo) bool { return true }, 10).Updates
+			if !slices.EqualFunc(got, tt.want, func(a, b UpdateInfo) bool {
+				return a.Dialog == b.Dialog && slices.Equal(a.Deleted, b.Deleted)
+			}) {
+				t.Fatalf("updates = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPushMessageFolder(t *testing.T) {
+	f := newFixture()
+	f.bob.Folder = ArchiveFolderID
+	policy, err := LoadPolicy("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := policy.Merge(false, nil, []string{"folder:1"}); err != nil {
+		t.Fatal(err)
+	}
+	c := newTestClient(t, f.Fake, WithPolicy(policy), WithUpdates(10))
+
+	e := tg.Entities{Users: map[int64]*tg.User{
+		aliceID: {ID: aliceID, AccessHash: 1010, Username: "alice"},
+		bobID:   {ID: bobID, AccessHash: 1111, FirstName: "Bob"},
+	}}
+	push := func() []string {
+		t.Helper()
+
+		before := c.updates.since(0, func(UpdateInfo) bool { return true }, 10).Next
+		for _, id := range []int64{aliceID, bobID} {
+			c.pushMessage(e, UpdateNew, &tg.Message{ID: 100, PeerID: &tg.PeerUser{UserID: id}, Message: "hi"})
+		}
+
+		var dialogs []string
+		for _, u := range c.updates.since(before, func(UpdateInfo) bool { return true }, 10).Updates {
+			dialogs = append(dialogs, u.Dialog)
+		}
+
+		return dialogs
+	}
+
+	// the folder is unknown before a listing shows the dialogs
+	if got := push(); len(got) != 0 {
+		t.Fatalf("updates of unknown folder = %v", got)
+	}
+
+	decode[dialogsPage](t)(c.GetDialogs(DialogsArguments{}))
+	decode[dialogsPage](t)(c.GetDialogs(DialogsArguments{Archived: true}))
+	if got, want := push(), []string{"alice"}; !slices.Equal(got, want) {
+		t.Fatalf("updates = %v, want %v", got, want)
+	}
+}
+
+func TestUpdatesStateBatchesWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.updates.json")
+	s, err := newUpdatesState(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.flush() })
+
+	ctx := context.Background()
+	if err := s.SetState(ctx, 1, updates.State{Pts: 1}); err != nil {
+		t.Fatal(err)
+	}
+	for pts := 2; pts <= 100; pts++ {
+		if err := s.SetPts(ctx, 1, pts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("state written before the delay: %v", err)
+	}
+
+	if err := s.flush(); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := newUpdatesState(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state, ok, _ := loaded.GetState(ctx, 1); !ok || state.Pts != 100 {
+		t.Fatalf("saved state = %+v, %v", state, ok)
+	}
+}
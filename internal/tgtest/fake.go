@@ -0,0 +1,847 @@
+// Package tgtest implements an in-process fake of the Telegram API for hermetic tests.
+//
+// Fake is a tg.Invoker answering from a fixture of users, chats, channels and their
+// messages. Responses are encoded and decoded like real ones, so middlewares and
+// response parsing run unchanged. Any method can be scripted with Handle, for example
+// to return FLOOD_WAIT or a method the fixture model does not cover.
+package tgtest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+const (
+	// SelfID is the id of the logged in user of a new fake.
+	SelfID = 1
+	// StartDate is the date of the first message added without an explicit date.
+	StartDate = 1700000000
+)
+
+var _ tg.Invoker = (*Fake)(nil)
+
+// HandlerFunc answers a request instead of the fixture model.
+type HandlerFunc func(ctx context.Context, input bin.Encoder) (bin.Encoder, error)
+
+// Fake is a scriptable Telegram backend, safe for concurrent use.
+type Fake struct {
+	mu sync.Mutex
+
+	self     *tg.User
+	users    map[int64]*tg.User
+	chats    map[int64]*tg.Chat
+	channels map[int64]*tg.Channel
+	dialogs  []*Dialog
+
+	// lastID is the message id counter of private chats and groups, channels have their own
+	lastID   int
+	lastDate int
+	pts      int
+
+	handlers map[uint32]HandlerFunc
+	calls    []bin.Encoder
+}
+
+// Dialog is a chat of the fixture with its messages in ascending id order.
+// Fields may be changed by tests between calls.
+type Dialog struct {
+	Peer           tg.PeerClass
+	Messages       []*tg.Message
+	ReadInboxMaxID int
+	Pinned         bool
+	UnreadMark     bool
+	Folder         int
+	MuteUntil      int
+	// Draft is the text saved by messages.saveDraft.
+	Draft string
+
+	fake   *Fake
+	lastID int
+}
+
+// New returns a fake with the logged in user and no dialogs.
+func New() *Fake {
+	self := &tg.User{
+		ID:         SelfID,
+		AccessHash: SelfID,
+		FirstName:  "Test",
+		LastName:   "User",
+		Username:   "test_user",
+		Self:       true,
+	}
+
+	return &Fake{
+		self:     self,
+		users:    map[int64]*tg.User{SelfID: self},
+		chats:    make(map[int64]*tg.Chat),
+		channels: make(map[int64]*tg.Channel),
+		lastDate: StartDate,
+		handlers: make(map[uint32]HandlerFunc),
+	}
+}
+
+// Self returns the logged in user.
+func (f *Fake) Self() *tg.User {
+	return f.self
+}
+
+// AddUser adds the user with a private dialog, dialogs without messages are not listed.
+func (f *Fake) AddUser(u *tg.User) *Dialog {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.users[u.ID] = u
+	if u.ID == SelfID {
+		// Saved Messages
+		u.Self = true
+		f.self = u
+	}
+
+	return f.addDialog(&tg.PeerUser{UserID: u.ID})
+}
+
+// AddChat adds a basic group.
+func (f *Fake) AddChat(c *tg.Chat) *Dialog {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if c.Photo == nil {
+		c.Photo = &tg.ChatPhotoEmpty{}
+	}
+	f.chats[c.ID] = c
+
+	return f.addDialog(&tg.PeerChat{ChatID: c.ID})
+}
+
+// AddChannel adds a channel or a supergroup.
+func (f *Fake) AddChannel(c *tg.Channel) *Dialog {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if c.Photo == nil {
+		c.Photo = &tg.ChatPhotoEmpty{}
+	}
+	f.channels[c.ID] = c
+
+	return f.addDialog(&tg.PeerChannel{ChannelID: c.ID})
+}
+
+func (f *Fake) addDialog(p tg.PeerClass) *Dialog {
+	d := &Dialog{Peer: p, fake: f}
+	f.dialogs = append(f.dialogs, d)
+
+	return d
+}
+
+// Handle answers requests of the type, e.g. tg.MessagesGetDialogsRequestTypeID, with h.
+func (f *Fake) Handle(typeID uint32, h HandlerFunc) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.handlers[typeID] = h
+}
+
+// Calls returns received requests of the type, all requests when typeID is zero.
+func (f *Fake) Calls(typeID uint32) []bin.Encoder {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var calls []bin.Encoder
+	for _, c := range f.calls {
+		if typeID == 0 || typeOf(c) == typeID {
+			calls = append(calls, c)
+		}
+	}
+
+	return calls
+}
+
+// Message appends a message sent by from at date, zero date follows the previous message by a minute.
+// In private dialogs from is the peer or SelfID, in channels zero posts as the channel.
+func (d *Dialog) Message(from int64, date int, text string) *tg.Message {
+	f := d.fake
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.appendMessage(d, from, date, text)
+}
+
+func (f *Fake) appendMessage(d *Dialog, from int64, date int, text string) *tg.Message {
+	if date == 0 {
+		date = f.lastDate + 60
+	}
+	f.lastDate = max(f.lastDate, date)
+
+	var id int
+	if _, ok := d.Peer.(*tg.PeerChannel); ok {
+		d.lastID++
+		id = d.lastID
+	} else {
+		f.lastID++
+		id = f.lastID
+	}
+
+	m := &tg.Message{
+		ID:      id,
+		PeerID:  d.Peer,
+		Date:    date,
+		Message: text,
+		Out:     from == SelfID,
+	}
+	if _, private := d.Peer.(*tg.PeerUser); !private && from != 0 {
+		m.SetFromID(&tg.PeerUser{UserID: from})
+	}
+	if m.Out {
+		d.ReadInboxMaxID = max(d.ReadInboxMaxID, id)
+	}
+
+	d.Messages = append(d.Messages, m)
+
+	return m
+}
+
+// Invoke implements tg.Invoker.
+func (f *Fake) Invoke(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+	f.mu.Lock()
+	f.calls = append(f.calls, input)
+	h, ok := f.handlers[typeOf(input)]
+	f.mu.Unlock()
+
+	if !ok {
+		h = f.Serve
+	}
+
+	result, err := h(ctx, input)
+	if err != nil {
+		return err
+	}
+
+	var b bin.Buffer
+	if err := result.Encode(&b); err != nil {
+		return fmt.Errorf("encode %T: %w", result, err)
+	}
+
+	return output.Decode(&b)
+}
+
+func typeOf(input bin.Encoder) uint32 {
+	if t, ok := input.(interface{ TypeID() uint32 }); ok {
+		return t.TypeID()
+	}
+
+	return 0
+}
+
+// Serve answers from the fixture model, handlers may call it to fail or alter some of the calls.
+func (f *Fake) Serve(_ context.Context, input bin.Encoder) (bin.Encoder, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch req := input.(type) {
+	case *tg.UsersGetUsersRequest:
+		return f.getUsers(req)
+	case *tg.MessagesGetDialogsRequest:
+		return f.getDialogs(req)
+	case *tg.MessagesGetPeerDialogsRequest:
+		return f.getPeerDialogs(req)
+	case *tg.MessagesGetHistoryRequest:
+		return f.getHistory(req)
+	case *tg.MessagesGetMessagesRequest:
+		return f.getMessages(nil, req.ID)
+	case *tg.ChannelsGetMessagesRequest:
+		d, err := f.channelDialog(req.Channel)
+		if err != nil {
+			return nil, err
+		}
+
+		return f.getMessages(d, req.ID)
+	case *tg.MessagesSearchRequest:
+		return f.search(req)
+	case *tg.MessagesSearchGlobalRequest:
+		return f.searchGlobal(req)
+	case *tg.MessagesSaveDraftRequest:
+		d, err := f.dialog(req.Peer)
+		if err != nil {
+			return nil, err
+		}
+		d.Draft = req.Message
+
+		return &tg.BoolTrue{}, nil
+	case *tg.MessagesReadHistoryRequest:
+		d, err := f.dialog(req.Peer)
+		if err != nil {
+			return nil, err
+		}
+		if !f.read(d, req.MaxID) {
+			return &tg.MessagesAffectedMessages{Pts: f.pts}, nil
+		}
+		f.pts++
+
+		return &tg.MessagesAffectedMessages{Pts: f.pts, PtsCount: 1}, nil
+	case *tg.ChannelsReadHistoryRequest:
+		d, err := f.channelDialog(req.Channel)
+		if err != nil {
+			return nil, err
+		}
+		if !f.read(d, req.MaxID) {
+			return &tg.BoolFalse{}, nil
+		}
+
+		return &tg.BoolTrue{}, nil
+	case *tg.MessagesSendMessageRequest:
+		d, err := f.dialog(req.Peer)
+		if err != nil {
+			return nil, err
+		}
+		m := f.appendMessage(d, SelfID, 0, req.Message)
+		f.pts++
+
+		return &tg.UpdateShortSentMessage{Out: true, ID: m.ID, Pts: f.pts, PtsCount: 1, Date: m.Date}, nil
+	case *tg.ContactsResolveUsernameRequest:
+		return f.resolveUsername(req.Username)
+	case *tg.ContactsResolvePhoneRequest:
+		return f.resolvePhone(req.Phone)
+	case *tg.MessagesCheckChatInviteRequest:
+		return nil, tgerr.New(400, "INVITE_HASH_INVALID")
+	default:
+		return nil, tgerr.New(400, fmt.Sprintf("FAKE_NOT_IMPLEMENTED_%T", input))
+	}
+}
+
+// read marks messages up to maxID as read, reporting whether anything was unread.
+func (f *Fake) read(d *Dialog, maxID int) bool {
+	if maxID == 0 && len(d.Messages) > 0 {
+		maxID = d.Messages[len(d.Messages)-1].ID
+	}
+
+	changed := maxID > d.ReadInboxMaxID || d.UnreadMark
+	d.ReadInboxMaxID = max(d.ReadInboxMaxID, maxID)
+	d.UnreadMark = false
+
+	return changed
+}
+
+func (f *Fake) getUsers(req *tg.UsersGetUsersRequest) (bin.Encoder, error) {
+	var users tg.UserClassVector
+	for _, input := range req.ID {
+		switch u := input.(type) {
+		case *tg.InputUserSelf:
+			users.Elems = append(users.Elems, f.self)
+		case *tg.InputUser:
+			user, ok := f.users[u.UserID]
+			if !ok || user.AccessHash != u.AccessHash {
+				return nil, tgerr.New(400, "USER_ID_INVALID")
+			}
+			users.Elems = append(users.Elems, user)
+		}
+	}
+
+	return &users, nil
+}
+
+// dialog finds the dialog of input peer checking its access hash like Telegram does.
+func (f *Fake) dialog(input tg.InputPeerClass) (*Dialog, error) {
+	var p tg.PeerClass
+	switch v := input.(type) {
+	case *tg.InputPeerSelf:
+		p = &tg.PeerUser{UserID: f.self.ID}
+	case *tg.InputPeerUser:
+		u, ok := f.users[v.UserID]
+		if !ok || u.AccessHash != v.AccessHash {
+			return nil, tgerr.New(400, "PEER_ID_INVALID")
+		}
+		p = &tg.PeerUser{UserID: v.UserID}
+	case *tg.InputPeerChat:
+		if _, ok := f.chats[v.ChatID]; !ok {
+			return nil, tgerr.New(400, "PEER_ID_INVALID")
+		}
+		p = &tg.PeerChat{ChatID: v.ChatID}
+	case *tg.InputPeerChannel:
+		c, ok := f.channels[v.ChannelID]
+		if !ok || c.AccessHash != v.AccessHash {
+			return nil, tgerr.New(400, "CHANNEL_INVALID")
+		}
+		p = &tg.PeerChannel{ChannelID: v.ChannelID}
+	default:
+		return nil, tgerr.New(400, "PEER_ID_INVALID")
+	}
+
+	for _, d := range f.dialogs {
+		if samePeer(d.Peer, p) {
+			return d, nil
+		}
+	}
+
+	// users without a dialog yet, e.g. Saved Messages
+	return f.addDialog(p), nil
+}
+
+func (f *Fake) channelDialog(input tg.InputChannelClass) (*Dialog, error) {
+	c, ok := input.(*tg.InputChannel)
+	if !ok {
+		return nil, tgerr.New(400, "CHANNEL_INVALID")
+	}
+
+	return f.dialog(&tg.InputPeerChannel{ChannelID: c.ChannelID, AccessHash: c.AccessHash})
+}
+
+func samePeer(a, b tg.PeerClass) bool {
+	return a.TypeID() == b.TypeID() && peerID(a) == peerID(b)
+}
+
+func peerID(p tg.PeerClass) int64 {
+	switch v := p.(type) {
+	case *tg.PeerUser:
+		return v.UserID
+	case *tg.PeerChat:
+		return v.ChatID
+	case *tg.PeerChannel:
+		return v.ChannelID
+	default:
+		return 0
+	}
+}
+
+func (d *Dialog) top() *tg.Message {
+	if len(d.Messages) == 0 {
+		return nil
+	}
+
+	return d.Messages[len(d.Messages)-1]
+}
+
+func (d *Dialog) unreadCount() int {
+	var n int
+	for _, m := range d.Messages {
+		if !m.Out && m.ID > d.ReadInboxMaxID {
+			n++
+		}
+	}
+
+	return n
+}
+
+func (d *Dialog) tl() *tg.Dialog {
+	item := &tg.Dialog{
+		Peer:           d.Peer,
+		ReadInboxMaxID: d.ReadInboxMaxID,
+		UnreadCount:    d.unreadCount(),
+		Pinned:         d.Pinned,
+		UnreadMark:     d.UnreadMark,
+		NotifySettings: tg.PeerNotifySettings{},
+	}
+	if top := d.top(); top != nil {
+		item.TopMessage = top.ID
+		item.ReadOutboxMaxID = top.ID
+	}
+	if d.MuteUntil != 0 {
+		item.NotifySettings.SetMuteUntil(d.MuteUntil)
+	}
+	if d.Folder != 0 {
+		item.SetFolderID(d.Folder)
+	}
+
+	return item
+}
+
+// entities collects users and chats referenced by peers and messages.
+type entities struct {
+	f     *Fake
+	users map[int64]bool
+	chats map[int64]bool
+	tl    struct {
+		users []tg.UserClass
+		chats []tg.ChatClass
+	}
+}
+
+func (f *Fake) entities() *entities {
+	return &entities{f: f, users: make(map[int64]bool), chats: make(map[int64]bool)}
+}
+
+func (e *entities) peer(p tg.PeerClass) {
+	switch v := p.(type) {
+	case *tg.PeerUser:
+		if u, ok := e.f.users[v.UserID]; ok && !e.users[v.UserID] {
+			e.users[v.UserID] = true
+			e.tl.users = append(e.tl.users, u)
+		}
+	case *tg.PeerChat:
+		if c, ok := e.f.chats[v.ChatID]; ok && !e.chats[v.ChatID] {
+			e.chats[v.ChatID] = true
+			e.tl.chats = append(e.tl.chats, c)
+		}
+	case *tg.PeerChannel:
+		if c, ok := e.f.channels[v.ChannelID]; ok && !e.chats[v.ChannelID] {
+			e.chats[v.ChannelID] = true
+			e.tl.chats = append(e.tl.chats, c)
+		}
+	}
+}
+
+func (e *entities) message(m *tg.Message) {
+	e.peer(m.PeerID)
+	if m.FromID != nil {
+		e.peer(m.FromID)
+	}
+}
+
+func (f *Fake) messages(messages []*tg.Message) ([]tg.MessageClass, *entities) {
+	e := f.entities()
+	result := make([]tg.MessageClass, 0, len(messages))
+	for _, m := range messages {
+		e.message(m)
+		result = append(result, m)
+	}
+
+	return result, e
+}
+
+// listed returns dialogs with messages in the order of the dialog list: pinned first, then by top message.
+func (f *Fake) listed(folder int) []*Dialog {
+	var list []*Dialog
+	for _, d := range f.dialogs {
+		if d.top() != nil && d.Folder == folder {
+			list = append(list, d)
+		}
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].Pinned != list[j].Pinned {
+			return list[i].Pinned
+		}
+
+		a, b := list[i].top(), list[j].top()
+		if a.Date != b.Date {
+			return a.Date > b.Date
+		}
+
+		return a.ID > b.ID
+	})
+
+	return list
+}
+
+func (f *Fake) getDialogs(req *tg.MessagesGetDialogsRequest) (bin.Encoder, error) {
+	folder, _ := req.GetFolderID()
+	list := f.listed(folder)
+	total := len(list)
+
+	if _, empty := req.OffsetPeer.(*tg.InputPeerEmpty); !empty || req.OffsetDate != 0 || req.OffsetID != 0 {
+		var rest []*Dialog
+		for _, d := range list {
+			top := d.top()
+			if !d.Pinned && (top.Date < req.OffsetDate || top.Date == req.OffsetDate && top.ID < req.OffsetID) {
+				rest = append(rest, d)
+			}
+		}
+		list = rest
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	complete := len(list) == total && len(list) <= limit
+	list = list[:min(limit, len(list))]
+
+	dialogs := make([]tg.DialogClass, 0, len(list))
+	tops := make([]*tg.Message, 0, len(list))
+	e := f.entities()
+	for _, d := range list {
+		dialogs = append(dialogs, d.tl())
+		tops = append(tops, d.top())
+		e.peer(d.Peer)
+	}
+
+	messages, me := f.messages(tops)
+	for _, u := range me.tl.users {
+		e.peer(&tg.PeerUser{UserID: u.GetID()})
+	}
+
+	if complete {
+		return &tg.MessagesDialogs{Dialogs: dialogs, Messages: messages, Users: e.tl.users, Chats: mergeChats(e.tl.chats, me.tl.chats)}, nil
+	}
+
+	return &tg.MessagesDialogsSlice{
+		Count:    total,
+		Dialogs:  dialogs,
+		Messages: messages,
+		Users:    e.tl.users,
+		Chats:    mergeChats(e.tl.chats, me.tl.chats),
+	}, nil
+}
+
+func mergeChats(a, b []tg.ChatClass) []tg.ChatClass {
+	seen := make(map[int64]bool)
+	var result []tg.ChatClass
+	for _, c := range append(a, b...) {
+		if !seen[c.GetID()] {
+			seen[c.GetID()] = true
+			result = append(result, c)
+		}
+	}
+
+	return result
+}
+
+func (f *Fake) getPeerDialogs(req *tg.MessagesGetPeerDialogsRequest) (bin.Encoder, error) {
+	rsp := &tg.MessagesPeerDialogs{}
+	e := f.entities()
+	var tops []*tg.Message
+	for _, p := range req.Peers {
+		dp, ok := p.(*tg.InputDialogPeer)
+		if !ok {
+			continue
+		}
+
+		d, err := f.dialog(dp.Peer)
+		if err != nil {
+			return nil, err
+		}
+
+		rsp.Dialogs = append(rsp.Dialogs, d.tl())
+		e.peer(d.Peer)
+		if top := d.top(); top != nil {
+			tops = append(tops, top)
+		}
+	}
+
+	messages, me := f.messages(tops)
+	rsp.Messages = messages
+	rsp.Users = e.tl.users
+	for _, u := range me.tl.users {
+		if !e.users[u.GetID()] {
+			rsp.Users = append(rsp.Users, u)
+		}
+	}
+	rsp.Chats = mergeChats(e.tl.chats, me.tl.chats)
+
+	return rsp, nil
+}
+
+// window applies getHistory paging to messages in descending id order.
+func window(desc []*tg.Message, offsetID, offsetDate, addOffset, limit int) []*tg.Message {
+	start := 0
+	switch {
+	case offsetID > 0:
+		start = sort.Search(len(desc), func(i int) bool { return desc[i].ID < offsetID })
+	case offsetDate > 0:
+		start = sort.Search(len(desc), func(i int) bool { return desc[i].Date < offsetDate })
+	}
+
+	start += addOffset
+	end := start + limit
+	start = max(start, 0)
+	end = min(max(end, 0), len(desc))
+	if start >= end {
+		return nil
+	}
+
+	return desc[start:end]
+}
+
+func descending(messages []*tg.Message, keep func(m *tg.Message) bool) []*tg.Message {
+	var desc []*tg.Message
+	for i := len(messages) - 1; i >= 0; i-- {
+		if keep(messages[i]) {
+			desc = append(desc, messages[i])
+		}
+	}
+
+	return desc
+}
+
+func (f *Fake) historyResult(d *Dialog, found []*tg.Message, count int) bin.Encoder {
+	messages, e := f.messages(found)
+	if _, ok := d.Peer.(*tg.PeerChannel); ok {
+		return &tg.MessagesChannelMessages{Count: count, Messages: messages, Users: e.tl.users, Chats: e.tl.chats}
+	}
+
+	if len(found) == count {
+		return &tg.MessagesMessages{Messages: messages, Users: e.tl.users, Chats: e.tl.chats}
+	}
+
+	return &tg.MessagesMessagesSlice{Count: count, Messages: messages, Users: e.tl.users, Chats: e.tl.chats}
+}
+
+func (f *Fake) getHistory(req *tg.MessagesGetHistoryRequest) (bin.Encoder, error) {
+	d, err := f.dialog(req.Peer)
+	if err != nil {
+		return nil, err
+	}
+
+	desc := descending(d.Messages, func(m *tg.Message) bool {
+		return (req.MinID == 0 || m.ID > req.MinID) && (req.MaxID == 0 || m.ID < req.MaxID)
+	})
+
+	return f.historyResult(d, window(desc, req.OffsetID, req.OffsetDate, req.AddOffset, req.Limit), len(desc)), nil
+}
+
+func (f *Fake) getMessages(d *Dialog, ids []tg.InputMessageClass) (bin.Encoder, error) {
+	var found []*tg.Message
+	for _, input := range ids {
+		id, ok := input.(*tg.InputMessageID)
+		if !ok {
+			continue
+		}
+
+		for _, candidate := range f.dialogs {
+			if d != nil && candidate != d {
+				continue
+			}
+			if _, channel := candidate.Peer.(*tg.PeerChannel); d == nil && channel {
+				continue
+			}
+
+			for _, m := range candidate.Messages {
+				if m.ID == id.ID {
+					found = append(found, m)
+				}
+			}
+		}
+	}
+
+	if d != nil {
+		return f.historyResult(d, found, len(found)), nil
+	}
+
+	messages, e := f.messages(found)
+
+	return &tg.MessagesMessages{Messages: messages, Users: e.tl.users, Chats: e.tl.chats}, nil
+}
+
+// matches reports whether m satisfies text, sender and date filters of a search.
+func matches(m *tg.Message, q string, from tg.PeerClass, minDate, maxDate int) bool {
+	if q != "" && !strings.Contains(strings.ToLower(m.Message), strings.ToLower(q)) {
+		return false
+	}
+	if minDate > 0 && m.Date < minDate || maxDate > 0 && m.Date > maxDate {
+		return false
+	}
+	if from == nil {
+		return true
+	}
+
+	sender := m.FromID
+	if sender == nil {
+		sender = m.PeerID
+		if m.Out {
+			sender = &tg.PeerUser{UserID: SelfID}
+		}
+	}
+
+	return samePeer(sender, from)
+}
+
+func (f *Fake) inputPeerOf(input tg.InputPeerClass) tg.PeerClass {
+	switch v := input.(type) {
+	case *tg.InputPeerSelf:
+		return &tg.PeerUser{UserID: f.self.ID}
+	case *tg.InputPeerUser:
+		return &tg.PeerUser{UserID: v.UserID}
+	case *tg.InputPeerChat:
+		return &tg.PeerChat{ChatID: v.ChatID}
+	case *tg.InputPeerChannel:
+		return &tg.PeerChannel{ChannelID: v.ChannelID}
+	default:
+		return nil
+	}
+}
+
+func (f *Fake) search(req *tg.MessagesSearchRequest) (bin.Encoder, error) {
+	d, err := f.dialog(req.Peer)
+	if err != nil {
+		return nil, err
+	}
+
+	var from tg.PeerClass
+	if input, ok := req.GetFromID(); ok {
+		from = f.inputPeerOf(input)
+	}
+
+	desc := descending(d.Messages, func(m *tg.Message) bool {
+		return matches(m, req.Q, from, req.MinDate, req.MaxDate)
+	})
+
+	return f.historyResult(d, window(desc, req.OffsetID, 0, req.AddOffset, req.Limit), len(desc)), nil
+}
+
+func (f *Fake) searchGlobal(req *tg.MessagesSearchGlobalRequest) (bin.Encoder, error) {
+	var found []*tg.Message
+	for _, d := range f.dialogs {
+		if folder, ok := req.GetFolderID(); ok && d.Folder != folder {
+			continue
+		}
+
+		for _, m := range d.Messages {
+			if matches(m, req.Q, nil, req.MinDate, req.MaxDate) {
+				found = append(found, m)
+			}
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].Date != found[j].Date {
+			return found[i].Date > found[j].Date
+		}
+
+		return found[i].ID > found[j].ID
+	})
+	count := len(found)
+
+	if req.OffsetRate > 0 {
+		i := sort.Search(len(found), func(i int) bool {
+			m := found[i]
+			return m.Date < req.OffsetRate || m.Date == req.OffsetRate && m.ID < req.OffsetID
+		})
+		found = found[i:]
+	}
+
+	page := found[:min(req.Limit, len(found))]
+	messages, e := f.messages(page)
+	if len(page) == count {
+		return &tg.MessagesMessages{Messages: messages, Users: e.tl.users, Chats: e.tl.chats}, nil
+	}
+
+	rsp := &tg.MessagesMessagesSlice{Count: count, Messages: messages, Users: e.tl.users, Chats: e.tl.chats}
+	if len(page) < len(found) {
+		rsp.SetNextRate(page[len(page)-1].Date)
+	}
+
+	return rsp, nil
+}
+
+func (f *Fake) resolveUsername(username string) (bin.Encoder, error) {
+	username = strings.ToLower(strings.TrimPrefix(username, "@"))
+	for _, u := range f.users {
+		if strings.ToLower(u.Username) == username {
+			return &tg.ContactsResolvedPeer{Peer: &tg.PeerUser{UserID: u.ID}, Users: []tg.UserClass{u}}, nil
+		}
+	}
+
+	for _, c := range f.channels {
+		if strings.ToLower(c.Username) == username {
+			return &tg.ContactsResolvedPeer{Peer: &tg.PeerChannel{ChannelID: c.ID}, Chats: []tg.ChatClass{c}}, nil
+		}
+	}
+
+	return nil, tgerr.New(400, "USERNAME_NOT_OCCUPIED")
+}
+
+func (f *Fake) resolvePhone(phone string) (bin.Encoder, error) {
+	for _, u := range f.users {
+		if u.Phone != "" && u.Phone == phone {
+			return &tg.ContactsResolvedPeer{Peer: &tg.PeerUser{UserID: u.ID}, Users: []tg.UserClass{u}}, nil
+		}
+	}
+
+	return nil, tgerr.New(400, "PHONE_NOT_OCCUPIED")
+}
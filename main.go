@@ -3,7 +3,12 @@ package main
 import (
 	"context"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/chaindead/telegram-mcp/internal/tg"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -36,6 +41,10 @@ func main() {
 
 	configDir := filepath.Join(homeDir, dir)
 	sesionPath := filepath.Join(configDir, "session.json")
+	policyPath := filepath.Join(configDir, "policy.json")
+	promptsPath := filepath.Join(configDir, "prompts.json")
+	downloadDir := filepath.Join(configDir, "downloads")
+	profilesDir := filepath.Join(configDir, "profiles")
 
 	app := &cli.Command{
 		Name:  "telegram-mcp",
@@ -59,14 +68,124 @@ func main() {
 				Value:   sesionPath,
 				Sources: cli.EnvVars("TG_SESSION_PATH"),
 			},
+			&cli.StringFlag{
+				Name:    "profiles-dir",
+				Usage:   "Directory with named account profiles, each served next to --session account",
+				Value:   profilesDir,
+				Sources: cli.EnvVars("TG_PROFILES_DIR"),
+			},
+			&cli.StringFlag{
+				Name:        "session-passphrase",
+				Usage:       "Passphrase to encrypt session file with",
+				HideDefault: true,
+				Sources:     cli.EnvVars("TG_SESSION_PASSPHRASE"),
+			},
+			&cli.StringFlag{
+				Name:    "session-key-file",
+				Usage:   "File with a key to encrypt session file with",
+				Sources: cli.EnvVars("TG_SESSION_KEY_FILE"),
+			},
+			&cli.StringFlag{
+				Name:    "transport",
+				Usage:   "MCP transport: stdio or http (streamable HTTP on /mcp and SSE on /sse)",
+				Value:   transportStdio,
+				Sources: cli.EnvVars("TG_TRANSPORT"),
+			},
+			&cli.StringFlag{
+				Name:    "listen",
+				Usage:   "Listen address for http transport",
+				Value:   "127.0.0.1:8080",
+				Sources: cli.EnvVars("TG_LISTEN"),
+			},
+			&cli.StringFlag{
+				Name:        "http-token",
+				Usage:       "Bearer token required by http transport",
+				HideDefault: true,
+				Sources:     cli.EnvVars("TG_HTTP_TOKEN"),
+			},
+			&cli.BoolFlag{
+				Name:        "allow-send",
+				Usage:       "Enable tg_send_message tool that delivers messages instead of saving drafts",
+				HideDefault: true,
+				Sources:     cli.EnvVars("TG_ALLOW_SEND"),
+			},
+			&cli.StringFlag{
+				Name:    "policy",
+				Usage:   "Path to policy file with read_only, allow and deny rules",
+				Value:   policyPath,
+				Sources: cli.EnvVars("TG_POLICY_PATH"),
+			},
+			&cli.StringFlag{
+				Name:    "prompts",
+				Usage:   "Path to prompts file adding and overriding built-in prompts",
+				Value:   promptsPath,
+				Sources: cli.EnvVars("TG_PROMPTS_PATH"),
+			},
 			&cli.BoolFlag{
-				Name:        "dry",
-				Usage:       "Test configuration",
-				Local:       true,
+				Name:        "read-only",
+				Usage:       "Forbid drafts, sending and marking dialogs as read",
 				HideDefault: true,
+				Sources:     cli.EnvVars("TG_READ_ONLY"),
+			},
+			&cli.StringSliceFlag{
+				Name:    "allow",
+				Usage:   "Allow only matching dialogs: username, cht[ID], chn[ID], id:ID, type:T or folder:N",
+				Sources: cli.EnvVars("TG_ALLOW"),
+			},
+			&cli.StringSliceFlag{
+				Name:    "deny",
+				Usage:   "Deny matching dialogs: username, cht[ID], chn[ID], id:ID, type:T or folder:N",
+				Sources: cli.EnvVars("TG_DENY"),
+			},
+			&cli.StringFlag{
+				Name:    "download-dir",
+				Usage:   "Directory for tg_download_media files, empty disables downloads",
+				Value:   downloadDir,
+				Sources: cli.EnvVars("TG_DOWNLOAD_DIR"),
+			},
+			&cli.IntFlag{
+				Name:    "max-download-size",
+				Usage:   "Maximum size of downloaded file in bytes",
+				Value:   tg.DefaultMaxDownloadSize,
+				Sources: cli.EnvVars("TG_MAX_DOWNLOAD_SIZE"),
+			},
+			&cli.StringFlag{
+				Name:    "text-format",
+				Usage:   "Rendering of message formatting and hidden links: " + strings.Join(tg.TextFormats, ", "),
+				Value:   tg.DefaultTextFormat,
+				Sources: cli.EnvVars("TG_TEXT_FORMAT"),
+			},
+			&cli.FloatFlag{
+				Name:    "rate",
+				Usage:   "Maximum Telegram API requests per second per account, 0 disables the limit",
+				Value:   tg.DefaultRate,
+				Sources: cli.EnvVars("TG_RATE"),
+			},
+			&cli.StringSliceFlag{
+				Name:    "method-rate",
+				Usage:   "Per method requests per second, e.g. messages.search=0.5",
+				Sources: cli.EnvVars("TG_METHOD_RATE"),
+			},
+			&cli.DurationFlag{
+				Name:    "max-flood-wait",
+				Usage:   "Longest FLOOD_WAIT to sleep and retry, longer ones are reported to the client",
+				Value:   tg.DefaultMaxFloodWait,
+				Sources: cli.EnvVars("TG_MAX_FLOOD_WAIT"),
+			},
+			&cli.BoolFlag{
+				Name:        "archive",
+				Usage:       "Record dialogs and messages seen by tools into local archive next to session, enables source=local",
+				HideDefault: true,
+				Sources:     cli.EnvVars("TG_ARCHIVE"),
+			},
+			&cli.BoolFlag{
+				Name:        "updates",
+				Usage:       "Receive new, edited and deleted messages for tg_updates_since and resource notifications",
+				HideDefault: true,
+				Sources:     cli.EnvVars("TG_UPDATES"),
 			},
 		},
-		Commands: []*cli.Command{
+		Commands: append([]*cli.Command{
 			{
 				Name:  "auth",
 				Usage: "Authenticate with Telegram",
@@ -84,17 +203,90 @@ func main() {
 					},
 					&cli.BoolFlag{
 						Name:        "new",
-						Usage:       "Remove old session and create new one",
+						Usage:       "Remove old session with its peer cache, update state and archive, and create new one",
 						HideDefault: true,
 					},
+					&cli.StringFlag{
+						Name:  "profile",
+						Usage: "Create named account profile in profiles dir instead of --session account",
+					},
 				},
 				Action: authCommand,
 			},
-		},
+			{
+				Name:  "sync",
+				Usage: "Copy dialogs and new messages into local archive",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "account",
+						Usage: "Sync only this account profile",
+					},
+					&cli.StringSliceFlag{
+						Name:  "dialog",
+						Usage: "Sync only this dialog, repeatable",
+					},
+					&cli.IntFlag{
+						Name:  "depth",
+						Usage: "Maximum messages fetched per dialog by one run, new ones first and then older history, 0 fetches whole history",
+						Value: tg.DefaultSyncDepth,
+					},
+				},
+				Action: syncCommand,
+			},
+			{
+				Name:  "migrate",
+				Usage: "Encrypt existing plaintext session with session passphrase or key file",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:        "decrypt",
+						Usage:       "Decrypt session back to plaintext",
+						HideDefault: true,
+					},
+				},
+				Action: migrateCommand,
+			},
+			{
+				Name:      "export",
+				Usage:     "Export whole history of a dialog to files, an interrupted export resumes on the next run",
+				ArgsUsage: "<dialog>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "account",
+						Usage: "Account profile to export from, default account if empty",
+					},
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "Export format: " + strings.Join(tg.ExportFormats, ", ") + " (Telegram Desktop result.json)",
+						Value: tg.ExportJSON,
+					},
+					&cli.StringFlag{
+						Name:  "out",
+						Usage: "Directory for the export and media, export-<dialog> if empty",
+					},
+					&cli.StringFlag{
+						Name:  "since",
+						Usage: "Only messages after this time (unix, RFC3339, 2006-01-02 15:04:05 or 2006-01-02)",
+					},
+					&cli.StringFlag{
+						Name:  "until",
+						Usage: "Only messages before this time (unix, RFC3339, 2006-01-02 15:04:05 or 2006-01-02)",
+					},
+					&cli.BoolFlag{
+						Name:        "media",
+						Usage:       "Download photos and documents into the media directory of the export",
+						HideDefault: true,
+					},
+				},
+				Action: exportCommand,
+			},
+		}, toolCommands()...),
 		Action: serve,
 	}
 
-	if err := app.Run(context.Background(), os.Args); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := app.Run(ctx, os.Args); err != nil {
 		log.Fatal().Msg(err.Error())
 	}
 }
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/chaindead/telegram-mcp/internal/tg"
+
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v3"
+)
+
+const (
+	profileConfigFile  = "profile.json"
+	profileSessionFile = "session.json"
+	profilePolicyFile  = "policy.json"
+)
+
+var profileNameRe = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// profileConfig overrides root app credentials for a profile.
+type profileConfig struct {
+	AppID   int64  `json:"app_id,omitempty"`
+	APIHash string `json:"api_hash,omitempty"`
+}
+
+func validateProfile(name string) error {
+	if !profileNameRe.MatchString(name) || name == "." || name == ".." {
+		return fmt.Errorf("invalid profile name %q: use letters, digits, '_', '-' and '.'", name)
+	}
+
+	if name == tg.DefaultAccount {
+		return fmt.Errorf("profile name %q is reserved for --session account", name)
+	}
+
+	return nil
+}
+
+func profileDir(cmd *cli.Command, name string) string {
+	return filepath.Join(cmd.Root().String("profiles-dir"), name)
+}
+
+func saveProfile(dir string, cfg profileConfig) error {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal profile: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("mkdir(%s): %w", dir, err)
+	}
+
+	path := filepath.Join(dir, profileConfigFile)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("write profile(%s): %w", path, err)
+	}
+
+	return nil
+}
+
+func loadProfile(dir string) (profileConfig, error) {
+	var cfg profileConfig
+
+	data, err := os.ReadFile(filepath.Join(dir, profileConfigFile))
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("read profile: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("parse profile: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// account is a loaded profile ready to be added to tg.Accounts.
+type account struct {
+	name    string
+	client  *tg.Client
+	policy  *tg.Policy
+	archive *tg.Archive
+}
+
+func closeAccounts(accounts []account) {
+	for _, acc := range accounts {
+		if acc.archive == nil {
+			continue
+		}
+
+		if err := acc.archive.Close(); err != nil {
+			log.Warn().Err(err).Str("account", acc.name).Msg("close archive")
+		}
+	}
+}
+
+// accountOptions enables optional features of loaded accounts.
+type accountOptions struct {
+	// archive records responses into the archive next to the session
+	archive bool
+	// updates receives updates from telegram into the updates buffer
+	updates bool
+}
+
+// sessionPaths lists existing session files: --session and the session of every profile.
+func sessionPaths(cmd *cli.Command) ([]string, error) {
+	var paths []string
+	if sessionPath := cmd.Root().String("session"); sessionPath != "" {
+		if _, err := os.Stat(sessionPath); err == nil {
+			paths = append(paths, sessionPath)
+		}
+	}
+
+	entries, err := os.ReadDir(cmd.Root().String("profiles-dir"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read profiles: %w", err)
+	}
+
+	for _, e := range entries {
+		if !e.IsDir() || validateProfile(e.Name()) != nil {
+			continue
+		}
+
+		profileSession := filepath.Join(profileDir(cmd, e.Name()), profileSessionFile)
+		if _, err := os.Stat(profileSession); err == nil {
+			paths = append(paths, profileSession)
+		}
+	}
+
+	return paths, nil
+}
+
+// loadAccounts loads the --session account as default and every profile with a session in profiles dir.
+func loadAccounts(cmd *cli.Command, opts accountOptions) (accounts []account, err error) {
+	secret, err := sessionSecret(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			closeAccounts(accounts)
+		}
+	}()
+
+	sessionPath := cmd.String("session")
+	if _, err := os.Stat(sessionPath); err == nil {
+		acc, err := newAccount(cmd, tg.DefaultAccount, profileConfig{}, sessionPath, cmd.String("policy"), secret, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		accounts = append(accounts, acc)
+	}
+
+	entries, err := os.ReadDir(cmd.String("profiles-dir"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read profiles: %w", err)
+	}
+
+	for _, e := range entries {
+		if !e.IsDir() || validateProfile(e.Name()) != nil {
+			continue
+		}
+
+		dir := profileDir(cmd, e.Name())
+		profileSession := filepath.Join(dir, profileSessionFile)
+		if _, err := os.Stat(profileSession); err != nil {
+			continue
+		}
+
+		cfg, err := loadProfile(dir)
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %w", e.Name(), err)
+		}
+
+		policyPath := filepath.Join(dir, profilePolicyFile)
+		if _, err := os.Stat(policyPath); err != nil {
+			policyPath = cmd.String("policy")
+		}
+
+		acc, err := newAccount(cmd, e.Name(), cfg, profileSession, policyPath, secret, opts)
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %w", e.Name(), err)
+		}
+
+		accounts = append(accounts, acc)
+	}
+
+	if len(accounts) == 0 {
+		return nil, fmt.Errorf("session file not found(%s) and no profiles in %s, run auth command",
+			sessionPath, cmd.String("profiles-dir"))
+	}
+
+	return accounts, nil
+}
+
+func newAccount(
+	cmd *cli.Command,
+	name string,
+	cfg profileConfig,
+	sessionPath, policyPath string,
+	secret []byte,
+	accOpts accountOptions,
+) (account, error) {
+	appID, appHash := cmd.Int("app-id"), cmd.String("api-hash")
+	if cfg.AppID != 0 {
+		appID = cfg.AppID
+	}
+	if cfg.APIHash != "" {
+		appHash = cfg.APIHash
+	}
+
+	policy, err := tg.LoadPolicy(policyPath)
+	if err != nil {
+		return account{}, fmt.Errorf("load policy: %w", err)
+	}
+	// root flags apply to every account on top of its policy file, see Policy.Merge
+	if err := policy.Merge(cmd.Bool("read-only"), cmd.StringSlice("allow"), cmd.StringSlice("deny")); err != nil {
+		return account{}, fmt.Errorf("policy flags: %w", err)
+	}
+
+	methodRates, err := tg.ParseMethodRates(cmd.StringSlice("method-rate"))
+	if err != nil {
+		return account{}, err
+	}
+
+	textFormat := cmd.String("text-format")
+	if !slices.Contains(tg.TextFormats, textFormat) {
+		return account{}, fmt.Errorf("unknown text format %q, use one of %s", textFormat, strings.Join(tg.TextFormats, ", "))
+	}
+
+	downloadDir := cmd.String("download-dir")
+	if downloadDir != "" && name != tg.DefaultAccount {
+		downloadDir = filepath.Join(downloadDir, name)
+	}
+
+	opts := []tg.Option{
+		tg.WithSessionStorage(tg.NewSessionStorage(sessionPath, secret)),
+		tg.WithPolicy(policy),
+		tg.WithDownloads(downloadDir, cmd.Int("max-download-size")),
+		tg.WithTextFormat(textFormat),
+		tg.WithRateLimit(tg.RateLimit{
+			Rate:         cmd.Float("rate"),
+			Methods:      methodRates,
+			MaxFloodWait: cmd.Duration("max-flood-wait"),
+		}),
+	}
+
+	if accOpts.updates {
+		opts = append(opts, tg.WithUpdates(tg.DefaultUpdatesBuffer))
+	}
+
+	var a *tg.Archive
+	if accOpts.archive {
+		a, err = tg.OpenArchive(tg.ArchivePath(sessionPath), secret)
+		if err != nil {
+			return account{}, err
+		}
+
+		opts = append(opts, tg.WithArchive(a))
+	}
+
+	client := tg.New(int(appID), appHash, sessionPath, opts...)
+
+	return account{name: name, client: client, policy: policy, archive: a}, nil
+}
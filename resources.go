@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/chaindead/telegram-mcp/internal/mcphttp"
+	"github.com/chaindead/telegram-mcp/internal/tg"
+
+	mcp "github.com/metoro-io/mcp-golang"
+	"github.com/metoro-io/mcp-golang/transport"
+	"github.com/rs/zerolog/log"
+)
+
+// dialogResources keeps dialog resources in sync with tg_dialogs and tracks subscriptions of clients.
+type dialogResources struct {
+	server   *mcp.Server
+	accounts *tg.Accounts
+
+	mu     sync.Mutex
+	listed map[string]bool
+	// subscribed uris by session, stdio has the only session ""
+	subscribed map[string]map[string]bool
+}
+
+func newDialogResources(accounts *tg.Accounts) *dialogResources {
+	return &dialogResources{accounts: accounts, listed: make(map[string]bool), subscribed: make(map[string]map[string]bool)}
+}
+
+// refresh registers dialogs allowed now and drops the ones gone since the previous listing.
+func (d *dialogResources) refresh(ctx context.Context) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	listed := make(map[string]bool)
+	for _, r := range d.accounts.Resources(ctx) {
+		listed[r.URI("")] = true
+		if d.server.CheckResourceRegistered(r.URI("")) {
+			continue
+		}
+
+		if err := registerDialogResource(d.server, d.accounts, r); err != nil {
+			log.Warn().Err(err).Str("dialog", r.Name).Msg("register dialog resource")
+		}
+	}
+
+	for uri := range d.listed {
+		if listed[uri] {
+			continue
+		}
+
+		for _, u := range []string{uri, uri + tg.MessagesResource} {
+			if err := d.server.DeregisterResource(u); err != nil {
+				log.Warn().Err(err).Str("uri", u).Msg("deregister dialog resource")
+			}
+		}
+	}
+	d.listed = listed
+}
+
+func (d *dialogResources) subscribe(session, uri string, on bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	uris := d.subscribed[session]
+	if on && uris == nil {
+		uris = make(map[string]bool)
+		d.subscribed[session] = uris
+	}
+
+	if on {
+		uris[uri] = true
+		return
+	}
+
+	delete(uris, uri)
+	if len(uris) == 0 {
+		delete(d.subscribed, session)
+	}
+}
+
+// forget drops subscriptions of a session that ended.
+func (d *dialogResources) forget(session string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.subscribed, session)
+}
+
+// notify sends resource updated notifications for the dialog to sessions subscribed to it.
+func (d *dialogResources) notify(ctx context.Context, t transport.Transport, r tg.DialogResource) {
+	for _, uri := range []string{r.URI(""), r.URI(tg.MessagesResource)} {
+		d.mu.Lock()
+		var sessions []string
+		for session, uris := range d.subscribed {
+			if uris[uri] {
+				sessions = append(sessions, session)
+			}
+		}
+		d.mu.Unlock()
+
+		for _, session := range sessions {
+			notifyResourceUpdated(mcphttp.WithSession(ctx, session), t, uri)
+		}
+	}
+}
+
+// registerDialogResource exposes the dialog and its messages as resources.
+func registerDialogResource(server *mcp.Server, accounts *tg.Accounts, r tg.DialogResource) error {
+	title := r.Title
+	if r.Account != tg.DefaultAccount {
+		title += " (" + r.Account + ")"
+	}
+
+	err := server.RegisterResource(r.URI(""), title, "Telegram dialog "+r.Name+" with its last message", tg.ResourceMimeType,
+		func() (*mcp.ResourceResponse, error) { return accounts.ReadDialog(r) })
+	if err != nil {
+		return err
+	}
+
+	return server.RegisterResource(r.URI(tg.MessagesResource), title+" messages", "Latest messages of telegram dialog "+r.Name,
+		tg.ResourceMimeType, func() (*mcp.ResourceResponse, error) { return accounts.ReadMessages(r) })
+}
+
+// resourceTransport handles resource requests the library lacks: it lists dialogs when the client asks for them,
+// serves resources/subscribe and advertises subscriptions in the initialize response.
+type resourceTransport struct {
+	transport.Transport
+	resources *dialogResources
+
+	mu     sync.Mutex
+	initID *transport.RequestId
+}
+
+func newResourceTransport(t transport.Transport, resources *dialogResources) *resourceTransport {
+	// subscriptions end with the session where the transport has several of them
+	if s, ok := t.(interface{ SetSessionCloseHandler(func(id string)) }); ok {
+		s.SetSessionCloseHandler(resources.forget)
+	}
+
+	return &resourceTransport{Transport: t, resources: resources}
+}
+
+func (t *resourceTransport) SetMessageHandler(handler func(ctx context.Context, message *transport.BaseJsonRpcMessage)) {
+	t.Transport.SetMessageHandler(func(ctx context.Context, message *transport.BaseJsonRpcMessage) {
+		if message.Type != transport.BaseMessageTypeJSONRPCRequestType {
+			handler(ctx, message)
+			return
+		}
+
+		req := message.JsonRpcRequest
+		switch req.Method {
+		case "initialize":
+			t.mu.Lock()
+			t.initID = &req.Id
+			t.mu.Unlock()
+		case "resources/list":
+			// listing waits for telegram, the transport keeps reading meanwhile
+			go func() {
+				t.resources.refresh(ctx)
+				handler(ctx, message)
+			}()
+
+			return
+		case "resources/subscribe", "resources/unsubscribe":
+			t.handleSubscribe(ctx, req)
+			return
+		}
+
+		handler(ctx, message)
+	})
+}
+
+func (t *resourceTransport) handleSubscribe(ctx context.Context, req *transport.BaseJSONRPCRequest) {
+	var params struct {
+		URI string `json:"uri"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil || params.URI == "" {
+		t.sendError(ctx, req.Id, "invalid params: uri is required")
+		return
+	}
+
+	t.resources.subscribe(mcphttp.SessionID(ctx), params.URI, req.Method == "resources/subscribe")
+
+	msg := transport.NewBaseMessageResponse(&transport.BaseJSONRPCResponse{Id: req.Id, Jsonrpc: "2.0", Result: json.RawMessage("{}")})
+	if err := t.Transport.Send(ctx, msg); err != nil {
+		log.Debug().Err(err).Str("method", req.Method).Msg("send subscribe response")
+	}
+}
+
+func (t *resourceTransport) sendError(ctx context.Context, id transport.RequestId, text string) {
+	msg := transport.NewBaseMessageError(&transport.BaseJSONRPCError{
+		Id:      id,
+		Jsonrpc: "2.0",
+		Error:   transport.BaseJSONRPCErrorInner{Code: -32602, Message: text},
+	})
+	if err := t.Transport.Send(ctx, msg); err != nil {
+		log.Debug().Err(err).Msg("send error response")
+	}
+}
+
+func (t *resourceTransport) Send(ctx context.Context, message *transport.BaseJsonRpcMessage) error {
+	if message.Type == transport.BaseMessageTypeJSONRPCResponseType {
+		t.mu.Lock()
+		isInit := t.initID != nil && *t.initID == message.JsonRpcResponse.Id
+		t.mu.Unlock()
+
+		if isInit {
+			message = withSubscribe(message)
+		}
+	}
+
+	return t.Transport.Send(ctx, message)
+}
+
+// withSubscribe sets capabilities.resources.subscribe of the initialize response.
+func withSubscribe(message *transport.BaseJsonRpcMessage) *transport.BaseJsonRpcMessage {
+	var result map[string]any
+	if err := json.Unmarshal(message.JsonRpcResponse.Result, &result); err != nil {
+		return message
+	}
+
+	capabilities, _ := result["capabilities"].(map[string]any)
+	if capabilities == nil {
+		return message
+	}
+	resources, _ := capabilities["resources"].(map[string]any)
+	if resources == nil {
+		resources = make(map[string]any)
+		capabilities["resources"] = resources
+	}
+	resources["subscribe"] = true
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return message
+	}
+
+	rsp := *message.JsonRpcResponse
+	rsp.Result = data
+
+	return transport.NewBaseMessageResponse(&rsp)
+}
+
+// notifyResourceUpdated tells the client that the resource changed, the library has no server notifications api.
+func notifyResourceUpdated(ctx context.Context, t transport.Transport, uri string) {
+	params, err := json.Marshal(map[string]string{"uri": uri})
+	if err != nil {
+		log.Debug().Err(err).Msg("marshal notification")
+		return
+	}
+
+	msg := transport.NewBaseMessageNotification(&transport.BaseJSONRPCNotification{
+		Jsonrpc: "2.0",
+		Method:  "notifications/resources/updated",
+		Params:  params,
+	})
+	if err := t.Send(ctx, msg); err != nil {
+		log.Debug().Err(err).Str("uri", uri).Msg("send resource notification")
+	}
+}
@@ -2,109 +2,145 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"os"
+	"net"
 
+	"github.com/chaindead/telegram-mcp/internal/mcphttp"
+	"github.com/chaindead/telegram-mcp/internal/prompts"
 	"github.com/chaindead/telegram-mcp/internal/tg"
 
 	mcp "github.com/metoro-io/mcp-golang"
+	"github.com/metoro-io/mcp-golang/transport"
 	"github.com/metoro-io/mcp-golang/transport/stdio"
 	"github.com/rs/zerolog/log"
 	"github.com/urfave/cli/v3"
 )
 
 func serve(ctx context.Context, cmd *cli.Command) error {
-	appID := cmd.Int("app-id")
-	appHash := cmd.String("api-hash")
-	sessionPath := cmd.String("session")
-	dryRun := cmd.Bool("dry")
+	allowSend := cmd.Bool("allow-send")
 
-	_, err := os.Stat(sessionPath)
+	promptSet, err := prompts.Load(cmd.String("prompts"))
 	if err != nil {
-		return fmt.Errorf("session file not found(%s): %w", sessionPath, err)
+		return err
 	}
 
-	server := mcp.NewServer(stdio.NewStdioServerTransport())
-	client := tg.New(int(appID), appHash, sessionPath)
-
-	if dryRun {
-		answer, err := client.GetMe(tg.EmptyArguments{})
-		if err != nil {
-			return fmt.Errorf("get user: %w", err)
-		}
-
-		data, err := json.MarshalIndent(answer, "", "  ")
-		if err != nil {
-			return fmt.Errorf("marshal: %w", err)
-		}
-
-		log.Info().RawJSON("answer", data).Msg("Check GetMe: OK")
-
-		answer, err = client.GetDialogs(tg.DialogsArguments{Offset: "", OnlyUnread: true})
-		if err != nil {
-			return fmt.Errorf("get dialogs: %w", err)
-		}
+	loaded, err := loadAccounts(cmd, accountOptions{archive: cmd.Bool("archive"), updates: cmd.Bool("updates")})
+	if err != nil {
+		return err
+	}
+	defer closeAccounts(loaded)
 
-		log.Info().RawJSON("answer", []byte(answer.Content[0].TextContent.Text)).Msg("Check GetDialogs: OK")
+	t, err := newTransport(cmd)
+	if err != nil {
+		return err
+	}
 
-		answer, err = client.GetHistory(tg.HistoryArguments{Name: os.Getenv("TG_TEST_USERNAME")})
-		if err != nil {
-			return fmt.Errorf("get nickname history: %w", err)
-		}
+	accounts := tg.NewAccounts()
+	readOnly := true
+	for _, acc := range loaded {
+		accounts.Add(acc.name, acc.client)
+		readOnly = readOnly && acc.policy.ReadOnly
+	}
 
-		answer, err = client.GetHistory(tg.HistoryArguments{Name: "cht[4626931529]"})
-		if err != nil {
-			return fmt.Errorf("get chat history: %w", err)
-		}
+	resources := newDialogResources(accounts)
+	t = newResourceTransport(t, resources)
+	server := mcp.NewServer(t)
+	resources.server = server
 
-		answer, err = client.GetHistory(tg.HistoryArguments{Name: "chn[2225853048:8934705438195741763]"})
-		if err != nil {
-			return fmt.Errorf("get chan history: %w", err)
-		}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-		log.Info().RawJSON("answer", []byte(answer.Content[0].TextContent.Text)).Msg("Check GetHistory: OK")
+	updates := cmd.Bool("updates")
+	if updates {
+		accounts.OnUpdate(func(account string, u tg.UpdateInfo) {
+			if u.Dialog == "" {
+				return
+			}
 
-		answer, err = client.SendDraft(tg.DraftArguments{Name: os.Getenv("TG_TEST_USERNAME"), Text: "test draft"})
-		if err != nil {
-			log.Err(err).Msg("Check SendDraft: FAIL")
-		} else {
-			log.Info().RawJSON("answer", []byte(answer.Content[0].TextContent.Text)).Msg("Check SendDraft: OK")
-		}
+			resources.notify(ctx, t, tg.DialogResource{Account: account, Name: u.Dialog})
+		})
+	}
 
-		answer, err = client.ReadHistory(tg.ReadArguments{Name: os.Getenv("TG_TEST_USERNAME")})
-		if err != nil {
-			log.Err(err).Msg("Check ReadHistory: FAIL")
-		} else {
-			log.Info().RawJSON("answer", []byte(answer.Content[0].TextContent.Text)).Msg("Check ReadHistory: OK")
-		}
+	clientDone := make(chan struct{})
+	go func() {
+		accounts.Run(ctx)
+		close(clientDone)
+	}()
+	defer func() {
+		cancel()
+		<-clientDone
+	}()
 
-		return nil
-	}
+	log.Info().Strs("accounts", accounts.Names()).Msg("Accounts loaded")
 
-	err = server.RegisterTool("tg_me", "Get current telegram account info", client.GetMe)
+	err = server.RegisterTool("tg_me", "Get info of loaded telegram accounts", accounts.GetMe)
 	if err != nil {
 		return fmt.Errorf("register tool: %w", err)
 	}
 
-	err = server.RegisterTool("tg_dialogs", "Get list of telegram dialogs (chats, channels, users)", client.GetDialogs)
+	err = server.RegisterTool("tg_dialogs", "Get list of telegram dialogs (chats, channels, users)", tg.Route(accounts, (*tg.Client).GetDialogs))
 	if err != nil {
 		return fmt.Errorf("register dialogs tool: %w", err)
 	}
 
-	err = server.RegisterTool("tg_dialog", "Get messages of telegram dialog", client.GetHistory)
+	err = server.RegisterTool("tg_dialog", "Get messages of telegram dialog", tg.Route(accounts, (*tg.Client).GetHistory))
 	if err != nil {
 		return fmt.Errorf("register dialogs tool: %w", err)
 	}
 
-	err = server.RegisterTool("tg_send", "Send draft message to dialog", client.SendDraft)
+	err = server.RegisterTool("tg_unread", "Get unread messages of all unread dialogs in one call", tg.Route(accounts, (*tg.Client).GetUnread))
 	if err != nil {
-		return fmt.Errorf("register dialogs tool: %w", err)
+		return fmt.Errorf("register unread tool: %w", err)
 	}
 
-	err = server.RegisterTool("tg_read", "Mark dialog messages as read", client.ReadHistory)
+	err = server.RegisterTool("tg_download_media", "Download photo or document of a message to local file",
+		tg.Route(accounts, (*tg.Client).DownloadMedia))
 	if err != nil {
-		return fmt.Errorf("register read tool: %w", err)
+		return fmt.Errorf("register download tool: %w", err)
+	}
+
+	err = server.RegisterTool("tg_search", "Search messages in all dialogs or in one dialog", tg.Route(accounts, (*tg.Client).Search))
+	if err != nil {
+		return fmt.Errorf("register search tool: %w", err)
+	}
+
+	if updates {
+		err = server.RegisterTool("tg_updates_since", "Get new, edited and deleted messages received after seq, optionally waiting for them",
+			tg.Route(accounts, (*tg.Client).GetUpdates))
+		if err != nil {
+			return fmt.Errorf("register updates tool: %w", err)
+		}
+	}
+
+	if !readOnly {
+		err = server.RegisterTool("tg_send", "Send draft message to dialog", tg.Route(accounts, (*tg.Client).SendDraft))
+		if err != nil {
+			return fmt.Errorf("register dialogs tool: %w", err)
+		}
+
+		if allowSend {
+			err = server.RegisterTool("tg_send_message", "Send text message to dialog", tg.Route(accounts, (*tg.Client).SendMessage))
+			if err != nil {
+				return fmt.Errorf("register send message tool: %w", err)
+			}
+		}
+
+		err = server.RegisterTool("tg_read", "Mark dialog messages as read", tg.Route(accounts, (*tg.Client).ReadHistory))
+		if err != nil {
+			return fmt.Errorf("register read tool: %w", err)
+		}
+	}
+
+	// prompts mention only tools registered above
+	promptSet, err = prompts.ForTools(promptSet, server.CheckToolRegistered)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range promptSet {
+		if err := server.RegisterPrompt(p.Name, p.Description, p.Handler()); err != nil {
+			return fmt.Errorf("register prompt %s: %w", p.Name, err)
+		}
 	}
 
 	if err := server.Serve(); err != nil {
@@ -113,5 +149,36 @@ func serve(ctx context.Context, cmd *cli.Command) error {
 
 	<-ctx.Done()
 
+	if err := t.Close(); err != nil {
+		log.Warn().Err(err).Msg("close transport")
+	}
+
 	return nil
 }
+
+const (
+	transportStdio = "stdio"
+	transportHTTP  = "http"
+)
+
+func newTransport(cmd *cli.Command) (transport.Transport, error) {
+	switch kind := cmd.String("transport"); kind {
+	case transportStdio:
+		return stdio.NewStdioServerTransport(), nil
+	case transportHTTP:
+		addr := cmd.String("listen")
+		token := cmd.String("http-token")
+		if token == "" {
+			host, _, _ := net.SplitHostPort(addr)
+			if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+				return nil, fmt.Errorf("http transport on non-loopback address %q requires --http-token", addr)
+			}
+
+			log.Warn().Msg("http transport is running without bearer token")
+		}
+
+		return mcphttp.New(addr, token), nil
+	default:
+		return nil, fmt.Errorf("unknown transport %q", kind)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/chaindead/telegram-mcp/internal/tg"
+
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v3"
+)
+
+// sessionSecret returns session encryption secret from passphrase or key file, nil when session is plaintext.
+func sessionSecret(cmd *cli.Command) ([]byte, error) {
+	passphrase := cmd.Root().String("session-passphrase")
+	keyFile := cmd.Root().String("session-key-file")
+
+	switch {
+	case passphrase != "" && keyFile != "":
+		return nil, fmt.Errorf("use either session passphrase or session key file")
+	case passphrase != "":
+		return []byte(passphrase), nil
+	case keyFile != "":
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("read session key file: %w", err)
+		}
+
+		key := strings.TrimSpace(string(data))
+		if key == "" {
+			return nil, fmt.Errorf("session key file %s is empty", keyFile)
+		}
+
+		return []byte(key), nil
+	default:
+		return nil, nil
+	}
+}
+
+// migrateCommand encrypts or decrypts the --session account and every profile session.
+func migrateCommand(_ context.Context, cmd *cli.Command) error {
+	decrypt := cmd.Bool("decrypt")
+
+	secret, err := sessionSecret(cmd)
+	if err != nil {
+		return err
+	}
+
+	sessions, err := sessionPaths(cmd)
+	if err != nil {
+		return err
+	}
+	if len(sessions) == 0 {
+		return fmt.Errorf("session file not found(%s) and no profiles in %s",
+			cmd.Root().String("session"), cmd.Root().String("profiles-dir"))
+	}
+
+	for _, sessionPath := range sessions {
+		if err := tg.MigrateSession(sessionPath, secret, decrypt); err != nil {
+			return fmt.Errorf("migrate session(%s): %w", sessionPath, err)
+		}
+
+		log.Info().Str("session", sessionPath).Bool("decrypted", decrypt).Msg("Session migrated")
+	}
+
+	return nil
+}
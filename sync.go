@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/chaindead/telegram-mcp/internal/tg"
+
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v3"
+)
+
+func syncCommand(ctx context.Context, cmd *cli.Command) error {
+	loaded, err := loadAccounts(cmd, accountOptions{archive: true})
+	if err != nil {
+		return err
+	}
+	defer closeAccounts(loaded)
+
+	opts := tg.SyncOptions{
+		Dialogs: cmd.StringSlice("dialog"),
+		Depth:   int(cmd.Int("depth")),
+	}
+
+	name := cmd.String("account")
+	var synced bool
+	for _, acc := range loaded {
+		if name != "" && acc.name != name {
+			continue
+		}
+
+		if err := syncAccount(ctx, acc, opts); err != nil {
+			return fmt.Errorf("account %s: %w", acc.name, err)
+		}
+		synced = true
+	}
+
+	if !synced {
+		return fmt.Errorf("unknown account %q", name)
+	}
+
+	return nil
+}
+
+// syncAccount connects the account for the duration of the sync.
+func syncAccount(ctx context.Context, acc account, opts tg.SyncOptions) error {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		_ = acc.client.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	result, err := acc.client.Sync(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	log.Info().
+		Str("account", acc.name).
+		Int("dialogs", result.Dialogs).
+		Int("messages", result.Messages).
+		Int("partial", result.Partial).
+		Msg("Archive synced")
+	if result.Partial > 0 {
+		log.Warn().Int("dialogs", result.Partial).Msg("Older history of some dialogs is not archived yet, run sync again to continue")
+	}
+
+	return nil
+}
@@ -0,0 +1,451 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/chaindead/telegram-mcp/internal/tg"
+
+	mcp "github.com/metoro-io/mcp-golang"
+	"github.com/urfave/cli/v3"
+)
+
+const (
+	formatJSON  = "json"
+	formatTable = "table"
+)
+
+// toolCommands mirror MCP tools, printing the same JSON the model receives.
+func toolCommands() []*cli.Command {
+	return []*cli.Command{
+		{
+			Name:   "me",
+			Usage:  "Print loaded accounts like tg_me",
+			Flags:  toolFlags(),
+			Action: meCommand,
+		},
+		{
+			Name:  "dialogs",
+			Usage: "Print dialogs like tg_dialogs",
+			Flags: toolFlags(
+				&cli.StringFlag{Name: "offset", Usage: "Offset for continuation"},
+				&cli.BoolFlag{Name: "unread", Usage: "Include only dialogs with unread mark", HideDefault: true},
+				&cli.StringFlag{Name: "type", Usage: "Include only dialogs of this type: user, bot, chat or channel"},
+				&cli.StringFlag{Name: "query", Usage: "Include only dialogs whose title or name contains this text"},
+				&cli.BoolFlag{Name: "pinned", Usage: "Include only pinned dialogs", HideDefault: true},
+				&cli.StringFlag{Name: "muted", Usage: "Include only muted or only unmuted dialogs"},
+				&cli.BoolFlag{Name: "archived", Usage: "List archived dialogs instead of the main list", HideDefault: true},
+				&cli.IntFlag{Name: "limit", Usage: "Number of dialogs to scan per page"},
+				sourceFlag(),
+			),
+			Action: dialogsCommand,
+		},
+		{
+			Name:      "history",
+			Usage:     "Print messages of a dialog like tg_dialog",
+			ArgsUsage: "<name>",
+			Flags: toolFlags(
+				&cli.IntFlag{Name: "offset", Usage: "Offset for continuation"},
+				&cli.IntFlag{Name: "limit", Usage: "Maximum number of messages"},
+				&cli.StringFlag{Name: "since", Usage: "Only messages after this time"},
+				&cli.StringFlag{Name: "until", Usage: "Only messages before this time"},
+				&cli.IntFlag{Name: "min-id", Usage: "Only messages with id greater than this"},
+				&cli.IntFlag{Name: "max-id", Usage: "Only messages with id less than this"},
+				&cli.BoolFlag{Name: "forward", Usage: "Page from older to newer messages", HideDefault: true},
+				&cli.BoolFlag{Name: "unread", Usage: "Only incoming messages not read yet", HideDefault: true},
+				sourceFlag(),
+			),
+			Action: historyCommand,
+		},
+		{
+			Name:  "unread",
+			Usage: "Print unread messages of all unread dialogs like tg_unread",
+			Flags: toolFlags(
+				&cli.IntFlag{Name: "limit", Usage: "Maximum unread messages per dialog"},
+				&cli.IntFlag{Name: "max-dialogs", Usage: "Maximum dialogs to include"},
+			),
+			Action: unreadCommand,
+		},
+		{
+			Name:      "search",
+			Usage:     "Search messages like tg_search",
+			ArgsUsage: "<query>",
+			Flags: toolFlags(
+				&cli.StringFlag{Name: "dialog", Usage: "Name of the dialog to search in, all dialogs if empty"},
+				&cli.StringFlag{Name: "from", Usage: "Name of the message sender"},
+				&cli.StringFlag{Name: "since", Usage: "Only messages after this time"},
+				&cli.StringFlag{Name: "until", Usage: "Only messages before this time"},
+				&cli.StringFlag{Name: "media", Usage: "Only messages of this kind, e.g. photo or document"},
+				&cli.IntFlag{Name: "limit", Usage: "Maximum number of messages"},
+				&cli.StringFlag{Name: "offset", Usage: "Offset for continuation"},
+				sourceFlag(),
+			),
+			Action: searchCommand,
+		},
+		{
+			Name:      "draft",
+			Usage:     "Save a draft like tg_send",
+			ArgsUsage: "<name> <text>",
+			Flags:     toolFlags(),
+			Action:    draftCommand,
+		},
+		{
+			Name:      "send",
+			Usage:     "Send a message like tg_send_message, requires --allow-send",
+			ArgsUsage: "<name> <text>",
+			Flags: toolFlags(
+				&cli.IntFlag{Name: "reply-to", Usage: "ID of the message to reply to"},
+				&cli.BoolFlag{Name: "silent", Usage: "Send without notification sound", HideDefault: true},
+				&cli.BoolFlag{Name: "no-preview", Usage: "Disable link preview", HideDefault: true},
+			),
+			Action: sendCommand,
+		},
+		{
+			Name:      "read",
+			Usage:     "Mark dialog messages as read like tg_read",
+			ArgsUsage: "<name>",
+			Flags:     toolFlags(),
+			Action:    readCommand,
+		},
+		{
+			Name:      "download",
+			Usage:     "Download media of a message like tg_download_media",
+			ArgsUsage: "<name> <message-id>",
+			Flags:     toolFlags(),
+			Action:    downloadCommand,
+		},
+	}
+}
+
+func toolFlags(flags ...cli.Flag) []cli.Flag {
+	return append([]cli.Flag{
+		&cli.StringFlag{
+			Name:  "account",
+			Usage: "Account profile to use, default account if empty",
+		},
+		&cli.StringFlag{
+			Name:  "format",
+			Usage: "Output format: json prints the tool response as is, table is for humans",
+			Value: formatJSON,
+		},
+	}, flags...)
+}
+
+func sourceFlag() cli.Flag {
+	return &cli.StringFlag{Name: "source", Usage: "Read from telegram (default) or from local archive"}
+}
+
+// toolArgs returns positional arguments of the command, which must be exactly len(names).
+func toolArgs(cmd *cli.Command, names ...string) ([]string, error) {
+	if cmd.Args().Len() != len(names) {
+		return nil, fmt.Errorf("usage: %s %s", cmd.FullName(), cmd.ArgsUsage)
+	}
+
+	return cmd.Args().Slice(), nil
+}
+
+func accountArgument(cmd *cli.Command) tg.AccountArgument {
+	return tg.AccountArgument{Account: cmd.String("account")}
+}
+
+// runTool connects accounts for a single tool call and prints its response in the --format.
+func runTool[R any](
+	ctx context.Context,
+	cmd *cli.Command,
+	call func(*tg.Accounts) (*mcp.ToolResponse, error),
+	table func(io.Writer, R),
+) error {
+	format := cmd.String("format")
+	if format != formatJSON && format != formatTable {
+		return fmt.Errorf("unknown format %q, use %s or %s", format, formatJSON, formatTable)
+	}
+
+	loaded, err := loadAccounts(cmd, accountOptions{archive: cmd.Bool("archive")})
+	if err != nil {
+		return err
+	}
+	defer closeAccounts(loaded)
+
+	accounts := tg.NewAccounts()
+	for _, acc := range loaded {
+		accounts.Add(acc.name, acc.client)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		accounts.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	rsp, err := call(accounts)
+	if err != nil {
+		return err
+	}
+
+	text := rsp.Content[0].TextContent.Text
+	if format == formatJSON {
+		_, err := fmt.Println(text)
+		return err
+	}
+
+	var v R
+	if err := json.Unmarshal([]byte(text), &v); err != nil {
+		return fmt.Errorf("parse response: %w", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	table(w, v)
+
+	return w.Flush()
+}
+
+func meCommand(ctx context.Context, cmd *cli.Command) error {
+	return runTool(ctx, cmd, func(a *tg.Accounts) (*mcp.ToolResponse, error) {
+		return a.GetMe(tg.MeArguments{AccountArgument: accountArgument(cmd)})
+	}, func(w io.Writer, rsp tg.AccountsResponse) {
+		fmt.Fprintln(w, "ACCOUNT\tID\tUSERNAME\tNAME\tERROR")
+		for _, acc := range rsp.Accounts {
+			me := acc.MeResponse
+			if me == nil {
+				me = &tg.MeResponse{}
+			}
+
+			name := strings.TrimSpace(me.FirstName + " " + me.LastName)
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", acc.Account, me.ID, me.Username, name, acc.Error)
+		}
+	})
+}
+
+// dialogsTable is tg.DialogsResponse with the offset as printed by the tool.
+type dialogsTable struct {
+	Dialogs []tg.DialogInfo `json:"dialogs"`
+	Offset  string          `json:"offset"`
+}
+
+func dialogsCommand(ctx context.Context, cmd *cli.Command) error {
+	args := tg.DialogsArguments{
+		Offset:          cmd.String("offset"),
+		OnlyUnread:      cmd.Bool("unread"),
+		Type:            cmd.String("type"),
+		Query:           cmd.String("query"),
+		OnlyPinned:      cmd.Bool("pinned"),
+		Muted:           cmd.String("muted"),
+		Archived:        cmd.Bool("archived"),
+		Limit:           int(cmd.Int("limit")),
+		SourceArgument:  tg.SourceArgument{Source: cmd.String("source")},
+		AccountArgument: accountArgument(cmd),
+	}
+
+	return runTool(ctx, cmd, func(a *tg.Accounts) (*mcp.ToolResponse, error) {
+		return tg.Route(a, (*tg.Client).GetDialogs)(args)
+	}, func(w io.Writer, rsp dialogsTable) {
+		fmt.Fprintln(w, "NAME\tTYPE\tTITLE\tUNREAD\tWHEN\tLAST MESSAGE")
+		for _, d := range rsp.Dialogs {
+			var unread, when, text string
+			if m := d.LastMessage; m != nil {
+				if m.IsUnread {
+					unread = "yes"
+				}
+				when, text = m.When, messageText(*m)
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", d.Name, d.Type, d.Title, unread, when, text)
+		}
+		fmt.Fprintf(w, "\noffset: %s\n", rsp.Offset)
+	})
+}
+
+func historyCommand(ctx context.Context, cmd *cli.Command) error {
+	pos, err := toolArgs(cmd, "name")
+	if err != nil {
+		return err
+	}
+
+	args := tg.HistoryArguments{
+		Name:            pos[0],
+		Offset:          int(cmd.Int("offset")),
+		Limit:           int(cmd.Int("limit")),
+		Since:           cmd.String("since"),
+		Until:           cmd.String("until"),
+		MinID:           int(cmd.Int("min-id")),
+		MaxID:           int(cmd.Int("max-id")),
+		Forward:         cmd.Bool("forward"),
+		OnlyUnread:      cmd.Bool("unread"),
+		SourceArgument:  tg.SourceArgument{Source: cmd.String("source")},
+		AccountArgument: accountArgument(cmd),
+	}
+
+	return runTool(ctx, cmd, func(a *tg.Accounts) (*mcp.ToolResponse, error) {
+		return tg.Route(a, (*tg.Client).GetHistory)(args)
+	}, func(w io.Writer, rsp tg.HistoryResponse) {
+		messagesTable(w, rsp.Messages)
+		if rsp.Offset != 0 {
+			fmt.Fprintf(w, "\noffset: %d\n", rsp.Offset)
+		}
+	})
+}
+
+func unreadCommand(ctx context.Context, cmd *cli.Command) error {
+	args := tg.UnreadArguments{
+		Limit:           int(cmd.Int("limit")),
+		MaxDialogs:      int(cmd.Int("max-dialogs")),
+		AccountArgument: accountArgument(cmd),
+	}
+
+	return runTool(ctx, cmd, func(a *tg.Accounts) (*mcp.ToolResponse, error) {
+		return tg.Route(a, (*tg.Client).GetUnread)(args)
+	}, func(w io.Writer, rsp tg.UnreadResponse) {
+		for i, d := range rsp.Dialogs {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+
+			fmt.Fprintf(w, "%s (%s, %d unread)\n", d.Title, d.Name, d.UnreadCount)
+			messagesTable(w, d.Messages)
+		}
+	})
+}
+
+func searchCommand(ctx context.Context, cmd *cli.Command) error {
+	pos, err := toolArgs(cmd, "query")
+	if err != nil {
+		return err
+	}
+
+	args := tg.SearchArguments{
+		Query:           pos[0],
+		Name:            cmd.String("dialog"),
+		From:            cmd.String("from"),
+		Since:           cmd.String("since"),
+		Until:           cmd.String("until"),
+		Media:           cmd.String("media"),
+		Limit:           int(cmd.Int("limit")),
+		Offset:          cmd.String("offset"),
+		SourceArgument:  tg.SourceArgument{Source: cmd.String("source")},
+		AccountArgument: accountArgument(cmd),
+	}
+
+	return runTool(ctx, cmd, func(a *tg.Accounts) (*mcp.ToolResponse, error) {
+		return tg.Route(a, (*tg.Client).Search)(args)
+	}, func(w io.Writer, rsp tg.SearchResponse) {
+		fmt.Fprintln(w, "DIALOG\tID\tWHEN\tWHO\tTEXT")
+		for _, m := range rsp.Messages {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", m.Dialog, m.ID, m.When, sender(m.MessageInfo), messageText(m.MessageInfo))
+		}
+		if rsp.Offset != "" {
+			fmt.Fprintf(w, "\noffset: %s\n", rsp.Offset)
+		}
+	})
+}
+
+func draftCommand(ctx context.Context, cmd *cli.Command) error {
+	pos, err := toolArgs(cmd, "name", "text")
+	if err != nil {
+		return err
+	}
+
+	args := tg.DraftArguments{Name: pos[0], Text: pos[1], AccountArgument: accountArgument(cmd)}
+
+	return runTool(ctx, cmd, func(a *tg.Accounts) (*mcp.ToolResponse, error) {
+		return tg.Route(a, (*tg.Client).SendDraft)(args)
+	}, func(w io.Writer, rsp tg.DraftResponse) {
+		fmt.Fprintf(w, "success:\t%t\n", rsp.Success)
+	})
+}
+
+func sendCommand(ctx context.Context, cmd *cli.Command) error {
+	if !cmd.Bool("allow-send") {
+		return fmt.Errorf("sending messages is disabled, pass --allow-send")
+	}
+
+	pos, err := toolArgs(cmd, "name", "text")
+	if err != nil {
+		return err
+	}
+
+	args := tg.SendArguments{
+		Name:            pos[0],
+		Text:            pos[1],
+		ReplyTo:         int(cmd.Int("reply-to")),
+		Silent:          cmd.Bool("silent"),
+		NoPreview:       cmd.Bool("no-preview"),
+		AccountArgument: accountArgument(cmd),
+	}
+
+	return runTool(ctx, cmd, func(a *tg.Accounts) (*mcp.ToolResponse, error) {
+		return tg.Route(a, (*tg.Client).SendMessage)(args)
+	}, func(w io.Writer, rsp tg.SendResponse) {
+		fmt.Fprintf(w, "id:\t%d\nwhen:\t%s\n", rsp.ID, rsp.When)
+	})
+}
+
+func readCommand(ctx context.Context, cmd *cli.Command) error {
+	pos, err := toolArgs(cmd, "name")
+	if err != nil {
+		return err
+	}
+
+	args := tg.ReadArguments{Name: pos[0], AccountArgument: accountArgument(cmd)}
+
+	return runTool(ctx, cmd, func(a *tg.Accounts) (*mcp.ToolResponse, error) {
+		return tg.Route(a, (*tg.Client).ReadHistory)(args)
+	}, func(w io.Writer, rsp tg.ReadResponse) {
+		fmt.Fprintf(w, "result:\t%s\n", rsp.Result)
+	})
+}
+
+func downloadCommand(ctx context.Context, cmd *cli.Command) error {
+	pos, err := toolArgs(cmd, "name", "message-id")
+	if err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(pos[1])
+	if err != nil {
+		return fmt.Errorf("invalid message id %q: %w", pos[1], err)
+	}
+
+	args := tg.DownloadArguments{Name: pos[0], MessageID: id, AccountArgument: accountArgument(cmd)}
+
+	return runTool(ctx, cmd, func(a *tg.Accounts) (*mcp.ToolResponse, error) {
+		return tg.Route(a, (*tg.Client).DownloadMedia)(args)
+	}, func(w io.Writer, rsp tg.DownloadResponse) {
+		fmt.Fprintf(w, "path:\t%s\nsize:\t%d\nmime:\t%s\n", rsp.Path, rsp.Size, rsp.Mime)
+	})
+}
+
+func messagesTable(w io.Writer, messages []tg.MessageInfo) {
+	fmt.Fprintln(w, "ID\tWHEN\tWHO\tTEXT")
+	for _, m := range messages {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", m.ID, m.When, sender(m), messageText(m))
+	}
+}
+
+func sender(m tg.MessageInfo) string {
+	if m.Out {
+		return "me"
+	}
+
+	return m.Who
+}
+
+// messageText flattens text to a single table cell, media without caption is shown by its kind.
+func messageText(m tg.MessageInfo) string {
+	text := strings.Join(strings.Fields(m.Text), " ")
+	if m.Media != nil {
+		text = strings.TrimSpace(fmt.Sprintf("[%s] %s", m.Media.Kind, text))
+	}
+
+	return text
+}